@@ -1,7 +1,7 @@
 package EPLookup_addrs
 
 import (
-	"crypto/tls"
+	"context"
 	"flag"
 	"fmt"
 	"net"
@@ -20,27 +20,15 @@ import (
 
  Important: origin needs correct port number to access HTTP(S) service.
 
- Example: getSslCertificateInfo("https://google.com:443")
+ Example: getSslCertificateInfo(ctx, httpClient, "google.com:443")
 
- Default timeout: 10 secs
+ The certificates are fetched with httpClient, so -proxy, the TLS options and rate limits apply.
 */
-func GetSslCertificateInfo(origin string) (maybeValidUrls string, maybeValidOrgs string) {
-	tlsConf := &tls.Config{
-		InsecureSkipVerify: true,
-	}
-	conn, err := tls.DialWithDialer(
-		&net.Dialer{
-			Timeout: time.Second * 5,
-		},
-		"tcp",
-		origin,
-		tlsConf,
-	)
+func GetSslCertificateInfo(ctx context.Context, httpClient *EPUtils.HTTPClient, origin string) (maybeValidUrls string, maybeValidOrgs string) {
+	certs, err := httpClient.GetPeerCertificates(ctx, origin)
 	if err != nil {
 		return "", ""
 	}
-	defer conn.Close()
-	certs := conn.ConnectionState().PeerCertificates
 	for _, cert := range certs {
 		// also will match URL inside a wildcard domain, like *.example.com -> .example.com
 		maybeValidUrl := UrlRegex.FindString(cert.Subject.CommonName)
@@ -58,9 +46,14 @@ func GetSslCertificateInfo(origin string) (maybeValidUrls string, maybeValidOrgs
 	return strings.TrimSuffix(maybeValidUrls, ","), strings.TrimSuffix(maybeValidOrgs, ",")
 }
 
-func GetIpInfo(ipWithMaybePortNum string) (string, string, string, string) {
-	ipSplit := strings.Split(ipWithMaybePortNum, ":")
-	ip := ipSplit[0]
+// the certificate is requested from the host through httpClient,
+// and the reverse DNS and CNAME are looked up with its resolver, which looks up nothing with -proxy
+func GetIpInfo(ctx context.Context, httpClient *EPUtils.HTTPClient, ipWithMaybePortNum string) (string, string, string, string) {
+	ip, port := EPUtils.SplitTargetHostPort(ipWithMaybePortNum)
+	// a certificate can only be read over https
+	if port == "" {
+		port = "443"
+	}
 
 	wg := sync.WaitGroup{}
 	subjectUrlsChan := make(chan string)
@@ -70,7 +63,7 @@ func GetIpInfo(ipWithMaybePortNum string) (string, string, string, string) {
 	wg.Add(1)
 	go func(cloudHostingProvidersChan chan string) {
 		defer wg.Done()
-		validDomains, err := net.LookupAddr(ip)
+		validDomains, err := httpClient.Resolver().LookupAddr(ctx, ip)
 		if err == nil {
 			for _, domain := range validDomains {
 				if EPUtils.ContainsEndsWith(domain, NOT_REALLY_INTERESTING_DOMAINS) == -1 {
@@ -89,7 +82,7 @@ func GetIpInfo(ipWithMaybePortNum string) (string, string, string, string) {
 	wg.Add(1)
 	go func(organizationsChan chan string, subjectUrlsChan chan string) {
 		defer wg.Done()
-		subjectUrls, organizations := GetSslCertificateInfo(ipWithMaybePortNum)
+		subjectUrls, organizations := GetSslCertificateInfo(ctx, httpClient, net.JoinHostPort(ip, port))
 		if subjectUrls != "" || organizations != "" {
 			subjectUrlsChan <- subjectUrls
 			organizationsChan <- organizations
@@ -101,10 +94,9 @@ func GetIpInfo(ipWithMaybePortNum string) (string, string, string, string) {
 	wg.Add(1)
 	go func(cnameChan chan string) {
 		defer wg.Done()
-		cname, err := net.LookupCNAME(ip)
+		cname, err := httpClient.Resolver().LookupCNAME(ctx, ip)
 
 		if cname != "" || err == nil {
-			fmt.Println(cname)
 			cnameChan <- cname
 		} else {
 			cnameChan <- ""
@@ -125,10 +117,11 @@ func parseFlagsAndInit() (inputFilePath *string, outputFilePath *string, numThre
 	isVerbose := flagSet.Bool("verbose", true, "Verbosity")
 
 	if err := flagSet.Parse(os.Args[1:]); err != nil {
-		fmt.Println("Failed to parse flags.")
-		fmt.Println(`Example: 
-./lookup-addrs -threads=30 -inputFilePath=input.txt -outputFilePath=output.csv -verbose=false`)
-		fmt.Println("Note that the boolean flag should be fed as -isVerbose=false. -isVerbose false won't get it to work.")
+		EPUtils.Printf("Failed to parse flags.\n")
+		EPUtils.Printf(`Example: 
+./lookup-addrs -threads=30 -inputFilePath=input.txt -outputFilePath=output.csv -verbose=false
+`)
+		EPUtils.Printf("Note that the boolean flag should be fed as -isVerbose=false. -isVerbose false won't get it to work.\n")
 		panic(err)
 	}
 	logger = CreateMaybeVerboseEPLogger(*isVerbose)
@@ -152,6 +145,12 @@ func main() {
 		return
 	}
 
+	httpClient, err := EPUtils.NewHTTPClient(EPUtils.HTTPClientOptions{
+		ConnectTimeout: 5 * time.Second,
+		ReadTimeout:    5 * time.Second,
+	})
+	EPUtils.ExitOnError(err)
+
 	concurrentGoroutines := make(chan struct{}, *numThreads)
 	f, err := os.Create(*outputFilePath)
 	EPUtils.ExitOnError(err)
@@ -165,7 +164,7 @@ func main() {
 
 			concurrentGoroutines <- struct{}{}
 
-			cloudHostingProvider, subjectUrls, organization, cname := GetIpInfo(ipWithMaybePortNum)
+			cloudHostingProvider, subjectUrls, organization, cname := GetIpInfo(context.Background(), httpClient, ipWithMaybePortNum)
 			result := strings.ReplaceAll(fmt.Sprintf("%s,%s,%s,%s,%s", ipWithMaybePortNum, cloudHostingProvider, subjectUrls, organization, cname), "\n", "")
 			if cloudHostingProvider != "" || subjectUrls != "" || organization != "" || cname != "" {
 				EPUtils.EPLogger(result)
@@ -0,0 +1,103 @@
+package EPPlugins
+
+import (
+	"bufio"
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+
+	EPUtils "github.com/9oelM/elasticpwn/elasticpwn/util"
+)
+
+// Converts output of elasticsearch/kibana plugins between jsonl (or plain) and a JSON array.
+// The direction is detected from the input: a JSON array becomes jsonl, and anything else becomes a JSON array.
+// Both directions are streamed, so it works with outputs larger than memory.
+type ConvertPlugin struct {
+	InputFilePath  string
+	OutputFilePath string
+}
+
+func init() {
+	RegisterPlugin(&ConvertPlugin{})
+}
+
+func (cp *ConvertPlugin) Name() string {
+	return "convert"
+}
+
+func (cp *ConvertPlugin) Example() string {
+	return "elasticpwn convert -i elasticsearch.jsonl -o elasticsearch.json"
+}
+
+func (cp *ConvertPlugin) DefineFlags(fs *flag.FlagSet) {
+	fs.StringVar(&cp.InputFilePath, "i", "", `[REQUIRED] path to the file to convert.
+If it is a JSON array, it will be converted into jsonl. Otherwise, it is read as jsonl (or plain) and converted into a JSON array.`)
+	fs.StringVar(&cp.OutputFilePath, "o", "", "[REQUIRED] path to the converted file")
+}
+
+func (cp *ConvertPlugin) Validate() bool {
+	needsExit := EPUtils.ValidateStringFlag(cp.InputFilePath, "", "-i") ||
+		EPUtils.ValidateStringFlag(cp.OutputFilePath, "", "-o")
+
+	if !needsExit && filepath.Clean(cp.InputFilePath) == filepath.Clean(cp.OutputFilePath) {
+		EPUtils.Printf("-i and -o can't be the same file.\n")
+		needsExit = true
+	}
+
+	return needsExit
+}
+
+func (cp *ConvertPlugin) Prepare() {}
+
+func (cp *ConvertPlugin) Run(ctx context.Context) {
+	inputFile, err := os.Open(filepath.FromSlash(cp.InputFilePath))
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer inputFile.Close()
+	outputFile, err := os.Create(filepath.FromSlash(cp.OutputFilePath))
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer outputFile.Close()
+
+	input := bufio.NewReader(inputFile)
+	isJSONArray, err := startsWithJSONArray(input)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	var count int
+	if isJSONArray {
+		EPUtils.EPLogger(fmt.Sprintf("Converting JSON array in %v into jsonl", cp.InputFilePath))
+		count, err = EPUtils.ConvertJSONArrayToJSONLines(input, outputFile)
+	} else {
+		EPUtils.EPLogger(fmt.Sprintf("Converting jsonl in %v into JSON array", cp.InputFilePath))
+		count, err = EPUtils.ConvertJSONLinesToJSONArray(input, outputFile)
+	}
+	if err != nil {
+		log.Fatal(fmt.Sprintf("Failed to convert %v after %d objects: %v", cp.InputFilePath, count, err))
+	}
+	EPUtils.EPLogger(fmt.Sprintf("Converted %d objects into %v", count, cp.OutputFilePath))
+}
+
+func (cp *ConvertPlugin) PostProcess() {}
+
+// peeks at the first non-whitespace byte without consuming it
+func startsWithJSONArray(input *bufio.Reader) (bool, error) {
+	for {
+		b, err := input.ReadByte()
+		if err != nil {
+			// empty input is converted into an empty JSON array
+			return false, nil
+		}
+		switch b {
+		case ' ', '\t', '\r', '\n':
+			continue
+		}
+		return b == '[', input.UnreadByte()
+	}
+}
@@ -1,18 +1,20 @@
 package EPPlugins
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"os"
+	"path/filepath"
 	"regexp"
+	"strconv"
 	"strings"
 	"sync"
-	"time"
 
 	EPUtils "github.com/9oelM/elasticpwn/elasticpwn/util"
-
-	"go.mongodb.org/mongo-driver/bson"
-	"go.mongodb.org/mongo-driver/mongo"
 )
 
 // elastic-util contains common stuffs relevant to elastic products,
@@ -45,6 +47,18 @@ type InterestingIndexInfo struct {
 	DocsDeleted  string `bson:"docs.deleted,omitempty" json:"docs.deleted"`
 	StoreSize    string `bson:"store.size,omitempty" json:"store.size"`
 	PriStoreSize string `bson:"pri.store.size,omitempty" json:"pri.store.size"`
+	// parsed from the strings above. nil if absent or not a number, like when the index is closed
+	DocsCountNumber   *int64 `bson:"docsCountNumber,omitempty" json:"docsCountNumber"`
+	DocsDeletedNumber *int64 `bson:"docsDeletedNumber,omitempty" json:"docsDeletedNumber"`
+	StoreSizeBytes    *int64 `bson:"storeSizeBytes,omitempty" json:"storeSizeBytes"`
+	PriStoreSizeBytes *int64 `bson:"priStoreSizeBytes,omitempty" json:"priStoreSizeBytes"`
+	// fields of the mapping whose names look sensitive. empty if none, or if the mapping could not be requested
+	SensitiveFields []EPUtils.SensitiveField `bson:"sensitiveFields,omitempty" json:"sensitiveFields,omitempty"`
+	// how likely the index holds sensitive data. indices with the highest scores are requested within -max-i.
+	// nil if it was not scored
+	Score *int `bson:"score,omitempty" json:"score,omitempty"`
+	// points that make up Score, like "name has customer +40, 2355 docs +20"
+	ScoreReason string `bson:"scoreReason,omitempty" json:"scoreReason"`
 }
 
 func filterInterestingIndexFields(indexInfo IndexInfo) InterestingIndexInfo {
@@ -55,10 +69,33 @@ func filterInterestingIndexFields(indexInfo IndexInfo) InterestingIndexInfo {
 	interestingIndexInfo.StoreSize = indexInfo.StoreSize
 	interestingIndexInfo.PriStoreSize = indexInfo.PriStoreSize
 	interestingIndexInfo.Index = indexInfo.Index
+	parseIndexSizes(&interestingIndexInfo)
 
 	return interestingIndexInfo
 }
 
+// fills the typed values of docs.count, docs.deleted, store.size and pri.store.size of indexInfo
+func parseIndexSizes(indexInfo *InterestingIndexInfo) {
+	parseInt := func(count string) *int64 {
+		number, err := strconv.ParseInt(strings.TrimSpace(count), 10, 64)
+		if err != nil {
+			return nil
+		}
+		return &number
+	}
+	parseByteSize := func(size string) *int64 {
+		bytes, err := EPUtils.ParseByteSize(size)
+		if err != nil {
+			return nil
+		}
+		return &bytes
+	}
+	indexInfo.DocsCountNumber = parseInt(indexInfo.DocsCount)
+	indexInfo.DocsDeletedNumber = parseInt(indexInfo.DocsDeleted)
+	indexInfo.StoreSizeBytes = parseByteSize(indexInfo.StoreSize)
+	indexInfo.PriStoreSizeBytes = parseByteSize(indexInfo.PriStoreSize)
+}
+
 func ProcessInterestingIndices(indices []IndexInfo) []InterestingIndexInfo {
 	var interestingIndices []InterestingIndexInfo
 
@@ -98,63 +135,98 @@ func appendObjectsOfInterest(
 	}
 }
 
-func ProcessInterestingInfoAndWordsThreadSafely(
+// what was extracted from a single /<index>/_search response while it was decoded
+type IndexSearchResult struct {
+	// the whole response, but with at most MAX_RETAINED_HITS hits. only has the hits decoded before the cut off if the response was truncated
+	Response         map[string]interface{}
+	InterestingInfo  *InterestingInfoFromIndexSearch
+	InterestingWords []string
+}
+
+// the number of hits of a _search response kept in indicesInfoInJson.
+// hits after it are only extracted from, and then dropped
+const MAX_RETAINED_HITS = 100
+
+// decodes a _search response, extracting interesting info from each hit as soon as the hit is decoded,
+// so that the response is never held in memory as a whole string. at most MAX_RETAINED_HITS hits are kept in the response.
+// if the response ends in the middle, hits decoded so far are returned along with the error.
+func DecodeIndexSearchResult(body io.Reader) (*IndexSearchResult, error) {
+	interestingInfo := NewInterstingInfoFromIndexSearch()
+	var interestingWords []string
+	// reused for every hit
+	var hitInJson bytes.Buffer
+	hitEncoder := json.NewEncoder(&hitInJson)
+	// keep urls as they are. & would be escaped into \u0026 otherwise
+	hitEncoder.SetEscapeHTML(false)
+	response, err := EPUtils.DecodeJSONObjectStreaming(body, []string{"hits", "hits"}, MAX_RETAINED_HITS, func(hit interface{}) {
+		hitInJson.Reset()
+		if encodeErr := hitEncoder.Encode(hit); encodeErr != nil {
+			return
+		}
+		appendObjectsOfInterest(
+			ProcessInterestingInfoFromIndexSearch(hitInJson.String()),
+			ProcessInterestingWordsFromIndexSearch(hitInJson.String()),
+			interestingInfo,
+			&interestingWords,
+		)
+	})
+	if response == nil {
+		return nil, err
+	}
+	interestingInfo.Emails = EPUtils.Unique(interestingInfo.Emails)
+	interestingInfo.Urls = EPUtils.Unique(interestingInfo.Urls)
+	interestingInfo.PublicIPs = EPUtils.Unique(interestingInfo.PublicIPs)
+	interestingInfo.MoreThanTwoDotsInName = EPUtils.Unique(interestingInfo.MoreThanTwoDotsInName)
+
+	return &IndexSearchResult{
+		Response:         response,
+		InterestingInfo:  interestingInfo,
+		InterestingWords: EPUtils.Unique(interestingWords),
+	}, err
+}
+
+// stores the search result of an index into instanceScanResult.
+// it is called from multiple goroutines, one per index
+func ProcessIndexSearchResultThreadSafely(
 	mu *sync.Mutex,
-	singleInstanceScanResult interface{},
-	indexInfoObjectInJsonString string,
+	instanceScanResult *InstanceScanResult,
+	indexName string,
+	indexSearchResult *IndexSearchResult,
+	isTruncated bool,
 ) {
-	interestingInfoFromIndexSearch := ProcessInterestingInfoFromIndexSearch(indexInfoObjectInJsonString)
-	interestingWordsFromIndexSearch := ProcessInterestingWordsFromIndexSearch(indexInfoObjectInJsonString)
+	// each index is unique
+	// https://stackoverflow.com/questions/45585589/golang-fatal-error-concurrent-map-read-and-map-write/45585833
+	instanceScanResult.IndicesInfo.Store(indexName, indexSearchResult.Response)
 
-	// just bear with me, gopls does not officially support generics yet
 	mu.Lock()
 	defer mu.Unlock()
-	switch scanResult := singleInstanceScanResult.(type) {
-	case *SingleElasticsearchInstanceScanResult:
-		if scanResult.InterestingInfo == nil {
-			scanResult.InterestingInfo = NewInterstingInfoFromIndexSearch()
-		}
-		appendObjectsOfInterest(
-			interestingInfoFromIndexSearch,
-			interestingWordsFromIndexSearch,
-			scanResult.InterestingInfo,
-			&scanResult.InterestingWords,
-		)
-	case *SingleKibanaInstanceScanResult:
-		if scanResult.InterestingInfo == nil {
-			scanResult.InterestingInfo = NewInterstingInfoFromIndexSearch()
-		}
-		appendObjectsOfInterest(
-			interestingInfoFromIndexSearch,
-			interestingWordsFromIndexSearch,
-			scanResult.InterestingInfo,
-			&scanResult.InterestingWords,
-		)
-	default:
-		panic(fmt.Sprintf("unrecognized type of scan result detected: %v\n", scanResult))
+	if instanceScanResult.InterestingInfo == nil {
+		instanceScanResult.InterestingInfo = NewInterstingInfoFromIndexSearch()
+	}
+	appendObjectsOfInterest(
+		indexSearchResult.InterestingInfo,
+		indexSearchResult.InterestingWords,
+		instanceScanResult.InterestingInfo,
+		&instanceScanResult.InterestingWords,
+	)
+	if isTruncated {
+		instanceScanResult.TruncatedIndices = append(instanceScanResult.TruncatedIndices, indexName)
 	}
 }
 
 func CheckOverGBIndexExistence(interestingIndices []InterestingIndexInfo) bool {
-	hasOverGBIndex := false
-
 	for _, indexInfo := range interestingIndices {
-		hasOverGBIndex = strings.HasSuffix(indexInfo.StoreSize, "gb") ||
-			strings.HasSuffix(indexInfo.StoreSize, "tb") ||
-			strings.HasSuffix(indexInfo.StoreSize, "pb") ||
-			strings.HasSuffix(indexInfo.PriStoreSize, "gb") ||
-			strings.HasSuffix(indexInfo.PriStoreSize, "tb") ||
-			strings.HasSuffix(indexInfo.PriStoreSize, "pb")
-
-		if hasOverGBIndex {
-			break
+		for _, bytes := range []*int64{indexInfo.StoreSizeBytes, indexInfo.PriStoreSizeBytes} {
+			if bytes != nil && *bytes >= EPUtils.BYTES_1GB {
+				return true
+			}
 		}
 	}
 
-	return hasOverGBIndex
+	return false
 }
 
-// @todo read from a dictionary file instead
+// built-in lists below can be extended or replaced with -rules. see index-rules.go
 var InterestingWordsLowercase = []string{
 	// "appid",
 	// "appname",
@@ -189,6 +261,7 @@ var UninterstingIndexNamesLowercase = []string{
 	// elasticsearch internal index. useless.
 	".geoip_databases",
 	// hackers create an index like this when they find an open elasticsearch instance. therefore useless.
+	// the ransom note in it is read separately. see ransom-note.go
 	"readme",
 	"read_me",
 	"read__me",
@@ -283,11 +356,10 @@ var UninterstingIndexNamesStartingWith = []string{
 	"ilm-history",
 }
 
-// returns true if an index name is uninteresting, therefore useless to be inspected or stored
+// returns true if an index name is uninteresting, therefore useless to be inspected or stored.
+// decided by the built-in rules above, and the rules file given with -rules if any
 func IsUninterestingIndex(indexName string) bool {
-	return EPUtils.ContainsStartsWith(indexName, UninterstingIndexNamesStartingWith) != -1 ||
-		EPUtils.Contains(indexName, UninterstingIndexNamesLowercase) != -1 ||
-		EPUtils.ContainsExactlyMatchesWith(indexName, UninterestingIfExactlyMatches) != -1
+	return getIndexRules().MatchIndexName(indexName).IsUninteresting
 }
 
 type InterestingInfoFromIndexSearch struct {
@@ -317,17 +389,18 @@ type InterestingWordRegexMatches struct {
 	Word    string   `bson:"word,omitempty" json:"word"`
 }
 
-var InterestingWordsRegexes = func() []*InterestingWordRegex {
+func newInterestingWordsRegexes(interestingWords []string) []*InterestingWordRegex {
 	var regexes []*InterestingWordRegex
 
-	for _, interestingWordLowerCase := range InterestingWordsLowercase {
+	for _, interestingWordLowerCase := range interestingWords {
 		// https://stackoverflow.com/questions/15326421/how-do-i-do-a-case-insensitive-regular-expression-in-go
 		// intended to match things like "transfer: 100 USD"
 		// (?i) = ignore case
 		// ^ = start of the word
 		// (.) = anything except line break
 		// {1,30} = between 1 and 10 times
-		regex := regexp.MustCompile(fmt.Sprintf("(?i)(%s)(.){1,30}", interestingWordLowerCase))
+		// words from -rules may have characters special in regex, like example.com
+		regex := regexp.MustCompile(fmt.Sprintf("(?i)(%s)(.){1,30}", regexp.QuoteMeta(interestingWordLowerCase)))
 		regexes = append(regexes, &InterestingWordRegex{
 			regex: regex,
 			word:  interestingWordLowerCase,
@@ -335,11 +408,11 @@ var InterestingWordsRegexes = func() []*InterestingWordRegex {
 	}
 
 	return regexes
-}()
+}
 
 func ProcessInterestingWordsFromIndexSearch(rawIndexSearchStringResult string) []string {
 	var matches []string
-	for _, interestingWordRegex := range InterestingWordsRegexes {
+	for _, interestingWordRegex := range getInterestingWordsRegexes() {
 		matchesForSingleRegex := EPUtils.Unique(interestingWordRegex.regex.FindAllString(rawIndexSearchStringResult, -1))
 		matches = append(matches, matchesForSingleRegex...)
 	}
@@ -347,55 +420,199 @@ func ProcessInterestingWordsFromIndexSearch(rawIndexSearchStringResult string) [
 	return matches
 }
 
-func AppendScanResultToJSONFileWithNewline(outputFilePath string, marshalledScanResult []byte, mu *sync.Mutex) {
-	// I/O should be thread-safe already, but just be extra safe
-	mu.Lock()
-	defer mu.Unlock()
-	f, err := os.OpenFile(outputFilePath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
-	if err != nil {
-		EPUtils.EPLogger(fmt.Sprintf("Failed to create/open %v for output.\n", outputFilePath))
+const DEFAULT_GRACE_PERIOD_SECS = 30
+
+// setting this number high will likely cause a panic (too many files open) and high memory usage
+// because there could be many indices
+const DEFAULT_INDEX_THREADS = 5
+
+const INDEX_THREADS_FLAG_USAGE = `[OPTIONAL] number of indices requested at the same time from a single instance.
+Total number of requests at the same time can be up to -t times this.`
+
+const GRACE_PERIOD_FLAG_USAGE = `[OPTIONAL] seconds to wait for URLs being scanned to finish after Ctrl+C.
+No new URLs are scanned after Ctrl+C. URLs not finished within this period are discarded.`
+
+const RESUME_FLAG_USAGE = `[OPTIONAL] path to a state file for resuming an interrupted scan.
+Every URL is journaled to this file once its result is written to the output.
+When elasticpwn is run again with the same state file, URLs already in it are skipped
+and new results are appended to the existing output instead of overwriting it.`
+
+// outcomes journaled into a checkpoint file
+const (
+	OUTCOME_INITIALIZED     = "initialized"
+	OUTCOME_NOT_INITIALIZED = "not_initialized"
+)
+
+// -f - reads targets from stdin, and -of - writes results to stdout
+const STDIO_PATH = "-"
+
+const INPUT_FILE_FLAG_USAGE = `[REQUIRED] path to a file with targets: host:port, URLs, CIDR:ports, shodan JSON, masscan -oJ/-oL or nmap XML.
+- reads targets from stdin and scans them as they arrive`
+
+// scanUrls streams the targets given by -f into the scan as they are parsed,
+// so that scanning starts before a long list (or stdin) is read to the end.
+type scanUrls struct {
+	inputFilePath string
+	input         io.ReadCloser
+	// URLs journaled as completed in the checkpoint are skipped. nil if not resuming
+	checkpoint *EPUtils.Checkpoint
+	// number of URLs handed to the scan so far
+	readCount EPUtils.Count32
+	// closed once the whole input is read
+	readDone chan struct{}
+}
+
+// opens the input given by -f. exits if it can't be opened
+func openScanUrls(inputFilePath string, checkpoint *EPUtils.Checkpoint) *scanUrls {
+	urls := &scanUrls{
+		inputFilePath: inputFilePath,
+		checkpoint:    checkpoint,
+		readDone:      make(chan struct{}),
+	}
+	if inputFilePath == STDIO_PATH {
+		EPUtils.EPLogger("Reading targets from stdin\n")
+		urls.input = ioutil.NopCloser(os.Stdin)
+		return urls
 	}
+	EPUtils.EPLogger(fmt.Sprintf("Reading targets from %s\n", inputFilePath))
+	f, err := os.Open(filepath.FromSlash(inputFilePath))
+	EPUtils.ExitOnError(err)
+	urls.input = f
 
-	singleKibanaInstanceScanResultMarshalledWithCommaAndNewline := append(marshalledScanResult, ",\n"...)
-	if _, err := f.Write(singleKibanaInstanceScanResultMarshalledWithCommaAndNewline); err != nil {
-		EPUtils.EPLogger(fmt.Sprintf("Failed to write to %v.\n", outputFilePath))
+	return urls
+}
+
+// reads targets in any format supported by EPUtils.TargetReader in the background.
+// the returned channel is closed when the input ends or ctx is cancelled.
+func (urls *scanUrls) Stream(ctx context.Context) <-chan string {
+	urlsChannel := make(chan string)
+	go func() {
+		defer close(urlsChannel)
+		defer urls.input.Close()
+		skippedCount := 0
+		targetReader := EPUtils.NewTargetReader()
+		err := targetReader.Read(urls.input, func(target EPUtils.Target) error {
+			url := target.String()
+			if urls.checkpoint != nil && urls.checkpoint.IsCompleted(url) {
+				skippedCount++
+				return nil
+			}
+			// counted before it's sent, so that it's never finished before it's read
+			urls.readCount.Inc()
+			select {
+			case <-ctx.Done():
+				urls.readCount.Dec()
+				return ctx.Err()
+			case urlsChannel <- url:
+				return nil
+			}
+		})
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			EPUtils.EPLogger(fmt.Sprintf("Failed to read targets from %s: %v. Scanning only the targets read so far\n", urls.inputFilePath, err))
+		}
+		EPUtils.EPLogger(fmt.Sprintf("Total %d targets detected. %d duplicates and %d invalid lines were dropped\n", int(urls.readCount.Get())+skippedCount, targetReader.Duplicates, targetReader.Invalid))
+		if urls.checkpoint != nil {
+			EPUtils.EPLogger(fmt.Sprintf("Skipped %d URLs already completed in the previous runs\n", skippedCount))
+		}
+		close(urls.readDone)
+	}()
+
+	return urlsChannel
+}
+
+func (urls *scanUrls) isReadDone() bool {
+	select {
+	case <-urls.readDone:
+		return true
+	default:
+		return false
 	}
-	if err := f.Close(); err != nil {
-		EPUtils.EPLogger(fmt.Sprintf("Failed to close i/o from %v.\n", outputFilePath))
+}
+
+// like "3/10 of URLs completed". the total is followed by + while the input is still being read
+func (urls *scanUrls) progress(finishedCount int32) string {
+	if urls.isReadDone() {
+		return fmt.Sprintf("%d/%d of URLs completed\n", finishedCount, urls.readCount.Get())
 	}
+
+	return fmt.Sprintf("%d/%d+ of URLs completed\n", finishedCount, urls.readCount.Get())
 }
 
-func Prepare(
-	inputFilePath string,
-	mongoUrl string,
-	outputMode string,
-	mongoCollectionName string,
-) (urls []string, elasticSearchCollection *mongo.Collection) {
-	urls = strings.Split(EPUtils.ReadUrlsFromFile(inputFilePath), "\n")
-	EPUtils.EPLogger(fmt.Sprintf("Total %d lines of URLs detected\n", len(urls)))
-	if outputMode == "mongo" {
-		mongoClient := EPUtils.InitMongoConnnection(mongoUrl)
-		// @todo customize db/collection name
-		elasticSearchCollection = mongoClient.Database("ep").Collection(mongoCollectionName)
+// logs whether all URLs in the input were scanned
+func (urls *scanUrls) logScanEnd(scheduledCount int) {
+	if !urls.isReadDone() || scheduledCount < int(urls.readCount.Get()) {
+		EPUtils.EPLogger(fmt.Sprintf("Scan interrupted. %d URLs were scanned. The rest of %s was not", scheduledCount, urls.inputFilePath))
+		return
 	}
+	EPUtils.EPLogger("Scan finished")
+}
 
-	return urls, elasticSearchCollection
+// opens the checkpoint file at resumeFilePath. URLs completed in the previous runs are skipped while reading the input.
+// returns nil if resumeFilePath is empty.
+func PrepareResume(resumeFilePath string) *EPUtils.Checkpoint {
+	if resumeFilePath == "" {
+		return nil
+	}
+	checkpoint, err := EPUtils.OpenCheckpoint(resumeFilePath)
+	EPUtils.ExitOnError(err)
+
+	if checkpoint.CompletedCount() > 0 {
+		EPUtils.EPLogger(fmt.Sprintf("Resuming from %v. %d URLs already completed will be skipped\n", resumeFilePath, checkpoint.CompletedCount()))
+	}
+
+	return checkpoint
 }
 
-func InsertSingleScanResultToMongo(
-	collection *mongo.Collection,
-	singleScanResult interface{},
-	rootUrl string,
-) {
-	insertContext, cancelInsert := context.WithTimeout(context.Background(),
-		10*time.Second)
-	insertResult, insertResultErr := collection.InsertOne(insertContext, bson.M{"scanResult": singleScanResult})
-
-	defer cancelInsert()
-	if insertResultErr != nil {
-		EPUtils.EPLogger(fmt.Sprintf("Error while inserting info about %s into MongoDB.", rootUrl))
-		fmt.Println(insertResultErr)
-	} else {
-		EPUtils.EPLogger(fmt.Sprintf("Inserted info about %s into MongoDB Collection. ID: %s", rootUrl, insertResult.InsertedID))
+// journals rootUrl as completed. does nothing if not resuming.
+func markScanCompleted(checkpoint *EPUtils.Checkpoint, rootUrl string, isInitialized bool) {
+	if checkpoint == nil {
+		return
+	}
+	outcome := OUTCOME_NOT_INITIALIZED
+	if isInitialized {
+		outcome = OUTCOME_INITIALIZED
+	}
+	if err := checkpoint.MarkCompleted(rootUrl, outcome); err != nil {
+		EPUtils.EPLogger(fmt.Sprintf("Failed to journal %v into the checkpoint file. It will be scanned again when resumed.", rootUrl))
+	}
+}
+
+// returns false if url must not be scanned, logging why and counting it into outOfScopeCount
+func checkScope(ctx context.Context, httpClient *EPUtils.HTTPClient, url string, outOfScopeCount *EPUtils.Count32) bool {
+	if err := httpClient.CheckScope(ctx, url); err != nil {
+		EPUtils.EPLogger(fmt.Sprintf("Skipping %s: %v", url, err))
+		outOfScopeCount.Inc()
+		return false
+	}
+
+	return true
+}
+
+func logOutOfScopeCount(outOfScopeCount int32) {
+	if outOfScopeCount > 0 {
+		EPUtils.EPLogger(fmt.Sprintf("%d URLs were dropped because they are out of scope (see -scope and -exclude)", outOfScopeCount))
+	}
+}
+
+// returns headers with the Authorization header for url from -creds, and the auth mode used.
+// headers are returned as they are if there are no credentials for url
+func authenticate(ctx context.Context, httpClient *EPUtils.HTTPClient, credentialsFile *EPUtils.CredentialsFile, url string, headers map[string]string) (map[string]string, string) {
+	credentials, err := credentialsFile.Lookup(ctx, httpClient.Resolver(), url)
+	if err != nil {
+		EPUtils.EPLogger(fmt.Sprintf("Scanning %s without credentials: %v", url, err))
+	}
+
+	return credentials.AddTo(headers), credentials.GetMode()
+}
+
+func closeCheckpoint(checkpoint *EPUtils.Checkpoint) {
+	if checkpoint == nil {
+		return
+	}
+	if err := checkpoint.Close(); err != nil {
+		EPUtils.EPLogger("Failed to close the checkpoint file")
 	}
 }
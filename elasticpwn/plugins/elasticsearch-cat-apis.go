@@ -0,0 +1,268 @@
+package EPPlugins
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	EPUtils "github.com/9oelM/elasticpwn/elasticpwn/util"
+)
+
+// rows of _cat API responses. _cat APIs answer every column as a string (or null),
+// so all fields are strings, kept as they were answered.
+// only the default columns are requested, which differ a little between versions.
+// columns an instance does not have are left empty.
+
+// {"alias":".kibana","index":".kibana_1","filter":"-","routing.index":"-","routing.search":"-","is_write_index":"-"}
+type CatAlias struct {
+	Alias         string `bson:"alias,omitempty" json:"alias"`
+	Index         string `bson:"index,omitempty" json:"index"`
+	Filter        string `bson:"filter,omitempty" json:"filter"`
+	RoutingIndex  string `bson:"routing.index,omitempty" json:"routing.index"`
+	RoutingSearch string `bson:"routing.search,omitempty" json:"routing.search"`
+	IsWriteIndex  string `bson:"is_write_index,omitempty" json:"is_write_index"`
+}
+
+// {"shards":"13","disk.indices":"83.2mb","disk.used":"21gb","disk.avail":"133.8gb","disk.total":"154.8gb","disk.percent":"13","host":"10.42.197.128","ip":"10.42.197.128","node":"fde99ab8806e"}
+type CatAllocation struct {
+	Shards      string `bson:"shards,omitempty" json:"shards"`
+	DiskIndices string `bson:"disk.indices,omitempty" json:"disk.indices"`
+	DiskUsed    string `bson:"disk.used,omitempty" json:"disk.used"`
+	DiskAvail   string `bson:"disk.avail,omitempty" json:"disk.avail"`
+	DiskTotal   string `bson:"disk.total,omitempty" json:"disk.total"`
+	DiskPercent string `bson:"disk.percent,omitempty" json:"disk.percent"`
+	Host        string `bson:"host,omitempty" json:"host"`
+	Ip          string `bson:"ip,omitempty" json:"ip"`
+	Node        string `bson:"node,omitempty" json:"node"`
+}
+
+// {"ip":"10.42.197.128","heap.percent":"40","ram.percent":"97","cpu":"3","load_1m":"0.21","load_5m":"0.30","load_15m":"0.33","node.role":"dilm","master":"*","name":"fde99ab8806e"}
+type CatNode struct {
+	Ip          string `bson:"ip,omitempty" json:"ip"`
+	HeapPercent string `bson:"heap.percent,omitempty" json:"heap.percent"`
+	RamPercent  string `bson:"ram.percent,omitempty" json:"ram.percent"`
+	Cpu         string `bson:"cpu,omitempty" json:"cpu"`
+	Load1m      string `bson:"load_1m,omitempty" json:"load_1m"`
+	Load5m      string `bson:"load_5m,omitempty" json:"load_5m"`
+	Load15m     string `bson:"load_15m,omitempty" json:"load_15m"`
+	NodeRole    string `bson:"node.role,omitempty" json:"node.role"`
+	// * for the elected master
+	Master string `bson:"master,omitempty" json:"master"`
+	// Master of opensearch 2.0 and later
+	ClusterManager string `bson:"cluster_manager,omitempty" json:"cluster_manager,omitempty"`
+	Name           string `bson:"name,omitempty" json:"name"`
+}
+
+// the number of documents in all indices. a single row
+type CatCount struct {
+	Epoch     string `bson:"epoch,omitempty" json:"epoch"`
+	Timestamp string `bson:"timestamp,omitempty" json:"timestamp"`
+	Count     string `bson:"count,omitempty" json:"count"`
+}
+
+// the elected master node. a single row
+type CatMaster struct {
+	Id   string `bson:"id,omitempty" json:"id"`
+	Host string `bson:"host,omitempty" json:"host"`
+	Ip   string `bson:"ip,omitempty" json:"ip"`
+	Node string `bson:"node,omitempty" json:"node"`
+}
+
+// custom attributes of nodes, like the availability zone or the rack
+type CatNodeAttr struct {
+	Node  string `bson:"node,omitempty" json:"node"`
+	Host  string `bson:"host,omitempty" json:"host"`
+	Ip    string `bson:"ip,omitempty" json:"ip"`
+	Attr  string `bson:"attr,omitempty" json:"attr"`
+	Value string `bson:"value,omitempty" json:"value"`
+}
+
+type CatPendingTask struct {
+	InsertOrder string `bson:"insertOrder,omitempty" json:"insertOrder"`
+	TimeInQueue string `bson:"timeInQueue,omitempty" json:"timeInQueue"`
+	Priority    string `bson:"priority,omitempty" json:"priority"`
+	Source      string `bson:"source,omitempty" json:"source"`
+}
+
+// {"name":"fde99ab8806e","component":"repository-s3","version":"7.10.2"}
+type CatPlugin struct {
+	Name      string `bson:"name,omitempty" json:"name"`
+	Component string `bson:"component,omitempty" json:"component"`
+	Version   string `bson:"version,omitempty" json:"version"`
+}
+
+// {"action":"cluster:monitor/nodes/stats","task_id":"_-IU2jWcQsaT0XsJCga1mg:8439865","parent_task_id":"-","type":"transport","start_time":"1635165293843","timestamp":"12:34:53","running_time":"3.4ms","ip":"10.42.197.128","node":"fde99ab8806e"}
+type CatTask struct {
+	Action       string `bson:"action,omitempty" json:"action"`
+	TaskId       string `bson:"task_id,omitempty" json:"task_id"`
+	ParentTaskId string `bson:"parent_task_id,omitempty" json:"parent_task_id"`
+	Type         string `bson:"type,omitempty" json:"type"`
+	StartTime    string `bson:"start_time,omitempty" json:"start_time"`
+	Timestamp    string `bson:"timestamp,omitempty" json:"timestamp"`
+	RunningTime  string `bson:"running_time,omitempty" json:"running_time"`
+	Ip           string `bson:"ip,omitempty" json:"ip"`
+	Node         string `bson:"node,omitempty" json:"node"`
+}
+
+type CatTrainedModel struct {
+	Id              string `bson:"id,omitempty" json:"id"`
+	HeapSize        string `bson:"heap_size,omitempty" json:"heap_size"`
+	Operations      string `bson:"operations,omitempty" json:"operations"`
+	CreateTime      string `bson:"create_time,omitempty" json:"create_time"`
+	IngestPipelines string `bson:"ingest.pipelines,omitempty" json:"ingest.pipelines"`
+	DataFrameId     string `bson:"data_frame.id,omitempty" json:"data_frame.id"`
+}
+
+type CatTransform struct {
+	Id                       string `bson:"id,omitempty" json:"id"`
+	State                    string `bson:"state,omitempty" json:"state"`
+	Checkpoint               string `bson:"checkpoint,omitempty" json:"checkpoint"`
+	DocumentsProcessed       string `bson:"documents_processed,omitempty" json:"documents_processed"`
+	CheckpointProgress       string `bson:"checkpoint_progress,omitempty" json:"checkpoint_progress"`
+	LastSearchTime           string `bson:"last_search_time,omitempty" json:"last_search_time"`
+	ChangesLastDetectionTime string `bson:"changes_last_detection_time,omitempty" json:"changes_last_detection_time"`
+}
+
+// catApi is a _cat API that can be collected from an instance, selected by its name in -apis
+type catApi struct {
+	// name in -apis
+	name string
+	path string
+	// appended to the query string after format=json or v
+	extraQueryString string
+	// the first version of elasticsearch that has it
+	sinceMajor int
+	sinceMinor int
+	// only elasticsearch with x-pack has it. opensearch never does
+	isXpack bool
+	// unmarshals a response (always JSON by now) into the field of the result it is stored in
+	parse func(resp []byte, singleElasticsearchInstanceScanResult *SingleElasticsearchInstanceScanResult) error
+}
+
+// all _cat APIs that can be collected, in the order they are listed in -apis
+var catApis = []*catApi{
+	{
+		name: "indices", path: API_INDICES,
+		// just make sure you requeset all indices
+		extraQueryString: "&size=1000",
+		parse: func(resp []byte, singleElasticsearchInstanceScanResult *SingleElasticsearchInstanceScanResult) error {
+			var rows []IndexInfo
+			if err := json.Unmarshal(resp, &rows); err != nil {
+				return err
+			}
+			singleElasticsearchInstanceScanResult.setIndices(rows, singleElasticsearchInstanceScanResult.ClusterInfo)
+			return nil
+		},
+	},
+	{
+		name: "aliases", path: API_ALIASES,
+		parse: func(resp []byte, singleElasticsearchInstanceScanResult *SingleElasticsearchInstanceScanResult) error {
+			return json.Unmarshal(resp, &singleElasticsearchInstanceScanResult.Aliases)
+		},
+	},
+	{
+		name: "allocation", path: API_ALLOCATIONS,
+		parse: func(resp []byte, singleElasticsearchInstanceScanResult *SingleElasticsearchInstanceScanResult) error {
+			return json.Unmarshal(resp, &singleElasticsearchInstanceScanResult.Allocations)
+		},
+	},
+	{
+		name: "nodes", path: API_NODES,
+		parse: func(resp []byte, singleElasticsearchInstanceScanResult *SingleElasticsearchInstanceScanResult) error {
+			return json.Unmarshal(resp, &singleElasticsearchInstanceScanResult.Nodes)
+		},
+	},
+	{
+		name: "count", path: API_COUNT,
+		parse: func(resp []byte, singleElasticsearchInstanceScanResult *SingleElasticsearchInstanceScanResult) error {
+			return json.Unmarshal(resp, &singleElasticsearchInstanceScanResult.Count)
+		},
+	},
+	{
+		name: "master", path: API_MASTER,
+		parse: func(resp []byte, singleElasticsearchInstanceScanResult *SingleElasticsearchInstanceScanResult) error {
+			return json.Unmarshal(resp, &singleElasticsearchInstanceScanResult.Master)
+		},
+	},
+	{
+		name: "nodeattrs", path: API_NODE_ATTRS, sinceMajor: 2,
+		parse: func(resp []byte, singleElasticsearchInstanceScanResult *SingleElasticsearchInstanceScanResult) error {
+			return json.Unmarshal(resp, &singleElasticsearchInstanceScanResult.NodeAttrs)
+		},
+	},
+	{
+		name: "pending_tasks", path: API_PENDING_TASKS,
+		parse: func(resp []byte, singleElasticsearchInstanceScanResult *SingleElasticsearchInstanceScanResult) error {
+			return json.Unmarshal(resp, &singleElasticsearchInstanceScanResult.PendingTasks)
+		},
+	},
+	{
+		name: "plugins", path: API_PLUGINS,
+		parse: func(resp []byte, singleElasticsearchInstanceScanResult *SingleElasticsearchInstanceScanResult) error {
+			return json.Unmarshal(resp, &singleElasticsearchInstanceScanResult.Plugins)
+		},
+	},
+	{
+		name: "tasks", path: API_TASKS, sinceMajor: 5,
+		parse: func(resp []byte, singleElasticsearchInstanceScanResult *SingleElasticsearchInstanceScanResult) error {
+			return json.Unmarshal(resp, &singleElasticsearchInstanceScanResult.Tasks)
+		},
+	},
+	{
+		name: "trained_models", path: API_TRAINED_MODELS, sinceMajor: 7, sinceMinor: 7, isXpack: true,
+		parse: func(resp []byte, singleElasticsearchInstanceScanResult *SingleElasticsearchInstanceScanResult) error {
+			return json.Unmarshal(resp, &singleElasticsearchInstanceScanResult.TrainedModels)
+		},
+	},
+	{
+		name: "transforms", path: API_TRANSFORMS, sinceMajor: 7, sinceMinor: 7, isXpack: true,
+		parse: func(resp []byte, singleElasticsearchInstanceScanResult *SingleElasticsearchInstanceScanResult) error {
+			return json.Unmarshal(resp, &singleElasticsearchInstanceScanResult.Transforms)
+		},
+	},
+}
+
+// indices is collected even if left out, because the indices to search are chosen from it
+const CAT_API_ALWAYS_COLLECTED = "indices"
+
+const DEFAULT_CAT_APIS = "indices,aliases,allocation,nodes"
+
+var CAT_APIS_FLAG_USAGE = fmt.Sprintf(`[OPTIONAL] _cat APIs to collect from each instance, separated by commas, or all.
+Possible values: %v.
+%v is always collected.`, strings.Join(catApiNames(), ","), CAT_API_ALWAYS_COLLECTED)
+
+func catApiNames() []string {
+	var names []string
+	for _, api := range catApis {
+		names = append(names, api.name)
+	}
+
+	return names
+}
+
+// parses -apis into the APIs to collect, in the order of catApis
+func selectCatApis(apisFlag string) ([]*catApi, error) {
+	names := []string{CAT_API_ALWAYS_COLLECTED}
+	if strings.TrimSpace(apisFlag) == "all" {
+		names = catApiNames()
+	}
+	for _, name := range strings.Split(apisFlag, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" || name == "all" {
+			continue
+		}
+		if EPUtils.ContainsExactlyMatchesWith(name, catApiNames()) == -1 {
+			return nil, fmt.Errorf("unknown _cat API %v in -apis. Possible values: %v", name, strings.Join(catApiNames(), ","))
+		}
+		names = append(names, name)
+	}
+
+	var selectedCatApis []*catApi
+	for _, api := range catApis {
+		if EPUtils.ContainsExactlyMatchesWith(api.name, names) != -1 {
+			selectedCatApis = append(selectedCatApis, api)
+		}
+	}
+
+	return selectedCatApis, nil
+}
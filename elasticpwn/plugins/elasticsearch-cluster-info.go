@@ -0,0 +1,175 @@
+package EPPlugins
+
+import (
+	"encoding/json"
+	"strings"
+
+	EPUtils "github.com/9oelM/elasticpwn/elasticpwn/util"
+)
+
+// values of ClusterInfo.Distribution
+const (
+	DISTRIBUTION_ELASTICSEARCH = "elasticsearch"
+	DISTRIBUTION_OPENSEARCH    = "opensearch"
+)
+
+// opensearch answers with this tagline at its root URL, even in the compatibility mode that hides its distribution
+const OPENSEARCH_TAGLINE = "the opensearch project"
+
+// the compatibility mode that hides the distribution was removed in opensearch 2.0,
+// so an opensearch cluster hiding its distribution is assumed to be the last version of 1.x
+var OPENSEARCH_WITH_COMPATIBILITY_MODE_VERSION = EPUtils.Version{Major: 1, Minor: 3}
+
+// opensearch forked from elasticsearch 7.10.2 and kept its APIs,
+// so it is treated as this version of elasticsearch when choosing APIs
+var OPENSEARCH_COMPATIBLE_ELASTICSEARCH_VERSION = EPUtils.Version{Major: 7, Minor: 10, Patch: 2}
+
+// ClusterInfo is what an elasticsearch (or opensearch) instance tells about itself at its root URL.
+//
+//	{
+//	  "name" : "fde99ab8806e",
+//	  "cluster_name" : "docker-cluster",
+//	  "cluster_uuid" : "Jm1Zc8J1QDyYVlqSJuIzJw",
+//	  "version" : {
+//	    "number" : "7.10.2",
+//	    "build_flavor" : "default",
+//	    ...
+//	  },
+//	  "tagline" : "You Know, for Search"
+//	}
+type ClusterInfo struct {
+	VersionNumber string `bson:"versionNumber,omitempty" json:"versionNumber"`
+	// elasticsearch or opensearch. elasticsearch does not report it, so it is elasticsearch unless told otherwise
+	Distribution string `bson:"distribution,omitempty" json:"distribution"`
+	// default or oss. only reported by elasticsearch 6.3 to 7.10, when both flavors were released
+	BuildFlavor string `bson:"buildFlavor,omitempty" json:"buildFlavor"`
+	ClusterName string `bson:"clusterName,omitempty" json:"clusterName"`
+	ClusterUuid string `bson:"clusterUuid,omitempty" json:"clusterUuid"`
+	Tagline     string `bson:"tagline,omitempty" json:"tagline"`
+	// name of the node that answered. honeypots give themselves away with it
+	NodeName string `bson:"nodeName,omitempty" json:"nodeName"`
+
+	// parsed from VersionNumber. nil if it could not be parsed
+	version *EPUtils.Version
+}
+
+type elasticsearchRootResponse struct {
+	Name        string `json:"name"`
+	ClusterName string `json:"cluster_name"`
+	ClusterUuid string `json:"cluster_uuid"`
+	Version     struct {
+		Number       string `json:"number"`
+		Distribution string `json:"distribution"`
+		BuildFlavor  string `json:"build_flavor"`
+	} `json:"version"`
+	Tagline string `json:"tagline"`
+}
+
+// returns nil if the response does not look like one from the root URL of elasticsearch
+func ParseClusterInfo(rootResponse string) *ClusterInfo {
+	var response elasticsearchRootResponse
+	if err := json.Unmarshal([]byte(rootResponse), &response); err != nil || response.Version.Number == "" {
+		return nil
+	}
+	clusterInfo := &ClusterInfo{
+		VersionNumber: response.Version.Number,
+		Distribution:  strings.ToLower(response.Version.Distribution),
+		BuildFlavor:   response.Version.BuildFlavor,
+		ClusterName:   response.ClusterName,
+		ClusterUuid:   response.ClusterUuid,
+		Tagline:       response.Tagline,
+		NodeName:      response.Name,
+	}
+	if clusterInfo.Distribution == "" {
+		clusterInfo.Distribution = DISTRIBUTION_ELASTICSEARCH
+	}
+	if version, err := EPUtils.ParseVersion(response.Version.Number); err == nil {
+		clusterInfo.version = &version
+	}
+
+	return clusterInfo
+}
+
+// whether the instance is opensearch, even if it hides its distribution with compatibility.override_main_response_version.
+// then it still has the tagline of opensearch, or claims to be elasticsearch 7.10.2 without build_flavor, which every elasticsearch 7.10.2 reports
+func (clusterInfo *ClusterInfo) IsOpenSearch() bool {
+	if clusterInfo == nil {
+		return false
+	}
+
+	return clusterInfo.Distribution == DISTRIBUTION_OPENSEARCH ||
+		strings.HasPrefix(strings.ToLower(clusterInfo.Tagline), OPENSEARCH_TAGLINE) ||
+		(clusterInfo.VersionNumber == OPENSEARCH_COMPATIBLE_ELASTICSEARCH_VERSION.String() && clusterInfo.BuildFlavor == "")
+}
+
+// compares the version of elasticsearch the instance is compatible with to major.minor.
+// an instance of an unknown version is assumed to be recent, since most of the exposed instances are.
+func (clusterInfo *ClusterInfo) IsAtLeast(major int, minor int) bool {
+	if clusterInfo == nil || clusterInfo.version == nil {
+		return true
+	}
+	if clusterInfo.IsOpenSearch() {
+		return OPENSEARCH_COMPATIBLE_ELASTICSEARCH_VERSION.IsAtLeast(major, minor)
+	}
+
+	return clusterInfo.version.IsAtLeast(major, minor)
+}
+
+// compares the version of opensearch itself to major.minor. always false for elasticsearch
+func (clusterInfo *ClusterInfo) IsOpenSearchAtLeast(major int, minor int) bool {
+	if !clusterInfo.IsOpenSearch() {
+		return false
+	}
+	// VersionNumber is the one of elasticsearch it pretends to be
+	if clusterInfo.Distribution != DISTRIBUTION_OPENSEARCH {
+		return OPENSEARCH_WITH_COMPATIBILITY_MODE_VERSION.IsAtLeast(major, minor)
+	}
+	if clusterInfo.version == nil {
+		return true
+	}
+
+	return clusterInfo.version.IsAtLeast(major, minor)
+}
+
+// returns the path to request api at on this instance,
+// and false if the instance does not have it at all
+func (clusterInfo *ClusterInfo) catEndpoint(api *catApi) (string, bool) {
+	if !clusterInfo.IsAtLeast(api.sinceMajor, api.sinceMinor) {
+		return "", false
+	}
+	if !clusterInfo.IsOpenSearch() {
+		return api.path, true
+	}
+	// x-pack is not a part of opensearch
+	if api.isXpack {
+		return "", false
+	}
+	// opensearch 2.0 renamed master to cluster_manager, and deprecated the old name
+	if api.path == API_MASTER && clusterInfo.IsOpenSearchAtLeast(2, 0) {
+		return API_CLUSTER_MANAGER, true
+	}
+
+	return api.path, true
+}
+
+// _cat APIs answer in JSON only since 5.0. older versions need ?v to print the column names
+func (clusterInfo *ClusterInfo) catQueryString() string {
+	if clusterInfo.IsAtLeast(5, 0) {
+		return Q_FORMAT_JSON
+	}
+
+	return Q_VERBOSE
+}
+
+// turns a _cat response into JSON if it was requested as a plain text table
+func (clusterInfo *ClusterInfo) normalizeCatResponse(resp string) string {
+	if clusterInfo.IsAtLeast(5, 0) {
+		return resp
+	}
+	rows, err := json.Marshal(EPUtils.ParseCatTable(resp))
+	if err != nil {
+		return resp
+	}
+
+	return string(rows)
+}
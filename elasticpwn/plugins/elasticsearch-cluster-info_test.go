@@ -0,0 +1,28 @@
+package EPPlugins
+
+import "testing"
+
+func TestClusterInfoIsOpenSearch(t *testing.T) {
+	cases := map[string]bool{
+		`{"version": {"distribution": "opensearch", "number": "2.11.0"}, "tagline": "The OpenSearch Project: https://opensearch.org/"}`: true,
+		// compatibility.override_main_response_version of opensearch 1.x
+		`{"version": {"number": "7.10.2"}, "tagline": "The OpenSearch Project: https://opensearch.org/"}`: true,
+		`{"version": {"number": "7.10.2"}, "tagline": "You Know, for Search"}`:                            true,
+		`{"version": {"number": "7.10.2", "build_flavor": "default"}, "tagline": "You Know, for Search"}`: false,
+		`{"version": {"number": "8.12.0", "build_flavor": "default"}, "tagline": "You Know, for Search"}`: false,
+	}
+	for rootResponse, expectedOpenSearch := range cases {
+		clusterInfo := ParseClusterInfo(rootResponse)
+		if clusterInfo.IsOpenSearch() != expectedOpenSearch {
+			t.Errorf("%v: expected opensearch: %v", rootResponse, expectedOpenSearch)
+		}
+	}
+
+	hidden := ParseClusterInfo(`{"version": {"number": "7.10.2"}, "tagline": "The OpenSearch Project: https://opensearch.org/"}`)
+	if hidden.IsOpenSearchAtLeast(2, 0) {
+		t.Errorf("expected opensearch hiding its distribution not to be taken as 2.0, since 7.10.2 is not its own version")
+	}
+	if hasXPack(DISTRIBUTION_ELASTICSEARCH, hidden) {
+		t.Errorf("expected x-pack not to be probed on opensearch hiding its distribution")
+	}
+}
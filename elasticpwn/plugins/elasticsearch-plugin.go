@@ -1,16 +1,15 @@
 package EPPlugins
 
 import (
-	"encoding/json"
+	"context"
+	"flag"
 	"fmt"
+	"io"
 	"strings"
 	"sync"
 	"time"
 
 	EPUtils "github.com/9oelM/elasticpwn/elasticpwn/util"
-
-	"go.mongodb.org/mongo-driver/bson/primitive"
-	"go.mongodb.org/mongo-driver/mongo"
 )
 
 type ElasticSearchPlugin struct {
@@ -21,24 +20,184 @@ type ElasticSearchPlugin struct {
 	MongoUrl             string
 	EsPluginMaxIndices   int
 	EsPluginMaxIndexSize int
+	// number of indices of a single instance requested concurrently
+	IndexThreadsNum int
+	// seconds to wait for in-flight hosts to finish after interruption
+	GracePeriod int
+	// path to a checkpoint file. empty if not resuming
+	ResumeFilePath string
+	// path to a rules file. empty if only the built-in rules are used
+	RulesFilePath string
+	// names of _cat APIs to collect, separated by commas. see catApis
+	CatApis string
+	HTTPClientFlags
+	IndexSizeFlags
+
+	checkpoint *EPUtils.Checkpoint
+	httpClient *EPUtils.HTTPClient
+	// nil if -creds is not set
+	credentials *EPUtils.CredentialsFile
+
+	urls        *scanUrls
+	outputSinks OutputSinks
+	// parsed from CatApis
+	catApis []*catApi
+
+	// elasticsearch, or the name of a plugin built on top of this one, like opensearch.
+	// used as the name of the plugin, the product of results and the collection name
+	product string
+	// scans a single URL. scanSingleElasticsearchInstance unless a plugin built on top of this one replaces it
+	scanInstance func(ctx context.Context, url string) ScanResult
+}
+
+func init() {
+	RegisterPlugin(newElasticSearchPlugin("elasticsearch"))
+}
+
+func newElasticSearchPlugin(product string) *ElasticSearchPlugin {
+	elasticSearchPlugin := &ElasticSearchPlugin{product: product}
+	elasticSearchPlugin.scanInstance = func(ctx context.Context, url string) ScanResult {
+		return elasticSearchPlugin.scanSingleElasticsearchInstance(ctx, url)
+	}
+
+	return elasticSearchPlugin
+}
+
+func (elasticSearchPlugin *ElasticSearchPlugin) Name() string {
+	return elasticSearchPlugin.product
+}
+
+func (elasticSearchPlugin *ElasticSearchPlugin) Example() string {
+	return fmt.Sprintf("elasticpwn %s -t=40 -om=json -f=urls.txt", elasticSearchPlugin.Name())
+}
+
+func (elasticSearchPlugin *ElasticSearchPlugin) DefineFlags(fs *flag.FlagSet) {
+	fs.StringVar(&elasticSearchPlugin.InputFilePath, "f", "", INPUT_FILE_FLAG_USAGE)
+	fs.IntVar(&elasticSearchPlugin.ThreadsNum, "t", 8, "[OPTIONAL] number of threads when running a plugin")
+	fs.StringVar(&elasticSearchPlugin.OutputMode, "om", "json", `[OPTIONAL] output mode. json|jsonl|mongo|plain|sqlite. 
+Multiple modes can be separated by commas, like json,mongo.
+mongo option will require a mongo server to be up.
+jsonl mode will output a JSON object per line, which stays valid even if the scan crashes.
+plain mode will output json-like object to each line finishing with a comma. 
+sqlite mode will write normalized tables (instances, indices, extracted_values, ...) into the sqlite database given by -of.
+For mongo, Local docker mongo instance is recommneded. (check docker-compose.yml and docs)`)
+	fs.StringVar(&elasticSearchPlugin.OutputFilePath, "of", elasticSearchPlugin.defaultOutputFilePath(), "[OPTIONAL] output file name. Ignored when mongo is the only output mode chosen.\n- writes results to stdout (jsonl and plain only), and logs to stderr.")
+	fs.StringVar(&elasticSearchPlugin.MongoUrl, "murl", DEFAULT_MONGO_URL, `[OPTIONAL] needed only when -o=mongo is selected. 
+mongodb url with username and pw included.
+Note that 172.17.0.1 is usually default docker host IP. You may want to change this.
+`)
+	// some instances have very many indices, and probably your hard drive will explode if you fetch all
+	fs.IntVar(&elasticSearchPlugin.EsPluginMaxIndices, "max-i", 5, `maximum number of indices to request. 
+Indices with the highest scores are requested first. See scoreReason of each index for why.
+If you intend to set this as a high number, make sure you've got enough storage. 
+If you don't know what an index is, 
+refer to elasticserach docs at https://www.elastic.co/blog/what-is-an-elasticsearch-index`)
+	// will return 'X' hits from the index
+	fs.IntVar(&elasticSearchPlugin.EsPluginMaxIndexSize, "max-is", 70, `maximum size of an index to request. 
+If you intend to set this as a high number, make sure you've got enough storage.
+If you don't know what 'size' is,
+please refer to elasticsearch docs on
+'<endpoint>/_cat/_search?size=' at 
+https://www.elastic.co/guide/en/elasticsearch/reference/current/search-search.html`)
+	fs.IntVar(&elasticSearchPlugin.IndexThreadsNum, "index-t", DEFAULT_INDEX_THREADS, INDEX_THREADS_FLAG_USAGE)
+	fs.IntVar(&elasticSearchPlugin.GracePeriod, "grace", DEFAULT_GRACE_PERIOD_SECS, GRACE_PERIOD_FLAG_USAGE)
+	fs.StringVar(&elasticSearchPlugin.ResumeFilePath, "resume", "", RESUME_FLAG_USAGE)
+	fs.StringVar(&elasticSearchPlugin.RulesFilePath, "rules", "", RULES_FLAG_USAGE)
+	fs.StringVar(&elasticSearchPlugin.CatApis, "apis", DEFAULT_CAT_APIS, CAT_APIS_FLAG_USAGE)
+	elasticSearchPlugin.HTTPClientFlags.DefineFlags(fs)
+	elasticSearchPlugin.IndexSizeFlags.DefineFlags(fs)
+}
+
+// elasticsearch.json, opensearch.json, ...
+func (elasticSearchPlugin *ElasticSearchPlugin) defaultOutputFilePath() string {
+	return fmt.Sprintf("%s.json", elasticSearchPlugin.Name())
+}
+
+func (elasticSearchPlugin *ElasticSearchPlugin) Validate() bool {
+	logToStderrIfOutputIsStdout(elasticSearchPlugin.OutputFilePath)
+	needsExit := EPUtils.ValidateStringFlag(
+		elasticSearchPlugin.InputFilePath,
+		"",
+		"-f",
+	) ||
+		EPUtils.ValidatePositiveInt(
+			elasticSearchPlugin.ThreadsNum,
+			"-t",
+		) ||
+		EPUtils.ValidatePositiveInt(
+			elasticSearchPlugin.EsPluginMaxIndexSize,
+			"-max-is",
+		) ||
+		EPUtils.ValidatePositiveInt(
+			elasticSearchPlugin.EsPluginMaxIndices,
+			"-max-i",
+		) ||
+		EPUtils.ValidatePositiveInt(
+			elasticSearchPlugin.IndexThreadsNum,
+			"-index-t",
+		) ||
+		EPUtils.ValidatePositiveInt(
+			elasticSearchPlugin.GracePeriod,
+			"-grace",
+		) ||
+		elasticSearchPlugin.HTTPClientFlags.Validate() ||
+		elasticSearchPlugin.IndexSizeFlags.Validate() ||
+		validateRulesFile(elasticSearchPlugin.RulesFilePath)
+	if _, err := selectCatApis(elasticSearchPlugin.CatApis); err != nil {
+		EPUtils.EPLogger(err.Error())
+		needsExit = true
+	}
+
+	return ValidateOutputFlags(
+		elasticSearchPlugin.OutputMode,
+		elasticSearchPlugin.OutputFilePath,
+		elasticSearchPlugin.defaultOutputFilePath(),
+		elasticSearchPlugin.MongoUrl,
+	) || needsExit
+}
+
+func (elasticSearchPlugin *ElasticSearchPlugin) Prepare() {
+	elasticSearchPlugin.checkpoint = PrepareResume(elasticSearchPlugin.ResumeFilePath)
+	EPUtils.ExitOnError(useRulesFile(elasticSearchPlugin.RulesFilePath))
+	catApis, err := selectCatApis(elasticSearchPlugin.CatApis)
+	EPUtils.ExitOnError(err)
+	elasticSearchPlugin.catApis = catApis
+	elasticSearchPlugin.urls = openScanUrls(elasticSearchPlugin.InputFilePath, elasticSearchPlugin.checkpoint)
+	httpClient, err := elasticSearchPlugin.HTTPClientFlags.NewHTTPClient()
+	EPUtils.ExitOnError(err)
+	elasticSearchPlugin.httpClient = httpClient
+	elasticSearchPlugin.credentials, err = elasticSearchPlugin.HTTPClientFlags.LoadCredentials()
+	EPUtils.ExitOnError(err)
+	outputSinks, err := NewOutputSinks(OutputSinkOptions{
+		OutputMode:     elasticSearchPlugin.OutputMode,
+		OutputFilePath: elasticSearchPlugin.OutputFilePath,
+		MongoUrl:       elasticSearchPlugin.MongoUrl,
+		CollectionName: elasticSearchPlugin.Name(),
+	})
+	EPUtils.ExitOnError(err)
+	EPUtils.ExitOnError(outputSinks.Open())
+	elasticSearchPlugin.outputSinks = outputSinks
 }
 
 // all jsons but in a stringified form
 type SingleElasticsearchInstanceScanResult struct {
-	Id          primitive.ObjectID     `bson:"_id,omitempty" json:"_id"`
-	RootUrl     string                 `bson:"rootUrl,omitempty" json:"rootUrl"`
-	Indices     []InterestingIndexInfo `bson:"indices,omitempty" json:"indices"`
-	IndicesInfo sync.Map               `bson:"indicesInfo,omitempty" json:"indicesInfo"`
-	// sync.Map can't be (un)marshalled
-	IndicesInfoInJson            map[string]interface{}          `bson:"indicesInfoInJson,omitempty" json:"indicesInfoInJson"`
-	InterestingWords             []string                        `bson:"interestingWords,omitempty" json:"interestingWords"`
-	InterestingInfo              *InterestingInfoFromIndexSearch `bson:"interestingInfo,omitempty" json:"interestingInfo"`
-	HasAtLeastOneIndexSizeOverGB bool                            `bson:"hasAtLeastOneIndexSizeOverGB,omitempty" json:"hasAtLeastOneIndexSizeOverGB"`
-	Aliases                      []interface{}                   `bson:"aliases,omitempty" json:"aliases"`
-	Allocations                  []interface{}                   `bson:"allocations,omitempty" json:"allocations"`
-	Nodes                        []interface{}                   `bson:"nodes,omitempty" json:"nodes"`
-	CreatedAt                    time.Time                       `bson:"created_at" json:"created_at"`
-	IsInitialized                bool                            `bson:"isInitialized,omitempty" json:"isInitialized"`
+	InstanceScanResult `bson:",inline"`
+	// nil if the root URL did not answer like elasticsearch
+	ClusterInfo *ClusterInfo `bson:"clusterInfo,omitempty" json:"clusterInfo"`
+	// nil for opensearch
+	SecurityPosture *SecurityPosture `bson:"securityPosture,omitempty" json:"securityPosture"`
+	// responses of the _cat APIs selected by -apis. see catApis
+	Aliases       []CatAlias        `bson:"aliases,omitempty" json:"aliases"`
+	Allocations   []CatAllocation   `bson:"allocations,omitempty" json:"allocations"`
+	Nodes         []CatNode         `bson:"nodes,omitempty" json:"nodes"`
+	Count         []CatCount        `bson:"count,omitempty" json:"count"`
+	Master        []CatMaster       `bson:"master,omitempty" json:"master"`
+	NodeAttrs     []CatNodeAttr     `bson:"nodeAttrs,omitempty" json:"nodeAttrs"`
+	PendingTasks  []CatPendingTask  `bson:"pendingTasks,omitempty" json:"pendingTasks"`
+	Plugins       []CatPlugin       `bson:"plugins,omitempty" json:"plugins"`
+	Tasks         []CatTask         `bson:"tasks,omitempty" json:"tasks"`
+	TrainedModels []CatTrainedModel `bson:"trainedModels,omitempty" json:"trainedModels"`
+	Transforms    []CatTransform    `bson:"transforms,omitempty" json:"transforms"`
 }
 
 const (
@@ -48,7 +207,7 @@ const (
 	API_NODES       = "/_cat/nodes"
 	API_SEARCH      = "/_search"
 
-	// unused for now because they usually contain quite useless info from a security perspective
+	// not collected unless selected with -apis, because they usually contain quite useless info from a security perspective
 	API_COUNT          = "/_cat/count"
 	API_MASTER         = "/_cat/master"
 	API_NODE_ATTRS     = "/_cat/nodeattrs"
@@ -57,10 +216,13 @@ const (
 	API_TASKS          = "/_cat/tasks"
 	API_TRAINED_MODELS = "/_cat/ml/trained_models"
 	API_TRANSFORMS     = "/_cat/transforms"
+	// API_MASTER of opensearch 2.0 and later
+	API_CLUSTER_MANAGER = "/_cat/cluster_manager"
 )
 
 const (
 	Q_FORMAT_JSON = "format=json"
+	Q_VERBOSE     = "v"
 	Q_SIZE_X      = "size={INDEX_SIZE}"
 )
 
@@ -69,62 +231,23 @@ var Q_SIZE_X_FORMAT_JSON = fmt.Sprintf(strings.Join([]string{
 	Q_SIZE_X,
 }, "&"))
 
-// any better way?
-func elasticSearchResultSwitch(singleElasticsearchInstanceScanResult *SingleElasticsearchInstanceScanResult, endpoint string, resp string) {
-	if strings.Contains(endpoint, API_INDICES) {
-		var jsonArrayResponse []IndexInfo
-		jsonUnmarshalErr := json.Unmarshal([]byte(resp), &jsonArrayResponse)
-
-		if jsonUnmarshalErr != nil {
-			EPUtils.EPLogger(fmt.Sprintf("Error while unmarshalling %s", resp))
-			return
-		}
-		singleElasticsearchInstanceScanResult.Indices = ProcessInterestingIndices(jsonArrayResponse)
-
-		return
-	}
-
-	var jsonArrayResponse []interface{}
-	jsonUnmarshalErr := json.Unmarshal([]byte(resp), &jsonArrayResponse)
-
-	if jsonUnmarshalErr != nil {
-		EPUtils.EPLogger(fmt.Sprintf("Error while unmarshalling %s", resp))
-	}
-
-	if jsonUnmarshalErr != nil {
-		return
-	}
-	// []interface{}
-
-	switch {
-	case strings.Contains(endpoint, API_ALIASES):
-		{
-			singleElasticsearchInstanceScanResult.Aliases = jsonArrayResponse
-		}
-	case strings.Contains(endpoint, API_ALLOCATIONS):
-		{
-			singleElasticsearchInstanceScanResult.Allocations = jsonArrayResponse
-		}
-	case strings.Contains(endpoint, API_NODES):
-		{
-			singleElasticsearchInstanceScanResult.Nodes = jsonArrayResponse
-		}
-	}
-}
+// the length of a response that failed to be parsed to log, because it may be megabytes of _cat/indices
+const MAX_LOGGED_RESPONSE_LEN = 200
 
-func (elasticSearchPlugin *ElasticSearchPlugin) requestAllAPIs(url string, singleElasticsearchInstanceScanResult *SingleElasticsearchInstanceScanResult) {
-	endpoints := []string{
-		// just make sure you requeset all indices
-		fmt.Sprintf("%s?%s&size=1000", API_INDICES, Q_FORMAT_JSON),
-		fmt.Sprintf("%s?%s", API_ALIASES, Q_FORMAT_JSON),
-		fmt.Sprintf("%s?%s", API_ALLOCATIONS, Q_FORMAT_JSON),
-		fmt.Sprintf("%s?%s", API_NODES, Q_FORMAT_JSON),
-	}
+// IsInitialized is set if the response of any of the apis was parsed
+func (elasticSearchPlugin *ElasticSearchPlugin) requestAllAPIs(ctx context.Context, url string, headers map[string]string, singleElasticsearchInstanceScanResult *SingleElasticsearchInstanceScanResult) {
+	clusterInfo := singleElasticsearchInstanceScanResult.ClusterInfo
+	catQueryString := clusterInfo.catQueryString()
 	wg := sync.WaitGroup{}
 	var validHTTPRequestCount EPUtils.Count32 = 0
-	for _, endpoint := range endpoints {
+	for _, api := range elasticSearchPlugin.catApis {
+		path, ok := clusterInfo.catEndpoint(api)
+		if !ok {
+			continue
+		}
+		endpoint := fmt.Sprintf("%s?%s%s", path, catQueryString, api.extraQueryString)
 		wg.Add(1)
-		go func(endpoint string) {
+		go func(api *catApi, endpoint string) {
 			defer wg.Done()
 			var (
 				resp string
@@ -132,13 +255,16 @@ func (elasticSearchPlugin *ElasticSearchPlugin) requestAllAPIs(url string, singl
 			)
 			var finalUrl = fmt.Sprintf("%s%s", url, endpoint)
 			EPUtils.EPLogger(fmt.Sprintf("Requesting %s\n", finalUrl))
-			resp, _, err = EPUtils.SendFailSafeHTTPRequest(finalUrl, 15, false, map[string]string{}, "GET")
+			resp, _, err = elasticSearchPlugin.httpClient.SendFailSafeHTTPRequest(ctx, finalUrl, false, headers, "GET")
 			if err != nil {
 				return
 			}
-			elasticSearchResultSwitch(singleElasticsearchInstanceScanResult, endpoint, resp)
+			if err := api.parse([]byte(clusterInfo.normalizeCatResponse(resp)), singleElasticsearchInstanceScanResult); err != nil {
+				EPUtils.EPLogger(fmt.Sprintf("Error while parsing the response of %s from %s: %v. The response starts with %q", api.name, finalUrl, err, EPUtils.Truncate(resp, MAX_LOGGED_RESPONSE_LEN)))
+				return
+			}
 			validHTTPRequestCount.Inc()
-		}(endpoint)
+		}(api, endpoint)
 
 	}
 	wg.Wait()
@@ -158,48 +284,46 @@ func (elasticSearchPlugin *ElasticSearchPlugin) buildElasticSearchIndexSearchAPI
 }
 
 func (elasticSearchPlugin *ElasticSearchPlugin) searchSingleIndexInfo(
+	ctx context.Context,
+	mu *sync.Mutex,
+	headers map[string]string,
 	indexName string,
 	singleElasticsearchInstanceScanResult *SingleElasticsearchInstanceScanResult,
-) string {
+) {
 	getIndexEndpoint := elasticSearchPlugin.buildElasticSearchIndexSearchAPI(singleElasticsearchInstanceScanResult.RootUrl, indexName)
 	EPUtils.EPLogger(fmt.Sprintf("Requesting %s", getIndexEndpoint))
-	searchIndexResult, _, searchIndexResultErr := EPUtils.SendFailSafeHTTPRequest(getIndexEndpoint, 30, false, map[string]string{}, "GET")
-	if searchIndexResultErr != nil {
-		EPUtils.EPLogger(fmt.Sprintf("Error in requesting index %s from %s", indexName, singleElasticsearchInstanceScanResult.RootUrl))
+	var indexSearchResult *IndexSearchResult
+	statusCode, isTruncated, searchIndexResultErr := elasticSearchPlugin.httpClient.SendFailSafeHTTPRequestStreaming(ctx, getIndexEndpoint, false, headers, "GET", func(statusCode int, body io.Reader) error {
+		var decodeErr error
+		indexSearchResult, decodeErr = DecodeIndexSearchResult(body)
 
-		return ""
-	}
-	var jsonArrayResponse interface{}
-	jsonUnmarshalErr := json.Unmarshal([]byte(searchIndexResult), &jsonArrayResponse)
-	if jsonUnmarshalErr != nil {
-		EPUtils.EPLogger(fmt.Sprintf("Error while unmarshalling result from %s", getIndexEndpoint))
-		fmt.Println(searchIndexResultErr)
-		return ""
+		return decodeErr
+	})
+	switch {
+	case statusCode == -1:
+		EPUtils.EPLogger(fmt.Sprintf("Error in requesting index %s from %s", indexName, singleElasticsearchInstanceScanResult.RootUrl))
+		return
+	case isTruncated && indexSearchResult != nil:
+		EPUtils.EPLogger(fmt.Sprintf("Result from %s was cut off at -max-response-size. Keeping hits received before the cut off", getIndexEndpoint))
+	case searchIndexResultErr != nil:
+		EPUtils.EPLogger(fmt.Sprintf("Error while unmarshalling result from %s: %v", getIndexEndpoint, searchIndexResultErr))
+		return
 	}
 
-	// each index is unique
-	// https://stackoverflow.com/questions/45585589/golang-fatal-error-concurrent-map-read-and-map-write/45585833
-	singleElasticsearchInstanceScanResult.IndicesInfo.Store(indexName, jsonArrayResponse)
-	return searchIndexResult
+	ProcessIndexSearchResultThreadSafely(mu, &singleElasticsearchInstanceScanResult.InstanceScanResult, indexName, indexSearchResult, isTruncated)
 }
 
 func (elasticSearchPlugin *ElasticSearchPlugin) scanInterestingIndices(
+	ctx context.Context,
+	headers map[string]string,
 	singleElasticsearchInstanceScanResult *SingleElasticsearchInstanceScanResult,
 ) {
 	EPUtils.EPLogger(fmt.Sprintf("%s has valid indices. Will query them all", singleElasticsearchInstanceScanResult.RootUrl))
 
 	mu := &sync.Mutex{}
 	getIndicesWg := sync.WaitGroup{}
-	concurrentGoroutines := make(chan struct{}, 5)
-	var maxIndicesFromSingleElasticsearchInstanceScanResult []InterestingIndexInfo
-	maxIndicesNum := elasticSearchPlugin.EsPluginMaxIndices
-	if len(singleElasticsearchInstanceScanResult.Indices) > maxIndicesNum {
-		EPUtils.EPLogger(fmt.Sprintf("%s has number of indices more than %d. Will only request first %d indices as specified in -max-i option", singleElasticsearchInstanceScanResult.RootUrl, maxIndicesNum, maxIndicesNum))
-		maxIndicesFromSingleElasticsearchInstanceScanResult = singleElasticsearchInstanceScanResult.Indices[:maxIndicesNum]
-	} else {
-		maxIndicesFromSingleElasticsearchInstanceScanResult = singleElasticsearchInstanceScanResult.Indices
-	}
-
+	concurrentGoroutines := make(chan struct{}, elasticSearchPlugin.IndexThreadsNum)
+	maxIndicesFromSingleElasticsearchInstanceScanResult := selectIndicesToSearch(&singleElasticsearchInstanceScanResult.InstanceScanResult, elasticSearchPlugin.EsPluginMaxIndices, &elasticSearchPlugin.IndexSizeFlags)
 	for _, indexInfo := range maxIndicesFromSingleElasticsearchInstanceScanResult {
 		getIndicesWg.Add(1)
 		go func(indexInfo InterestingIndexInfo) {
@@ -207,14 +331,13 @@ func (elasticSearchPlugin *ElasticSearchPlugin) scanInterestingIndices(
 			concurrentGoroutines <- struct{}{}
 			// 123.123.123.123/example-index/_search?format=json&size=1000&pretty=true
 			// don't store uninteresting index names
-			searchIndexResult := elasticSearchPlugin.searchSingleIndexInfo(
+			elasticSearchPlugin.searchSingleIndexInfo(
+				ctx,
+				mu,
+				headers,
 				indexInfo.Index,
 				singleElasticsearchInstanceScanResult,
 			)
-
-			if searchIndexResult != "" {
-				ProcessInterestingInfoAndWordsThreadSafely(mu, singleElasticsearchInstanceScanResult, searchIndexResult)
-			}
 			<-concurrentGoroutines
 		}(indexInfo)
 	}
@@ -222,94 +345,137 @@ func (elasticSearchPlugin *ElasticSearchPlugin) scanInterestingIndices(
 	EPUtils.EPLogger(fmt.Sprintf("Finished querying indices information for %s", singleElasticsearchInstanceScanResult.RootUrl))
 }
 
-func (elasticSearchPlugin *ElasticSearchPlugin) scanSingleElasticsearchInstance(url string) *SingleElasticsearchInstanceScanResult {
-	_, _, errFromRootUrl := EPUtils.SendFailSafeHTTPRequest(url, 10, true, map[string]string{}, "GET")
+// authenticates to url and requests its root URL, which tells the version of the cluster.
+// returns false if url did not answer at all
+func (elasticSearchPlugin *ElasticSearchPlugin) probeRootUrl(
+	ctx context.Context,
+	url string,
+	singleElasticsearchInstanceScanResult *SingleElasticsearchInstanceScanResult,
+) (map[string]string, bool) {
+	headers, authMode := authenticate(ctx, elasticSearchPlugin.httpClient, elasticSearchPlugin.credentials, url, map[string]string{})
+	singleElasticsearchInstanceScanResult.AuthMode = authMode
+	rootResponse, _, errFromRootUrl := elasticSearchPlugin.httpClient.SendFailSafeHTTPRequest(ctx, url, true, headers, "GET")
 
 	if errFromRootUrl != nil {
-		return &SingleElasticsearchInstanceScanResult{
-			Id:            primitive.NewObjectID(),
-			CreatedAt:     time.Now(),
-			IsInitialized: false,
-			RootUrl:       url,
-		}
+		return headers, false
 	} else {
 		EPUtils.EPLogger(fmt.Sprintf("%s is a working elasticSearch instance\n", url))
 	}
-	singleElasticsearchInstanceScanResult := &SingleElasticsearchInstanceScanResult{
-		Id:          primitive.NewObjectID(),
-		CreatedAt:   time.Now(),
-		IndicesInfo: sync.Map{},
-		RootUrl:     url,
+	// APIs requested from now on depend on the version
+	singleElasticsearchInstanceScanResult.ClusterInfo = ParseClusterInfo(rootResponse)
+	if clusterInfo := singleElasticsearchInstanceScanResult.ClusterInfo; clusterInfo != nil {
+		EPUtils.EPLogger(fmt.Sprintf("%s is %s %s\n", url, clusterInfo.Distribution, clusterInfo.VersionNumber))
 	}
-	elasticSearchPlugin.requestAllAPIs(url, singleElasticsearchInstanceScanResult)
 
-	if singleElasticsearchInstanceScanResult.Indices == nil {
-		EPUtils.EPLogger(fmt.Sprintf("Failed to get indices from %v\n", url))
-		return singleElasticsearchInstanceScanResult
+	return headers, true
+}
+
+// x-pack APIs of the security posture only exist on elasticsearch.
+// a cluster that did not tell its distribution, like one answering 401 at its root URL, is taken as the product being scanned
+func hasXPack(product string, clusterInfo *ClusterInfo) bool {
+	if clusterInfo == nil {
+		return product != DISTRIBUTION_OPENSEARCH
 	}
-	singleElasticsearchInstanceScanResult.HasAtLeastOneIndexSizeOverGB = CheckOverGBIndexExistence(singleElasticsearchInstanceScanResult.Indices)
-	elasticSearchPlugin.scanInterestingIndices(singleElasticsearchInstanceScanResult)
 
-	return singleElasticsearchInstanceScanResult
+	return !clusterInfo.IsOpenSearch()
 }
 
-var elasticSearchPluginFileWriteMutex sync.Mutex
+// requests the security posture, _cat APIs, and the mappings and documents of the interesting indices of an instance that answered at its root URL
+func (elasticSearchPlugin *ElasticSearchPlugin) scanCluster(
+	ctx context.Context,
+	url string,
+	headers map[string]string,
+	singleElasticsearchInstanceScanResult *SingleElasticsearchInstanceScanResult,
+) {
+	if clusterInfo := singleElasticsearchInstanceScanResult.ClusterInfo; hasXPack(singleElasticsearchInstanceScanResult.Product, clusterInfo) {
+		singleElasticsearchInstanceScanResult.SecurityPosture = elasticSearchPlugin.collectSecurityPosture(ctx, url, headers, clusterInfo)
+	}
+	elasticSearchPlugin.requestAllAPIs(ctx, url, headers, singleElasticsearchInstanceScanResult)
+	// ransom note indices are uninteresting, and are read even if the instance is skipped by its size
+	readRansomNotes(&singleElasticsearchInstanceScanResult.InstanceScanResult, func(indexName string) (string, bool) {
+		noteEndpoint := fmt.Sprintf("%s/%s%s?%s", url, indexName, API_SEARCH, strings.ReplaceAll(Q_SIZE_X_FORMAT_JSON, `{INDEX_SIZE}`, fmt.Sprintf("%v", MAX_RANSOM_NOTE_DOCS)))
+		EPUtils.EPLogger(fmt.Sprintf("Requesting %s", noteEndpoint))
+		resp, statusCode, err := elasticSearchPlugin.httpClient.SendFailSafeHTTPRequest(ctx, noteEndpoint, false, headers, "GET")
 
-func (elasticSearchPlugin *ElasticSearchPlugin) outputSingleElasticsearchInstanceScanResult(singleElasticsearchInstanceScanResult *SingleElasticsearchInstanceScanResult, elasticSearchCollection *mongo.Collection) {
-	// sync.Map can't be (un)marshalled
-	singleElasticsearchInstanceScanResult.IndicesInfoInJson = EPUtils.ConvertSyncMapToMap(singleElasticsearchInstanceScanResult.IndicesInfo)
-	singleElasticsearchInstanceScanResultMarshalled, singleElasticsearchInstanceScanResultMarshalErr := json.Marshal(singleElasticsearchInstanceScanResult)
+		return resp, err == nil && statusCode == 200
+	})
 
-	if singleElasticsearchInstanceScanResultMarshalErr != nil {
-		EPUtils.EPLogger(fmt.Sprintf("Error while marshalling info about %s\n", singleElasticsearchInstanceScanResult.RootUrl))
-		fmt.Println(singleElasticsearchInstanceScanResultMarshalErr)
+	if singleElasticsearchInstanceScanResult.Indices == nil {
+		EPUtils.EPLogger(fmt.Sprintf("Failed to get indices from %v\n", url))
+		return
 	}
+	if skipReason := elasticSearchPlugin.IndexSizeFlags.instanceSkipReason(&singleElasticsearchInstanceScanResult.InstanceScanResult); skipReason != "" {
+		EPUtils.EPLogger(fmt.Sprintf("Skipping indices of %s because it %s", url, skipReason))
+		singleElasticsearchInstanceScanResult.SkippedReason = skipReason
+		return
+	}
+	findSensitiveFieldsOfIndices(&singleElasticsearchInstanceScanResult.InstanceScanResult, &elasticSearchPlugin.IndexSizeFlags, elasticSearchPlugin.IndexThreadsNum, func(indexNames string) (string, bool) {
+		mappingEndpoint := fmt.Sprintf("%s/%s%s", url, indexNames, API_MAPPING)
+		EPUtils.EPLogger(fmt.Sprintf("Requesting %s", mappingEndpoint))
+		resp, statusCode, err := elasticSearchPlugin.httpClient.SendFailSafeHTTPRequest(ctx, mappingEndpoint, false, headers, "GET")
+
+		return resp, err == nil && statusCode == 200
+	})
+	elasticSearchPlugin.scanInterestingIndices(ctx, headers, singleElasticsearchInstanceScanResult)
+}
 
-	switch elasticSearchPlugin.OutputMode {
-	case "json", "plain":
-		{
-			AppendScanResultToJSONFileWithNewline(elasticSearchPlugin.OutputFilePath, singleElasticsearchInstanceScanResultMarshalled, &elasticSearchPluginFileWriteMutex)
-		}
-	case "mongo":
-		{
-			if elasticSearchCollection == nil {
-				panic("mongo option was specified but elasticSearchCollection is nil")
-			}
-			InsertSingleScanResultToMongo(elasticSearchCollection, singleElasticsearchInstanceScanResult, singleElasticsearchInstanceScanResult.RootUrl)
-
-		}
+func (elasticSearchPlugin *ElasticSearchPlugin) scanSingleElasticsearchInstance(ctx context.Context, url string) *SingleElasticsearchInstanceScanResult {
+	singleElasticsearchInstanceScanResult := &SingleElasticsearchInstanceScanResult{
+		InstanceScanResult: newInstanceScanResult(elasticSearchPlugin.Name(), url),
 	}
+	headers, isUp := elasticSearchPlugin.probeRootUrl(ctx, url, singleElasticsearchInstanceScanResult)
+	if isUp {
+		elasticSearchPlugin.scanCluster(ctx, url, headers, singleElasticsearchInstanceScanResult)
+	}
+
+	return singleElasticsearchInstanceScanResult
+}
+
+func (elasticSearchPlugin *ElasticSearchPlugin) outputScanResult(ctx context.Context, scanResult ScanResult) error {
+	scanResult.GetInstanceScanResult().fillIndicesInfoInJson()
+
+	return elasticSearchPlugin.outputSinks.Write(ctx, scanResult)
 }
 
-func (elasticSearchPlugin *ElasticSearchPlugin) Run(urls []string, elasticSearchCollection *mongo.Collection) {
+// stops scheduling new URLs as soon as ctx is cancelled,
+// and gives in-flight URLs -grace seconds to finish before cancelling their requests too.
+func (elasticSearchPlugin *ElasticSearchPlugin) Run(ctx context.Context) {
+	watchRulesFile(ctx, elasticSearchPlugin.RulesFilePath)
+	urls := elasticSearchPlugin.urls.Stream(ctx)
+	scanCtx, cancelScan := EPUtils.WithGracePeriod(ctx, time.Duration(elasticSearchPlugin.GracePeriod)*time.Second)
+	defer cancelScan()
+
 	var finishedGoRoutineCount EPUtils.Count32
+	var outOfScopeCount EPUtils.Count32
 	concurrentGoroutines := make(chan struct{}, elasticSearchPlugin.ThreadsNum)
 	var wg sync.WaitGroup
-	for _, url := range urls {
-		wg.Add(1)
-		go func(url string, elasticSearchCollection *mongo.Collection) {
-			defer wg.Done()
-			concurrentGoroutines <- struct{}{}
-			singleElasticsearchInstanceScanResult := elasticSearchPlugin.scanSingleElasticsearchInstance(url)
-			elasticSearchPlugin.outputSingleElasticsearchInstanceScanResult(singleElasticsearchInstanceScanResult, elasticSearchCollection)
-			finishedGoRoutineCount.Inc()
-			<-concurrentGoroutines
-		}(url, elasticSearchCollection)
-	}
-	go func() {
-		for {
-			time.Sleep(time.Duration(2 * time.Second))
-			EPUtils.EPLogger(fmt.Sprintf("%d/%d of URLs completed\n", finishedGoRoutineCount.Get(), len(urls)))
+	stopProgressLogger := EPUtils.LogProgressPeriodically(time.Duration(2*time.Second), func() string {
+		return elasticSearchPlugin.urls.progress(finishedGoRoutineCount.Get())
+	})
+	scheduledUrlsCount := EPUtils.ScheduleWhileNotCancelled(ctx, urls, concurrentGoroutines, &wg, func(url string) {
+		// also counts urls out of scope and scans discarded after the grace period
+		defer finishedGoRoutineCount.Inc()
+		if !checkScope(scanCtx, elasticSearchPlugin.httpClient, url, &outOfScopeCount) {
+			return
+		}
+		scanResult := elasticSearchPlugin.scanInstance(scanCtx, url)
+		if scanCtx.Err() != nil {
+			EPUtils.EPLogger(fmt.Sprintf("Scan of %s did not finish within the grace period. Discarding partial result.\n", url))
+			return
 		}
-	}()
+		outputErr := elasticSearchPlugin.outputScanResult(scanCtx, scanResult)
+		if outputErr == nil {
+			markScanCompleted(elasticSearchPlugin.checkpoint, url, scanResult.GetInstanceScanResult().IsInitialized)
+		}
+	})
 	wg.Wait()
-	EPUtils.EPLogger(fmt.Sprintf("%d/%d of URLs completed\n", len(urls), len(urls)))
-	EPUtils.EPLogger("Scan finished")
+	stopProgressLogger()
+	EPUtils.EPLogger(elasticSearchPlugin.urls.progress(finishedGoRoutineCount.Get()))
+	logOutOfScopeCount(outOfScopeCount.Get())
+	elasticSearchPlugin.urls.logScanEnd(scheduledUrlsCount)
 }
 
 func (elasticSearchPlugin *ElasticSearchPlugin) PostProcess() {
-	if elasticSearchPlugin.OutputMode != "json" {
-		return
-	}
-	EPUtils.ConvertJSONObjectsToJSONArray(elasticSearchPlugin.OutputFilePath)
+	closeCheckpoint(elasticSearchPlugin.checkpoint)
+	closeOutputSinks(elasticSearchPlugin.outputSinks)
 }
@@ -0,0 +1,256 @@
+package EPPlugins
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	EPUtils "github.com/9oelM/elasticpwn/elasticpwn/util"
+)
+
+// read-only APIs telling how an elasticsearch cluster is secured.
+// elasticsearch before 7.0 serves the x-pack ones under _xpack/ instead
+const (
+	API_XPACK              = "/_xpack"
+	API_LICENSE            = "/_license"
+	API_XPACK_LICENSE      = "/_xpack/license"
+	API_AUTHENTICATE       = "/_security/_authenticate"
+	API_XPACK_AUTHENTICATE = "/_xpack/security/_authenticate"
+	API_SNAPSHOT           = "/_snapshot"
+	API_CLUSTER_SETTINGS   = "/_cluster/settings?flat_settings=true"
+	API_NODES_SETTINGS     = "/_nodes/settings?flat_settings=true"
+)
+
+// type of the realm requests without credentials are authenticated by, if anonymous access is enabled
+const ANONYMOUS_AUTH_REALM_TYPE = "__anonymous"
+
+const (
+	SETTING_SECURITY_ENABLED      = "xpack.security.enabled"
+	SETTING_HTTP_TLS_ENABLED      = "xpack.security.http.ssl.enabled"
+	SETTING_TRANSPORT_TLS_ENABLED = "xpack.security.transport.ssl.enabled"
+	// cluster.remote.<alias>.seeds, or cluster.remote.<alias>.proxy_address in proxy mode
+	SETTING_REMOTE_CLUSTER_PREFIX = "cluster.remote."
+)
+
+// SecurityPosture tells why an elasticsearch cluster is open, rather than what it holds
+type SecurityPosture struct {
+	// true if the cluster does not authenticate requests at all:
+	// x-pack security is disabled or unavailable, or x-pack is not installed
+	AuthDisabled bool `bson:"authDisabled,omitempty" json:"authDisabled"`
+	// the user requests were authenticated as. _anonymous (by default) if anonymous access is enabled
+	AuthenticatedUser string `bson:"authenticatedUser,omitempty" json:"authenticatedUser"`
+	// roles given to requests without credentials. empty unless anonymous access is enabled
+	AnonymousRoles []string `bson:"anonymousRoles,omitempty" json:"anonymousRoles"`
+	// basic, trial, gold, platinum or enterprise. empty if x-pack is not installed
+	LicenseType   string `bson:"licenseType,omitempty" json:"licenseType"`
+	LicenseStatus string `bson:"licenseStatus,omitempty" json:"licenseStatus"`
+	// where snapshots, that is full copies of indices, can be written to or restored from
+	SnapshotRepositories []SnapshotRepository `bson:"snapshotRepositories,omitempty" json:"snapshotRepositories"`
+	// other clusters this one can search or replicate from
+	RemoteClusters []string `bson:"remoteClusters,omitempty" json:"remoteClusters"`
+	// true only if every node enables it. nil if _nodes/settings could not be read
+	HttpTLSEnabled      *bool `bson:"httpTLSEnabled,omitempty" json:"httpTLSEnabled"`
+	TransportTLSEnabled *bool `bson:"transportTLSEnabled,omitempty" json:"transportTLSEnabled"`
+}
+
+type SnapshotRepository struct {
+	Name string `bson:"name" json:"name"`
+	// fs, url, s3, gcs, azure, hdfs, ...
+	Type string `bson:"type" json:"type"`
+	// location, bucket, container, url or path from the repository settings, whichever is set
+	Location string `bson:"location,omitempty" json:"location"`
+}
+
+type xpackLicense struct {
+	Type   string `json:"type"`
+	Status string `json:"status"`
+}
+
+type xpackInfoResponse struct {
+	// nil if _xpack was requested with categories that don't include it
+	License  *xpackLicense `json:"license"`
+	Features struct {
+		Security *struct {
+			Available bool `json:"available"`
+			Enabled   bool `json:"enabled"`
+		} `json:"security"`
+	} `json:"features"`
+}
+
+type licenseResponse struct {
+	License *xpackLicense `json:"license"`
+}
+
+type authenticateResponse struct {
+	Username            string   `json:"username"`
+	Roles               []string `json:"roles"`
+	AuthenticationRealm struct {
+		Type string `json:"type"`
+	} `json:"authentication_realm"`
+}
+
+type snapshotRepositorySettings struct {
+	Type     string                 `json:"type"`
+	Settings map[string]interface{} `json:"settings"`
+}
+
+type clusterSettingsResponse struct {
+	Persistent map[string]interface{} `json:"persistent"`
+	Transient  map[string]interface{} `json:"transient"`
+}
+
+type nodesSettingsResponse struct {
+	Nodes map[string]struct {
+		Settings map[string]interface{} `json:"settings"`
+	} `json:"nodes"`
+}
+
+// sends a GET request to url + api and unmarshals the response into v.
+// returns the status code, or -1 if there was no response
+func (elasticSearchPlugin *ElasticSearchPlugin) getJson(ctx context.Context, url string, api string, headers map[string]string, v interface{}) (int, error) {
+	finalUrl := fmt.Sprintf("%s%s", url, api)
+	EPUtils.EPLogger(fmt.Sprintf("Requesting %s\n", finalUrl))
+	resp, statusCode, err := elasticSearchPlugin.httpClient.SendFailSafeHTTPRequest(ctx, finalUrl, false, headers, "GET")
+	if err != nil {
+		return statusCode, err
+	}
+	if statusCode != 200 {
+		return statusCode, fmt.Errorf("%s answered %d", finalUrl, statusCode)
+	}
+
+	return statusCode, json.Unmarshal([]byte(resp), v)
+}
+
+// requests the read-only APIs about security of an elasticsearch cluster and summarizes them.
+// opensearch is left out, because it has none of x-pack. see OpenSearchSecurityPlugin for it instead
+func (elasticSearchPlugin *ElasticSearchPlugin) collectSecurityPosture(ctx context.Context, url string, headers map[string]string, clusterInfo *ClusterInfo) *SecurityPosture {
+	securityPosture := &SecurityPosture{}
+	licenseApi, authenticateApi := API_LICENSE, API_AUTHENTICATE
+	if !clusterInfo.IsAtLeast(7, 0) {
+		licenseApi, authenticateApi = API_XPACK_LICENSE, API_XPACK_AUTHENTICATE
+	}
+
+	// told by _xpack and _nodes/settings respectively
+	var xpackSecurityDisabled, nodesSecurityDisabled bool
+	wg := sync.WaitGroup{}
+	wg.Add(5)
+	go func() {
+		defer wg.Done()
+		var xpackInfo xpackInfoResponse
+		statusCode, err := elasticSearchPlugin.getJson(ctx, url, API_XPACK, headers, &xpackInfo)
+		switch {
+		// the oss flavor and elasticsearch before 5.0 have no x-pack, hence no security at all
+		case statusCode == 400 || statusCode == 404:
+			xpackSecurityDisabled = true
+		case err != nil:
+			return
+		case xpackInfo.Features.Security != nil:
+			xpackSecurityDisabled = !xpackInfo.Features.Security.Available || !xpackInfo.Features.Security.Enabled
+		}
+		license := xpackInfo.License
+		if license == nil && err == nil {
+			var licenseInfo licenseResponse
+			if _, err := elasticSearchPlugin.getJson(ctx, url, licenseApi, headers, &licenseInfo); err == nil {
+				license = licenseInfo.License
+			}
+		}
+		if license != nil {
+			securityPosture.LicenseType = license.Type
+			securityPosture.LicenseStatus = license.Status
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		var authenticated authenticateResponse
+		if _, err := elasticSearchPlugin.getJson(ctx, url, authenticateApi, headers, &authenticated); err != nil {
+			return
+		}
+		securityPosture.AuthenticatedUser = authenticated.Username
+		if authenticated.AuthenticationRealm.Type == ANONYMOUS_AUTH_REALM_TYPE {
+			securityPosture.AnonymousRoles = authenticated.Roles
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		var repositories map[string]snapshotRepositorySettings
+		if _, err := elasticSearchPlugin.getJson(ctx, url, API_SNAPSHOT, headers, &repositories); err != nil {
+			return
+		}
+		securityPosture.SnapshotRepositories = parseSnapshotRepositories(repositories)
+	}()
+	go func() {
+		defer wg.Done()
+		var clusterSettings clusterSettingsResponse
+		if _, err := elasticSearchPlugin.getJson(ctx, url, API_CLUSTER_SETTINGS, headers, &clusterSettings); err != nil {
+			return
+		}
+		securityPosture.RemoteClusters = parseRemoteClusters(clusterSettings.Persistent, clusterSettings.Transient)
+	}()
+	go func() {
+		defer wg.Done()
+		var nodesSettings nodesSettingsResponse
+		if _, err := elasticSearchPlugin.getJson(ctx, url, API_NODES_SETTINGS, headers, &nodesSettings); err != nil || len(nodesSettings.Nodes) == 0 {
+			return
+		}
+		httpTLSEnabled, transportTLSEnabled := true, true
+		for _, node := range nodesSettings.Nodes {
+			// settings left out are at their defaults, which is false for all of these
+			httpTLSEnabled = httpTLSEnabled && isSettingTrue(node.Settings, SETTING_HTTP_TLS_ENABLED)
+			transportTLSEnabled = transportTLSEnabled && isSettingTrue(node.Settings, SETTING_TRANSPORT_TLS_ENABLED)
+			nodesSecurityDisabled = nodesSecurityDisabled || fmt.Sprintf("%v", node.Settings[SETTING_SECURITY_ENABLED]) == "false"
+		}
+		securityPosture.HttpTLSEnabled = &httpTLSEnabled
+		securityPosture.TransportTLSEnabled = &transportTLSEnabled
+	}()
+	wg.Wait()
+	securityPosture.AuthDisabled = xpackSecurityDisabled || nodesSecurityDisabled
+
+	return securityPosture
+}
+
+func isSettingTrue(settings map[string]interface{}, name string) bool {
+	return fmt.Sprintf("%v", settings[name]) == "true"
+}
+
+func parseSnapshotRepositories(repositories map[string]snapshotRepositorySettings) []SnapshotRepository {
+	var snapshotRepositories []SnapshotRepository
+	for name, repository := range repositories {
+		snapshotRepository := SnapshotRepository{Name: name, Type: repository.Type}
+		for _, locationSetting := range []string{"location", "bucket", "container", "url", "path"} {
+			if location, ok := repository.Settings[locationSetting]; ok {
+				snapshotRepository.Location = fmt.Sprintf("%v", location)
+				break
+			}
+		}
+		snapshotRepositories = append(snapshotRepositories, snapshotRepository)
+	}
+	sort.Slice(snapshotRepositories, func(i, j int) bool {
+		return snapshotRepositories[i].Name < snapshotRepositories[j].Name
+	})
+
+	return snapshotRepositories
+}
+
+// collects <alias> from cluster.remote.<alias>.seeds and the like in flat settings
+func parseRemoteClusters(flatSettings ...map[string]interface{}) []string {
+	var remoteClusters []string
+	for _, settings := range flatSettings {
+		for name := range settings {
+			if !strings.HasPrefix(name, SETTING_REMOTE_CLUSTER_PREFIX) {
+				continue
+			}
+			alias := strings.TrimPrefix(name, SETTING_REMOTE_CLUSTER_PREFIX)
+			if dot := strings.Index(alias, "."); dot != -1 {
+				alias = alias[:dot]
+			}
+			remoteClusters = append(remoteClusters, alias)
+		}
+	}
+	remoteClusters = EPUtils.Unique(remoteClusters)
+	sort.Strings(remoteClusters)
+
+	return remoteClusters
+}
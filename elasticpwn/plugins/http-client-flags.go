@@ -0,0 +1,142 @@
+package EPPlugins
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+	"time"
+
+	EPUtils "github.com/9oelM/elasticpwn/elasticpwn/util"
+)
+
+const (
+	DEFAULT_CONNECT_TIMEOUT_SECS = 10
+	DEFAULT_READ_TIMEOUT_SECS    = 30
+	DEFAULT_MAX_RESPONSE_SIZE_MB = 100
+	DEFAULT_RETRIES              = 2
+	DEFAULT_RETRY_BACKOFF_SECS   = 1
+)
+
+// flags shared by all plugins sending requests to elastic products.
+// scope is enforced by the client too, so that redirects out of scope are never followed.
+// embed it in a plugin and call its DefineFlags, Validate and NewHTTPClient from the plugin's own.
+type HTTPClientFlags struct {
+	ProxyUrl            string
+	CACertPath          string
+	InsecureSkipVerify  bool
+	Headers             headerFlags
+	ConnectTimeout      int
+	ReadTimeout         int
+	MaxResponseSize     int
+	Retries             int
+	RetryBackoff        int
+	RateLimit           float64
+	HostRateLimit       float64
+	ScopeFilePath       string
+	ExcludeFilePath     string
+	CredentialsFilePath string
+}
+
+func (httpClientFlags *HTTPClientFlags) DefineFlags(fs *flag.FlagSet) {
+	fs.StringVar(&httpClientFlags.ProxyUrl, "proxy", "", `[OPTIONAL] send all requests through this proxy.
+http://, https:// and socks5:// are supported. example: socks5://127.0.0.1:1080`)
+	fs.StringVar(&httpClientFlags.CACertPath, "ca-cert", "", "[OPTIONAL] path to a PEM file with CA certificates to trust in addition to the system ones")
+	fs.BoolVar(&httpClientFlags.InsecureSkipVerify, "insecure", false, "[OPTIONAL] do not verify TLS certificates of the scanned instances")
+	fs.Var(&httpClientFlags.Headers, "H", `[OPTIONAL] extra header to send with every request, like -H "X-Audit-Id: 1234".
+Can be given multiple times. Overrides headers set by elasticpwn itself.`)
+	fs.IntVar(&httpClientFlags.ConnectTimeout, "connect-timeout", DEFAULT_CONNECT_TIMEOUT_SECS, "[OPTIONAL] seconds to wait for connecting to an instance")
+	fs.IntVar(&httpClientFlags.ReadTimeout, "read-timeout", DEFAULT_READ_TIMEOUT_SECS, `[OPTIONAL] seconds to wait for a whole response once connected.
+Setting this high may cause a memory usage spike in low-end machines.`)
+	fs.IntVar(&httpClientFlags.MaxResponseSize, "max-response-size", DEFAULT_MAX_RESPONSE_SIZE_MB, "[OPTIONAL] responses larger than this (in MB) are cut off. 0 for no limit")
+	fs.IntVar(&httpClientFlags.Retries, "retries", DEFAULT_RETRIES, `[OPTIONAL] number of times to retry a request that failed for a transient reason
+(timeouts, connection resets, 429 and 503 responses). 0 for no retries`)
+	fs.IntVar(&httpClientFlags.RetryBackoff, "retry-backoff", DEFAULT_RETRY_BACKOFF_SECS, "[OPTIONAL] seconds to wait before the first retry. doubled on each retry after that")
+	fs.StringVar(&httpClientFlags.ScopeFilePath, "scope", "", `[OPTIONAL] path to a file of targets allowed to be scanned, one per line.
+A line is a CIDR, an IP or a hostname (*.example.com for subdomains), optionally with ports like 10.0.0.0/8:9200,9243.
+Targets not in it, and redirects to them, are skipped.`)
+	fs.StringVar(&httpClientFlags.ExcludeFilePath, "exclude", "", `[OPTIONAL] path to a file of targets never to be scanned, in the same format as -scope.
+Wins over -scope.`)
+	fs.StringVar(&httpClientFlags.CredentialsFilePath, "creds", "", `[OPTIONAL] path to a file of credentials for auditing secured clusters.
+Each line is <target> <mode> <secret>, where target is written like a -scope rule (or * for any target),
+mode is basic, apikey or bearer, and secret is user:password, the API key or the token respectively.
+The first matching line is used. Overridden by -H "Authorization: ...".`)
+	fs.Float64Var(&httpClientFlags.RateLimit, "rate", 0, `[OPTIONAL] maximum requests per second across all hosts. 0 for no limit.
+Up to a second's worth of requests may be sent at once.`)
+	fs.Float64Var(&httpClientFlags.HostRateLimit, "host-rate", 0, `[OPTIONAL] maximum requests per second to a single host. 0 for no limit.
+Set this to stay under the WAF of the audited hosts. Can be less than 1, like 0.5 for a request every 2 seconds.`)
+}
+
+// returns true if the plugin needs to exit
+func (httpClientFlags *HTTPClientFlags) Validate() bool {
+	needsExit := EPUtils.ValidatePositiveInt(httpClientFlags.ConnectTimeout, "-connect-timeout") ||
+		EPUtils.ValidatePositiveInt(httpClientFlags.ReadTimeout, "-read-timeout") ||
+		EPUtils.ValidateNonNegativeInt(httpClientFlags.MaxResponseSize, "-max-response-size") ||
+		EPUtils.ValidateNonNegativeInt(httpClientFlags.Retries, "-retries") ||
+		EPUtils.ValidateNonNegativeInt(httpClientFlags.RetryBackoff, "-retry-backoff") ||
+		EPUtils.ValidateNonNegativeFloat(httpClientFlags.RateLimit, "-rate") ||
+		EPUtils.ValidateNonNegativeFloat(httpClientFlags.HostRateLimit, "-host-rate")
+
+	if httpClientFlags.ProxyUrl != "" {
+		if _, err := EPUtils.ParseProxyUrl(httpClientFlags.ProxyUrl); err != nil {
+			EPUtils.Printf("-proxy option is invalid: %v\n", err)
+			needsExit = true
+		}
+	}
+	if httpClientFlags.InsecureSkipVerify && httpClientFlags.CACertPath != "" {
+		EPUtils.EPLogger("-ca-cert option will be ignored because -insecure option was set")
+	}
+
+	return needsExit
+}
+
+func (httpClientFlags *HTTPClientFlags) NewHTTPClient() (*EPUtils.HTTPClient, error) {
+	scope, err := EPUtils.LoadScope(httpClientFlags.ScopeFilePath, httpClientFlags.ExcludeFilePath)
+	if err != nil {
+		return nil, err
+	}
+
+	return EPUtils.NewHTTPClient(EPUtils.HTTPClientOptions{
+		ProxyUrl:                 httpClientFlags.ProxyUrl,
+		CACertPath:               httpClientFlags.CACertPath,
+		InsecureSkipVerify:       httpClientFlags.InsecureSkipVerify,
+		Headers:                  httpClientFlags.Headers,
+		ConnectTimeout:           time.Duration(httpClientFlags.ConnectTimeout) * time.Second,
+		ReadTimeout:              time.Duration(httpClientFlags.ReadTimeout) * time.Second,
+		MaxResponseSize:          int64(httpClientFlags.MaxResponseSize) * 1024 * 1024,
+		Retries:                  httpClientFlags.Retries,
+		RetryBackoff:             time.Duration(httpClientFlags.RetryBackoff) * time.Second,
+		RequestsPerSecond:        httpClientFlags.RateLimit,
+		RequestsPerSecondPerHost: httpClientFlags.HostRateLimit,
+		Scope:                    scope,
+	})
+}
+
+// returns nil if -creds is not set
+func (httpClientFlags *HTTPClientFlags) LoadCredentials() (*EPUtils.CredentialsFile, error) {
+	return EPUtils.LoadCredentialsFile(httpClientFlags.CredentialsFilePath)
+}
+
+// -H "Name: value", given multiple times
+type headerFlags map[string]string
+
+func (headers *headerFlags) String() string {
+	var headerStrings []string
+	for name, value := range *headers {
+		headerStrings = append(headerStrings, fmt.Sprintf("%v: %v", name, value))
+	}
+
+	return strings.Join(headerStrings, ", ")
+}
+
+func (headers *headerFlags) Set(header string) error {
+	nameAndValue := strings.SplitN(header, ":", 2)
+	if len(nameAndValue) != 2 || strings.TrimSpace(nameAndValue[0]) == "" {
+		return fmt.Errorf("%v is not a valid header. It should look like \"Name: value\"", header)
+	}
+	if *headers == nil {
+		*headers = headerFlags{}
+	}
+	(*headers)[strings.TrimSpace(nameAndValue[0])] = strings.TrimSpace(nameAndValue[1])
+
+	return nil
+}
@@ -0,0 +1,122 @@
+package EPPlugins
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	EPUtils "github.com/9oelM/elasticpwn/elasticpwn/util"
+)
+
+const API_MAPPING = "/_mapping"
+
+// mappings are requested for at most this many interesting indices of a single instance.
+// some instances have thousands of rollover indices with the same mapping
+const MAX_INDEX_MAPPINGS = 200
+
+// mappings of several indices are requested at once, like /<index>,<index>/_mapping.
+// the names joined with commas are kept within this many bytes, so that the URL stays within
+// the 4kb limit of the request line of elasticsearch
+const MAX_MAPPING_BATCH_LEN = 3000
+
+// returns the interesting indices of instanceScanResult whose mappings are worth requesting:
+// those not skipped by indexSizeFlags, and at most MAX_INDEX_MAPPINGS of them with the highest scores by name, docs and size
+// given by setIndices. indices with the same score are kept in the order of _cat/indices
+func selectIndicesToMap(instanceScanResult *InstanceScanResult, indexSizeFlags *IndexSizeFlags) []*InterestingIndexInfo {
+	var indices []*InterestingIndexInfo
+	for i := range instanceScanResult.Indices {
+		indexInfo := &instanceScanResult.Indices[i]
+		if indexSizeFlags.indexSkipReason(indexInfo) != "" {
+			continue
+		}
+		indices = append(indices, indexInfo)
+	}
+	if len(indices) <= MAX_INDEX_MAPPINGS {
+		return indices
+	}
+
+	sort.SliceStable(indices, func(i, j int) bool {
+		return getScore(indices[i]) > getScore(indices[j])
+	})
+	EPUtils.EPLogger(fmt.Sprintf("%s has more than %d interesting indices. Will only request mappings of %d indices with the highest scores", instanceScanResult.RootUrl, MAX_INDEX_MAPPINGS, MAX_INDEX_MAPPINGS))
+
+	return indices[:MAX_INDEX_MAPPINGS]
+}
+
+// splits indices into batches whose names, joined with commas, fit in MAX_MAPPING_BATCH_LEN
+func batchIndicesToMap(indices []*InterestingIndexInfo) [][]*InterestingIndexInfo {
+	var batches [][]*InterestingIndexInfo
+	var batch []*InterestingIndexInfo
+	batchLen := 0
+	for _, indexInfo := range indices {
+		if len(batch) > 0 && batchLen+1+len(indexInfo.Index) > MAX_MAPPING_BATCH_LEN {
+			batches = append(batches, batch)
+			batch, batchLen = nil, 0
+		}
+		if len(batch) > 0 {
+			batchLen++
+		}
+		batch = append(batch, indexInfo)
+		batchLen += len(indexInfo.Index)
+	}
+	if len(batch) > 0 {
+		batches = append(batches, batch)
+	}
+
+	return batches
+}
+
+// requests the mappings of the interesting indices of instanceScanResult chosen by selectIndicesToMap with requestMappings,
+// a batch of indices at a time, and stores the sensitive fields found in them on each index.
+// this tells which indices hold sensitive data without requesting any more documents.
+// requestMappings returns the response of /<index>,<index>,.../_mapping, or false if there was none.
+// if a batch fails, like when one of its indices was deleted in the meantime, its indices are requested one by one
+func findSensitiveFieldsOfIndices(instanceScanResult *InstanceScanResult, indexSizeFlags *IndexSizeFlags, indexThreadsNum int, requestMappings func(indexNames string) (string, bool)) {
+	wg := sync.WaitGroup{}
+	concurrentGoroutines := make(chan struct{}, indexThreadsNum)
+	var indicesWithSensitiveFieldsCount EPUtils.Count32
+	var requestBatch func(batch []*InterestingIndexInfo)
+	requestBatch = func(batch []*InterestingIndexInfo) {
+		indexNames := make([]string, 0, len(batch))
+		for _, indexInfo := range batch {
+			indexNames = append(indexNames, indexInfo.Index)
+		}
+		mappingResponse, ok := requestMappings(strings.Join(indexNames, ","))
+		if !ok {
+			if len(batch) > 1 {
+				for _, indexInfo := range batch {
+					requestBatch([]*InterestingIndexInfo{indexInfo})
+				}
+			}
+			return
+		}
+		sensitiveFieldsByIndex, err := EPUtils.FindSensitiveFields([]byte(mappingResponse))
+		if err != nil {
+			EPUtils.EPLogger(fmt.Sprintf("Error while unmarshalling mappings of %s from %s: %v", strings.Join(indexNames, ","), instanceScanResult.RootUrl, err))
+			return
+		}
+		for _, indexInfo := range batch {
+			// keyed by the concrete index name, which is the same since the names come from _cat/indices
+			indexInfo.SensitiveFields = sensitiveFieldsByIndex[indexInfo.Index]
+			if len(indexInfo.SensitiveFields) > 0 {
+				indicesWithSensitiveFieldsCount.Inc()
+			}
+		}
+	}
+	for _, batch := range batchIndicesToMap(selectIndicesToMap(instanceScanResult, indexSizeFlags)) {
+		wg.Add(1)
+		// each goroutine writes only to the indices of its own batch
+		go func(batch []*InterestingIndexInfo) {
+			defer wg.Done()
+			concurrentGoroutines <- struct{}{}
+			defer func() { <-concurrentGoroutines }()
+
+			requestBatch(batch)
+		}(batch)
+	}
+	wg.Wait()
+	if count := indicesWithSensitiveFieldsCount.Get(); count > 0 {
+		EPUtils.EPLogger(fmt.Sprintf("%s has %d indices with sensitive fields", instanceScanResult.RootUrl, count))
+	}
+}
@@ -0,0 +1,86 @@
+package EPPlugins
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSelectIndicesToMap(t *testing.T) {
+	instanceScanResult := &InstanceScanResult{RootUrl: "http://1.1.1.1:9200"}
+	ten := int64(10)
+	for i := 0; i < MAX_INDEX_MAPPINGS; i++ {
+		instanceScanResult.Indices = append(instanceScanResult.Indices, InterestingIndexInfo{Index: fmt.Sprintf("logs-%d", i), DocsCount: "10", DocsCountNumber: &ten})
+	}
+	one := int64(1)
+	instanceScanResult.Indices = append(instanceScanResult.Indices,
+		InterestingIndexInfo{Index: "customers", DocsCount: "10", DocsCountNumber: &ten},
+		// skipped by -min-docs even though its name scores high
+		InterestingIndexInfo{Index: "users", DocsCount: "1", DocsCountNumber: &one},
+	)
+	// as setIndices does
+	for i := range instanceScanResult.Indices {
+		scoreIndex(&instanceScanResult.Indices[i])
+	}
+
+	indices := selectIndicesToMap(instanceScanResult, &IndexSizeFlags{MinDocs: 2})
+	if len(indices) != MAX_INDEX_MAPPINGS {
+		t.Fatalf("expected %d indices but got %d", MAX_INDEX_MAPPINGS, len(indices))
+	}
+	if indices[0].Index != "customers" || indices[1].Index != "logs-0" {
+		t.Errorf("expected customers first, then indices in the order of _cat/indices, but got %s, %s", indices[0].Index, indices[1].Index)
+	}
+	for _, indexInfo := range indices {
+		if indexInfo.Index == "users" {
+			t.Error("expected users to be skipped by -min-docs")
+		}
+	}
+}
+
+func TestFindSensitiveFieldsOfIndices(t *testing.T) {
+	instanceScanResult := &InstanceScanResult{RootUrl: "http://1.1.1.1:9200"}
+	for _, indexName := range []string{"customers", "deleted", "orders"} {
+		instanceScanResult.Indices = append(instanceScanResult.Indices, InterestingIndexInfo{Index: indexName})
+	}
+	mappings := map[string]string{
+		"customers": `"customers": {"mappings": {"properties": {"email": {"type": "keyword"}}}}`,
+		"orders":    `"orders": {"mappings": {"properties": {"card": {"properties": {"number": {"type": "keyword"}}}}}}`,
+	}
+	var requests []string
+	findSensitiveFieldsOfIndices(instanceScanResult, &IndexSizeFlags{}, 1, func(indexNames string) (string, bool) {
+		requests = append(requests, indexNames)
+		var found []string
+		for _, indexName := range strings.Split(indexNames, ",") {
+			mapping, ok := mappings[indexName]
+			// like elasticsearch, a missing index fails the whole request
+			if !ok {
+				return "", false
+			}
+			found = append(found, mapping)
+		}
+		return "{" + strings.Join(found, ",") + "}", true
+	})
+
+	expectedRequests := []string{"customers,deleted,orders", "customers", "deleted", "orders"}
+	if !reflect.DeepEqual(requests, expectedRequests) {
+		t.Errorf("expected requests %v but got %v", expectedRequests, requests)
+	}
+	for i, expectedPath := range []string{"email", "", "card.number"} {
+		indexInfo := instanceScanResult.Indices[i]
+		if (expectedPath == "") != (len(indexInfo.SensitiveFields) == 0) || (expectedPath != "" && indexInfo.SensitiveFields[0].Path != expectedPath) {
+			t.Errorf("expected %q in %s but got %+v", expectedPath, indexInfo.Index, indexInfo.SensitiveFields)
+		}
+	}
+}
+
+func TestBatchIndicesToMap(t *testing.T) {
+	var indices []*InterestingIndexInfo
+	for i := 0; i < 3; i++ {
+		indices = append(indices, &InterestingIndexInfo{Index: strings.Repeat(fmt.Sprint(i), MAX_MAPPING_BATCH_LEN/2-1)})
+	}
+	batches := batchIndicesToMap(indices)
+	if len(batches) != 2 || len(batches[0]) != 2 || len(batches[1]) != 1 {
+		t.Errorf("expected batches of 2 and 1 indices but got %v", batches)
+	}
+}
@@ -0,0 +1,138 @@
+package EPPlugins
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	EPUtils "github.com/9oelM/elasticpwn/elasticpwn/util"
+)
+
+const RULES_FLAG_USAGE = `[OPTIONAL] path to a YAML (or JSON, if it ends with .json) file of rules
+deciding which indices are stored and requested, added to the built-in ones.
+Test it with: elasticpwn rules test -rules <file> <index name>. See README.md for the format.`
+
+// the built-in rules, from the lists in elastic-util.go
+func newBuiltInRules() *EPUtils.Rules {
+	var uninterestingIndices []*EPUtils.NameRule
+	for _, prefix := range UninterstingIndexNamesStartingWith {
+		uninterestingIndices = append(uninterestingIndices, &EPUtils.NameRule{Prefix: prefix})
+	}
+	for _, contained := range UninterstingIndexNamesLowercase {
+		uninterestingIndices = append(uninterestingIndices, &EPUtils.NameRule{Contains: contained})
+	}
+	for _, exact := range UninterestingIfExactlyMatches {
+		uninterestingIndices = append(uninterestingIndices, &EPUtils.NameRule{Exact: exact})
+	}
+
+	return EPUtils.NewBuiltInRules(EPUtils.Rules{
+		InterestingWords:                   InterestingWordsLowercase,
+		UninterestingIndices:               uninterestingIndices,
+		UninterestingIfAllOfTheseInIndices: UninterstingIfAllOfTheseInIndices,
+	})
+}
+
+// how often the rules file is checked for changes while scanning
+const RULES_FILE_POLL_INTERVAL = 5 * time.Second
+
+// the rules and the regexes of their interesting words, swapped together
+type rulesInUse struct {
+	rules                   *EPUtils.Rules
+	interestingWordsRegexes []*InterestingWordRegex
+}
+
+// holds *rulesInUse. the built-in ones, merged with -rules by useRulesFile
+var currentRules atomic.Value
+
+func init() {
+	builtInRules := newBuiltInRules()
+	currentRules.Store(&rulesInUse{
+		rules:                   builtInRules,
+		interestingWordsRegexes: newInterestingWordsRegexes(builtInRules.InterestingWords),
+	})
+}
+
+// the rules in use. read it once for each decision, since it may be replaced by a reload in the meantime
+func getIndexRules() *EPUtils.Rules {
+	return currentRules.Load().(*rulesInUse).rules
+}
+
+func getInterestingWordsRegexes() []*InterestingWordRegex {
+	return currentRules.Load().(*rulesInUse).interestingWordsRegexes
+}
+
+// returns true if the plugin needs to exit
+func validateRulesFile(rulesFilePath string) bool {
+	if _, err := EPUtils.LoadRulesFile(rulesFilePath); err != nil {
+		EPUtils.Printf("-rules option is invalid: %v\n", err)
+		return true
+	}
+
+	return false
+}
+
+// merges the rules file with the built-in rules and uses them from now on. does nothing if rulesFilePath is empty.
+// the rules in use are kept if the file is invalid
+func useRulesFile(rulesFilePath string) error {
+	rules, err := EPUtils.LoadRulesFile(rulesFilePath)
+	if err != nil || rules == nil {
+		return err
+	}
+	mergedRules := newBuiltInRules().Merge(rules)
+	currentRules.Store(&rulesInUse{
+		rules:                   mergedRules,
+		interestingWordsRegexes: newInterestingWordsRegexes(mergedRules.InterestingWords),
+	})
+	EPUtils.EPLogger(fmt.Sprintf("Using rules from %s", rulesFilePath))
+
+	return nil
+}
+
+// reloads the rules file on SIGHUP, or when it changes, until ctx is done. does nothing if rulesFilePath is empty.
+// decisions already made with the old rules, like indices already skipped, are not revisited
+func watchRulesFile(ctx context.Context, rulesFilePath string) {
+	if rulesFilePath == "" {
+		return
+	}
+	hangups := make(chan os.Signal, 1)
+	signal.Notify(hangups, syscall.SIGHUP)
+	modTime := rulesFileModTime(rulesFilePath)
+
+	go func() {
+		defer signal.Stop(hangups)
+		ticker := time.NewTicker(RULES_FILE_POLL_INTERVAL)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-hangups:
+				EPUtils.EPLogger(fmt.Sprintf("Received SIGHUP. Reloading rules from %s", rulesFilePath))
+			case <-ticker.C:
+				latestModTime := rulesFileModTime(rulesFilePath)
+				if latestModTime.Equal(modTime) {
+					continue
+				}
+				modTime = latestModTime
+				EPUtils.EPLogger(fmt.Sprintf("%s changed. Reloading rules", rulesFilePath))
+			}
+			if err := useRulesFile(rulesFilePath); err != nil {
+				EPUtils.EPLogger(fmt.Sprintf("Keeping the rules in use, because %s is invalid: %v", rulesFilePath, err))
+			}
+		}
+	}()
+}
+
+// zero if the file can't be read. it is reported when it is reloaded
+func rulesFileModTime(rulesFilePath string) time.Time {
+	stat, err := os.Stat(rulesFilePath)
+	if err != nil {
+		return time.Time{}
+	}
+
+	return stat.ModTime()
+}
@@ -0,0 +1,51 @@
+package EPPlugins
+
+import (
+	"fmt"
+	"sort"
+
+	EPUtils "github.com/9oelM/elasticpwn/elasticpwn/util"
+)
+
+// scores indexInfo from its name, docs.count, store.size and the sensitive fields of its mapping found so far
+func scoreIndex(indexInfo *InterestingIndexInfo) {
+	score, scoreReason := EPUtils.ScoreIndex(indexInfo.Index, indexInfo.DocsCountNumber, indexInfo.StoreSizeBytes, indexInfo.SensitiveFields)
+	indexInfo.Score, indexInfo.ScoreReason = &score, scoreReason
+}
+
+// 0 if indexInfo was not scored
+func getScore(indexInfo *InterestingIndexInfo) int {
+	if indexInfo.Score == nil {
+		return 0
+	}
+
+	return *indexInfo.Score
+}
+
+// scores every interesting index of instanceScanResult again, and returns at most maxIndicesNum of them
+// with the highest scores, so that -max-i picks customers over the first few log rollover indices.
+// indices skipped by indexSizeFlags are left out before choosing.
+// indices with the same score are kept in the order of _cat/indices.
+// call it after findSensitiveFieldsOfIndices, because sensitive fields add to the score
+func selectIndicesToSearch(instanceScanResult *InstanceScanResult, maxIndicesNum int, indexSizeFlags *IndexSizeFlags) []InterestingIndexInfo {
+	var indices []InterestingIndexInfo
+	for i := range instanceScanResult.Indices {
+		indexInfo := &instanceScanResult.Indices[i]
+		scoreIndex(indexInfo)
+		if skipReason := indexSizeFlags.indexSkipReason(indexInfo); skipReason != "" {
+			EPUtils.EPLogger(fmt.Sprintf("Skipping %s of %s because it %s", indexInfo.Index, instanceScanResult.RootUrl, skipReason))
+			continue
+		}
+		indices = append(indices, *indexInfo)
+	}
+
+	sort.SliceStable(indices, func(i, j int) bool {
+		return getScore(&indices[i]) > getScore(&indices[j])
+	})
+	if len(indices) > maxIndicesNum {
+		EPUtils.EPLogger(fmt.Sprintf("%s has number of indices more than %d. Will only request %d indices with the highest scores as specified in -max-i option", instanceScanResult.RootUrl, maxIndicesNum, maxIndicesNum))
+		indices = indices[:maxIndicesNum]
+	}
+
+	return indices
+}
@@ -0,0 +1,88 @@
+package EPPlugins
+
+import (
+	"flag"
+	"fmt"
+
+	EPUtils "github.com/9oelM/elasticpwn/elasticpwn/util"
+)
+
+// flags skipping indices and instances by docs.count and store.size from _cat/indices.
+// embed it in a plugin and call its DefineFlags and Validate from the plugin's own.
+type IndexSizeFlags struct {
+	// indices with fewer docs are not requested. 0 for no limit
+	MinDocs int
+	// indices larger than this, like 10gb, are not requested. empty for no limit
+	MaxStoreSize string
+	// instances with fewer docs in all of their indices are not scanned beyond _cat APIs. 0 for no limit
+	MinTotalDocs int
+	// instances with more data in all of their indices are not scanned beyond _cat APIs. empty for no limit
+	MaxTotalStoreSize string
+
+	// parsed from MaxStoreSize and MaxTotalStoreSize. 0 for no limit
+	maxStoreSizeBytes      int64
+	maxTotalStoreSizeBytes int64
+}
+
+func (indexSizeFlags *IndexSizeFlags) DefineFlags(fs *flag.FlagSet) {
+	fs.IntVar(&indexSizeFlags.MinDocs, "min-docs", 0, "[OPTIONAL] indices with fewer docs than this are not requested. 0 for no limit")
+	fs.StringVar(&indexSizeFlags.MaxStoreSize, "max-store-size", "", `[OPTIONAL] indices with store.size larger than this, like 500mb or 10gb, are not requested.
+Empty for no limit`)
+	fs.IntVar(&indexSizeFlags.MinTotalDocs, "min-total-docs", 0, `[OPTIONAL] instances with fewer docs than this in all of their indices
+are not scanned beyond _cat APIs. 0 for no limit`)
+	fs.StringVar(&indexSizeFlags.MaxTotalStoreSize, "max-total-store-size", "", `[OPTIONAL] instances with more data than this in all of their indices, like 1tb,
+are not scanned beyond _cat APIs. Empty for no limit`)
+}
+
+// returns true if the plugin needs to exit
+func (indexSizeFlags *IndexSizeFlags) Validate() bool {
+	needsExit := EPUtils.ValidateNonNegativeInt(indexSizeFlags.MinDocs, "-min-docs") ||
+		EPUtils.ValidateNonNegativeInt(indexSizeFlags.MinTotalDocs, "-min-total-docs")
+
+	for _, sizeFlag := range []struct {
+		value  string
+		name   string
+		parsed *int64
+	}{
+		{indexSizeFlags.MaxStoreSize, "-max-store-size", &indexSizeFlags.maxStoreSizeBytes},
+		{indexSizeFlags.MaxTotalStoreSize, "-max-total-store-size", &indexSizeFlags.maxTotalStoreSizeBytes},
+	} {
+		if sizeFlag.value == "" {
+			continue
+		}
+		bytes, err := EPUtils.ParseByteSize(sizeFlag.value)
+		if err != nil || bytes == 0 {
+			EPUtils.Printf("%v option is invalid. Input a size like 500mb or 10gb.\n", sizeFlag.name)
+			needsExit = true
+			continue
+		}
+		*sizeFlag.parsed = bytes
+	}
+
+	return needsExit
+}
+
+// returns why indexInfo should not be requested, or an empty string if it should be.
+// an index whose docs.count or store.size is unknown is always requested
+func (indexSizeFlags *IndexSizeFlags) indexSkipReason(indexInfo *InterestingIndexInfo) string {
+	switch {
+	case indexInfo.DocsCountNumber != nil && *indexInfo.DocsCountNumber < int64(indexSizeFlags.MinDocs):
+		return fmt.Sprintf("has fewer docs than -min-docs %d", indexSizeFlags.MinDocs)
+	case indexSizeFlags.maxStoreSizeBytes > 0 && indexInfo.StoreSizeBytes != nil && *indexInfo.StoreSizeBytes > indexSizeFlags.maxStoreSizeBytes:
+		return fmt.Sprintf("is larger than -max-store-size %s", indexSizeFlags.MaxStoreSize)
+	}
+
+	return ""
+}
+
+// returns why the indices of instanceScanResult should not be requested at all, or an empty string if they should be
+func (indexSizeFlags *IndexSizeFlags) instanceSkipReason(instanceScanResult *InstanceScanResult) string {
+	switch {
+	case instanceScanResult.TotalDocsCount < int64(indexSizeFlags.MinTotalDocs):
+		return fmt.Sprintf("has fewer docs than -min-total-docs %d", indexSizeFlags.MinTotalDocs)
+	case indexSizeFlags.maxTotalStoreSizeBytes > 0 && instanceScanResult.TotalStoreSizeBytes > indexSizeFlags.maxTotalStoreSizeBytes:
+		return fmt.Sprintf("has more data than -max-total-store-size %s", indexSizeFlags.MaxTotalStoreSize)
+	}
+
+	return ""
+}
@@ -0,0 +1,130 @@
+package EPPlugins
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	EPUtils "github.com/9oelM/elasticpwn/elasticpwn/util"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// bump this whenever the serialized form of scan results changes,
+// so that consumers (report generator, sqlite, scripts) can tell old and new results apart.
+// results written before the schema version was introduced have no schemaVersion at all.
+//
+// 1: common InstanceScanResult core. kibana's IpInfo and IndicesInfo were renamed to ipInfo and dropped respectively
+// 2: authMode, truncatedIndices, totalStoreSizeBytes, totalDocsCount, skippedReason, classification and compromise.
+// sensitiveFields, score, scoreReason and the parsed sizes of each index.
+// clusterInfo, securityPosture and the typed rows of the _cat apis selected with -apis for elasticsearch,
+// and securityPlugin for opensearch
+const SCAN_RESULT_SCHEMA_VERSION = 2
+
+// InstanceScanResult is the part of a scan result common to all elastic products.
+// Product-specific results embed it and add their own fields,
+// which are serialized at the same level as the fields of InstanceScanResult.
+type InstanceScanResult struct {
+	SchemaVersion int                `bson:"schemaVersion" json:"schemaVersion"`
+	Id            primitive.ObjectID `bson:"_id,omitempty" json:"_id"`
+	// name of the plugin that produced this result, like elasticsearch, kibana or opensearch
+	Product   string    `bson:"product" json:"product"`
+	CreatedAt time.Time `bson:"created_at" json:"created_at"`
+	// example: 123.123.123.123:9200
+	RootUrl string `bson:"rootUrl,omitempty" json:"rootUrl"`
+	// none, basic, apikey or bearer. see -creds
+	AuthMode      string `bson:"authMode,omitempty" json:"authMode"`
+	IsInitialized bool   `bson:"isInitialized,omitempty" json:"isInitialized"`
+	// only stores indices of interesting names
+	Indices                      []InterestingIndexInfo `bson:"indices,omitempty" json:"indices"`
+	HasAtLeastOneIndexSizeOverGB bool                   `bson:"hasAtLeastOneIndexSizeOverGB,omitempty" json:"hasAtLeastOneIndexSizeOverGB"`
+	// sums of store.size and docs.count of all indices, including uninteresting ones
+	TotalStoreSizeBytes int64 `bson:"totalStoreSizeBytes,omitempty" json:"totalStoreSizeBytes"`
+	TotalDocsCount      int64 `bson:"totalDocsCount,omitempty" json:"totalDocsCount"`
+	// why no index was requested, like "has fewer docs than -min-total-docs 100". empty if indices were requested
+	SkippedReason string `bson:"skippedReason,omitempty" json:"skippedReason"`
+	// what kind of instance it looks like from all of its indices, like ransomed or honeypot. nil if nothing in particular
+	Classification *EPUtils.InstanceClassification `bson:"classification,omitempty" json:"classification"`
+	// ransom notes found on the instance. nil if it does not look compromised
+	Compromise *Compromise `bson:"compromise,omitempty" json:"compromise"`
+	// index name -> search result. written from multiple goroutines while scanning
+	IndicesInfo sync.Map `bson:"-" json:"-"`
+	// sync.Map can't be (un)marshalled. filled from IndicesInfo right before output
+	IndicesInfoInJson map[string]interface{}          `bson:"indicesInfoInJson,omitempty" json:"indicesInfoInJson"`
+	InterestingWords  []string                        `bson:"interestingWords,omitempty" json:"interestingWords"`
+	InterestingInfo   *InterestingInfoFromIndexSearch `bson:"interestingInfo,omitempty" json:"interestingInfo"`
+	// indices whose search result was cut off at -max-response-size.
+	// indicesInfoInJson only has the hits received before the cut off for these
+	TruncatedIndices []string `bson:"truncatedIndices,omitempty" json:"truncatedIndices"`
+}
+
+// ScanResult is implemented by every product-specific scan result through the embedded InstanceScanResult
+type ScanResult interface {
+	GetInstanceScanResult() *InstanceScanResult
+}
+
+func (instanceScanResult *InstanceScanResult) GetInstanceScanResult() *InstanceScanResult {
+	return instanceScanResult
+}
+
+func newInstanceScanResult(product string, rootUrl string) InstanceScanResult {
+	return InstanceScanResult{
+		SchemaVersion: SCAN_RESULT_SCHEMA_VERSION,
+		Id:            primitive.NewObjectID(),
+		Product:       product,
+		CreatedAt:     time.Now(),
+		RootUrl:       rootUrl,
+	}
+}
+
+// call this only after all goroutines writing to IndicesInfo are done
+func (instanceScanResult *InstanceScanResult) fillIndicesInfoInJson() {
+	instanceScanResult.IndicesInfoInJson = EPUtils.ConvertSyncMapToMap(&instanceScanResult.IndicesInfo)
+}
+
+// stores the interesting ones of indices from _cat/indices, the total size of all of them,
+// and the classification of the instance and its ransom note indices judged from all of them.
+// clusterInfo is nil if the root URL of the instance was not requested, like for kibana
+func (instanceScanResult *InstanceScanResult) setIndices(indices []IndexInfo, clusterInfo *ClusterInfo) {
+	instanceScanResult.TotalStoreSizeBytes, instanceScanResult.TotalDocsCount = 0, 0
+	for i := range indices {
+		parseIndexSizes(&indices[i].InterestingIndexInfo)
+		if bytes := indices[i].StoreSizeBytes; bytes != nil {
+			instanceScanResult.TotalStoreSizeBytes += *bytes
+		}
+		if docsCount := indices[i].DocsCountNumber; docsCount != nil {
+			instanceScanResult.TotalDocsCount += *docsCount
+		}
+	}
+	instanceScanResult.Indices = ProcessInterestingIndices(indices)
+	// scored again with the sensitive fields of their mappings before they are searched
+	for i := range instanceScanResult.Indices {
+		scoreIndex(&instanceScanResult.Indices[i])
+	}
+	instanceScanResult.HasAtLeastOneIndexSizeOverGB = CheckOverGBIndexExistence(instanceScanResult.Indices)
+
+	instanceScanResult.Compromise = newCompromise(indices)
+	instanceScanResult.Classification = classifyInstance(indices, clusterInfo)
+	if classification := instanceScanResult.Classification; classification != nil {
+		EPUtils.EPLogger(fmt.Sprintf("%s is classified as %s (confidence %.2f) because of %s", instanceScanResult.RootUrl, classification.Label, classification.Confidence, strings.Join(classification.Evidence, ", ")))
+	}
+}
+
+// classifies an instance with the framework indices of the rules in use
+func classifyInstance(indices []IndexInfo, clusterInfo *ClusterInfo) *EPUtils.InstanceClassification {
+	facts := &EPUtils.InstanceFacts{}
+	for _, index := range indices {
+		facts.Indices = append(facts.Indices, EPUtils.IndexFacts{
+			Name:           index.Index,
+			DocsCount:      index.DocsCountNumber,
+			StoreSizeBytes: index.StoreSizeBytes,
+		})
+	}
+	if clusterInfo != nil {
+		facts.VersionNumber = clusterInfo.VersionNumber
+		facts.NodeName = clusterInfo.NodeName
+	}
+
+	return EPUtils.ClassifyInstance(facts, getIndexRules().UninterestingIfAllOfTheseInIndices)
+}
@@ -1,17 +1,17 @@
 package EPPlugins
 
 import (
+	"context"
 	"encoding/json"
+	"flag"
 	"fmt"
+	"io"
 	"strings"
 	"sync"
 	"time"
 
 	EPLookup_addrs "github.com/9oelM/elasticpwn/elasticpwn/lookup-addrs"
 	EPUtils "github.com/9oelM/elasticpwn/elasticpwn/util"
-
-	"go.mongodb.org/mongo-driver/bson/primitive"
-	"go.mongodb.org/mongo-driver/mongo"
 )
 
 // Scraps data from an open Kibana instance using webdriver
@@ -23,6 +23,138 @@ type KibanaPlugin struct {
 	MongoUrl       string
 	MaxIndices     int
 	MaxIndexSize   int
+	// number of indices of a single instance requested concurrently
+	IndexThreadsNum int
+	// seconds to wait for in-flight hosts to finish after interruption
+	GracePeriod int
+	// path to a checkpoint file. empty if not resuming
+	ResumeFilePath string
+	// path to a rules file. empty if only the built-in rules are used
+	RulesFilePath string
+	// if true, IpInfo is not looked up
+	SkipIpInfo bool
+	HTTPClientFlags
+	IndexSizeFlags
+
+	checkpoint *EPUtils.Checkpoint
+	httpClient *EPUtils.HTTPClient
+	// nil if -creds is not set
+	credentials *EPUtils.CredentialsFile
+
+	urls        *scanUrls
+	outputSinks OutputSinks
+}
+
+func init() {
+	RegisterPlugin(&KibanaPlugin{})
+}
+
+func (kp *KibanaPlugin) Name() string {
+	return "kibana"
+}
+
+func (kp *KibanaPlugin) Example() string {
+	return "elasticpwn kibana -t=40 -om=json -f=urls.txt"
+}
+
+// kibana plugin has the same options as elasticserach plugin right now,
+// but differences in their behaviors may always make the different, so leave it as it is.
+func (kp *KibanaPlugin) DefineFlags(fs *flag.FlagSet) {
+	fs.StringVar(&kp.InputFilePath, "f", "", INPUT_FILE_FLAG_USAGE)
+	fs.IntVar(&kp.ThreadsNum, "t", 8, "[OPTIONAL] number of threads when running a plugin")
+	fs.StringVar(&kp.OutputMode, "om", "json", `[OPTIONAL] output mode. json|jsonl|mongo|plain|sqlite. 
+	Multiple modes can be separated by commas, like json,mongo.
+	mongo option will require a mongo server to be up.
+	jsonl mode will output a JSON object per line, which stays valid even if the scan crashes.
+	plain mode will output json-like object to each line finishing with a comma. 
+	sqlite mode will write normalized tables (instances, indices, extracted_values, ...) into the sqlite database given by -of.
+For mongo, local docker mongo instance is recommneded. (check docker-compose.yml and docs)`)
+	fs.StringVar(&kp.OutputFilePath, "of", "kibana.json", "[OPTIONAL] output file name. Ignored when mongo is the only output mode chosen.\n- writes results to stdout (jsonl and plain only), and logs to stderr.")
+	fs.StringVar(&kp.MongoUrl, "murl", DEFAULT_MONGO_URL, `[OPTIONAL] needed only when -o=mongo is selected. 
+mongodb url with username and pw included.
+Note that 172.17.0.1 is usually default docker host IP. You may want to change this.
+`)
+	// some instances have very many indices, and probably your hard drive will explode if you fetch all
+	fs.IntVar(&kp.MaxIndices, "max-i", 5, `maximum number of indices to request. 
+Indices with the highest scores are requested first. See scoreReason of each index for why.
+If you intend to set this as a high number, make sure you've got enough storage. 
+If you don't know what an index is, 
+refer to elasticserach docs at 
+https://www.elastic.co/blog/what-is-an-elasticsearch-index`)
+	// will return 'X' hits from the index
+	fs.IntVar(&kp.MaxIndexSize, "max-is", 70, `maximum size of an index to request. 
+If you intend to set this as a high number, make sure you've got enough storage.
+If you don't know what 'size' is, please refer to elasticsearch docs on
+'<endpoint>/_cat/_search?size=' at 
+https://www.elastic.co/guide/en/elasticsearch/reference/current/search-search.html`)
+	fs.IntVar(&kp.IndexThreadsNum, "index-t", DEFAULT_INDEX_THREADS, INDEX_THREADS_FLAG_USAGE)
+	fs.IntVar(&kp.GracePeriod, "grace", DEFAULT_GRACE_PERIOD_SECS, GRACE_PERIOD_FLAG_USAGE)
+	fs.StringVar(&kp.ResumeFilePath, "resume", "", RESUME_FLAG_USAGE)
+	fs.StringVar(&kp.RulesFilePath, "rules", "", RULES_FLAG_USAGE)
+	fs.BoolVar(&kp.SkipIpInfo, "skip-ip-info", false, `[OPTIONAL] do not look up ipInfo of each instance.
+Its certificate is requested like any other request, and its reverse DNS and CNAME are looked up
+with the resolver of the system, unless -proxy is set`)
+	kp.HTTPClientFlags.DefineFlags(fs)
+	kp.IndexSizeFlags.DefineFlags(fs)
+}
+
+func (kp *KibanaPlugin) Validate() bool {
+	logToStderrIfOutputIsStdout(kp.OutputFilePath)
+	needsExit := EPUtils.ValidateStringFlag(
+		kp.InputFilePath,
+		"",
+		"-f",
+	) ||
+		EPUtils.ValidatePositiveInt(
+			kp.ThreadsNum,
+			"-t",
+		) ||
+		EPUtils.ValidatePositiveInt(
+			kp.MaxIndexSize,
+			"-max-is",
+		) ||
+		EPUtils.ValidatePositiveInt(
+			kp.MaxIndices,
+			"-max-i",
+		) ||
+		EPUtils.ValidatePositiveInt(
+			kp.IndexThreadsNum,
+			"-index-t",
+		) ||
+		EPUtils.ValidatePositiveInt(
+			kp.GracePeriod,
+			"-grace",
+		) ||
+		kp.HTTPClientFlags.Validate() ||
+		kp.IndexSizeFlags.Validate() ||
+		validateRulesFile(kp.RulesFilePath)
+
+	return ValidateOutputFlags(
+		kp.OutputMode,
+		kp.OutputFilePath,
+		"kibana.json",
+		kp.MongoUrl,
+	) || needsExit
+}
+
+func (kp *KibanaPlugin) Prepare() {
+	kp.checkpoint = PrepareResume(kp.ResumeFilePath)
+	EPUtils.ExitOnError(useRulesFile(kp.RulesFilePath))
+	kp.urls = openScanUrls(kp.InputFilePath, kp.checkpoint)
+	httpClient, err := kp.HTTPClientFlags.NewHTTPClient()
+	EPUtils.ExitOnError(err)
+	kp.httpClient = httpClient
+	kp.credentials, err = kp.HTTPClientFlags.LoadCredentials()
+	EPUtils.ExitOnError(err)
+	outputSinks, err := NewOutputSinks(OutputSinkOptions{
+		OutputMode:     kp.OutputMode,
+		OutputFilePath: kp.OutputFilePath,
+		MongoUrl:       kp.MongoUrl,
+		CollectionName: kp.Name(),
+	})
+	EPUtils.ExitOnError(err)
+	EPUtils.ExitOnError(outputSinks.Open())
+	kp.outputSinks = outputSinks
 }
 
 type IpInfo struct {
@@ -35,22 +167,8 @@ type IpInfo struct {
 
 // The interesting data that was stored in a single Kibana instance
 type SingleKibanaInstanceScanResult struct {
-	CreatedAt time.Time          `bson:"created_at" json:"created_at"`
-	Id        primitive.ObjectID `bson:"_id,omitempty" json:"_id"`
-
-	// indices string
-	IsInitialized bool `bson:"isInitialized,omitempty" json:"isInitialized"`
-	// example: 123.123.123.123:5000
-	RootUrl                      string `bson:"rootUrl,omitempty" json:"rootUrl"`
-	IpInfo                       *IpInfo
-	HasAtLeastOneIndexSizeOverGB bool `bson:"hasAtLeastOneIndexSizeOverGB,omitempty" json:"hasAtLeastOneIndexSizeOverGB"`
-	// only stores indices of interesting names
-	Indices     []InterestingIndexInfo `bson:"indices,omitempty" json:"indices"`
-	IndicesInfo sync.Map
-	// sync.Map can't be (un)marshalled
-	IndicesInfoInJson map[string]interface{}          `bson:"indicesInfoInJson,omitempty" json:"indicesInfoInJson"`
-	InterestingWords  []string                        `bson:"interestingWords,omitempty" json:"interestingWords"`
-	InterestingInfo   *InterestingInfoFromIndexSearch `bson:"interestingInfo,omitempty" json:"interestingInfo"`
+	InstanceScanResult `bson:",inline"`
+	IpInfo             *IpInfo `bson:"ipInfo,omitempty" json:"ipInfo"`
 }
 
 type KibanaRequests struct {
@@ -61,8 +179,9 @@ type KibanaRequests struct {
 const CONSOLE_PATH = "app/kibana#/dev_tools/console?_g=()"
 
 type KibanaGetRequests struct {
-	indices     string
-	indexSearch string
+	indices      string
+	indexSearch  string
+	indexMapping string
 }
 
 // some versions have slightly different APIs
@@ -74,8 +193,9 @@ type KibanaAPI struct {
 // 5.2.1
 var kibanaVer5_2_1 = &KibanaAPI{
 	get: &KibanaGetRequests{
-		indices:     "api/console/proxy?uri=_cat%2Findices%3Fformat%3Djson",
-		indexSearch: "api/console/proxy?uri={INDEX_NAME}%2F_search%3Fformat%3Djson%26size%3D{INDEX_SIZE}",
+		indices:      "api/console/proxy?uri=_cat%2Findices%3Fformat%3Djson",
+		indexSearch:  "api/console/proxy?uri={INDEX_NAME}%2F_search%3Fformat%3Djson%26size%3D{INDEX_SIZE}",
+		indexMapping: "api/console/proxy?uri={INDEX_NAME}%2F_mapping",
 	},
 }
 
@@ -87,8 +207,9 @@ var kibanaVer5_2_1 = &KibanaAPI{
 var kibanaVer7_15_0 = &KibanaAPI{
 	get: &KibanaGetRequests{
 		//  "api/console/proxy?path=%2F_cat%2Findices%3Fformat%3Djson&method=GET"
-		indices:     "api/console/proxy?path=%2F_cat%2Findices%3Fformat%3Djson&method=GET",
-		indexSearch: "api/console/proxy?path=%2F{INDEX_NAME}%2F_search%3Fformat%3Djson%26size%3D{INDEX_SIZE}&method=GET",
+		indices:      "api/console/proxy?path=%2F_cat%2Findices%3Fformat%3Djson&method=GET",
+		indexSearch:  "api/console/proxy?path=%2F{INDEX_NAME}%2F_search%3Fformat%3Djson%26size%3D{INDEX_SIZE}&method=GET",
+		indexMapping: "api/console/proxy?path=%2F{INDEX_NAME}%2F_mapping&method=GET",
 	},
 }
 
@@ -99,6 +220,44 @@ func (kpAPI *KibanaAPI) buildKibanaIndexSearchAPI(rootUrl string, indexName stri
 	return fmt.Sprintf("%s/%s", rootUrl, builtAPI)
 }
 
+func (kpAPI *KibanaAPI) buildKibanaIndexMappingAPI(rootUrl string, indexName string) string {
+	return fmt.Sprintf("%s/%s", rootUrl, strings.Replace(kpAPI.get.indexMapping, `{INDEX_NAME}`, indexName, 1))
+}
+
+// returns the response of /<index>/_mapping through the console proxy, or false if there was none.
+// indexNames may be several names joined with commas
+func (kp *KibanaPlugin) getIndexMapping(ctx context.Context, rootUrl string, headers map[string]string, indexNames string) (string, bool) {
+	for _, kibanaAPI := range []*KibanaAPI{kibanaVer7_15_0, kibanaVer5_2_1} {
+		method := "GET"
+		if kibanaAPI == kibanaVer7_15_0 {
+			// recent versions of kibana has this weird system where you need to POST in order to GET through proxy
+			method = "POST"
+		}
+		resp, statusCode, err := kp.httpClient.SendFailSafeHTTPRequest(ctx, kibanaAPI.buildKibanaIndexMappingAPI(rootUrl, indexNames), false, headers, method)
+		if err == nil && statusCode == 200 {
+			return resp, true
+		}
+	}
+
+	return "", false
+}
+
+// returns the response of /<index>/_search with MAX_RANSOM_NOTE_DOCS documents through the console proxy, or false if there was none
+func (kp *KibanaPlugin) getRansomNote(ctx context.Context, rootUrl string, headers map[string]string, indexName string) (string, bool) {
+	for _, kibanaAPI := range []*KibanaAPI{kibanaVer7_15_0, kibanaVer5_2_1} {
+		method := "GET"
+		if kibanaAPI == kibanaVer7_15_0 {
+			method = "POST"
+		}
+		resp, statusCode, err := kp.httpClient.SendFailSafeHTTPRequest(ctx, kibanaAPI.buildKibanaIndexSearchAPI(rootUrl, indexName, MAX_RANSOM_NOTE_DOCS), false, headers, method)
+		if err == nil && statusCode == 200 {
+			return resp, true
+		}
+	}
+
+	return "", false
+}
+
 var kibanaHeader = map[string]string{
 	// kibana requires this useless header to be set: https://discuss.elastic.co/t/where-can-i-get-the-correct-kbn-xsrf-value-for-my-plugin-http-requests/158725
 	"kbn-xsrf":     "_",
@@ -107,18 +266,28 @@ var kibanaHeader = map[string]string{
 	"Accept":       "*/*",
 }
 
+// opensearch dashboards forked kibana 7.10.2 and renamed kbn-xsrf to osd-xsrf.
+// the console proxy is the same otherwise
+var dashboardsHeader = map[string]string{
+	"osd-xsrf":     "true",
+	"Content-Type": "application/json",
+	"User-Agent":   "curl/7.0.0",
+	"Accept":       "*/*",
+}
+
 // to see if we need to abort early because the instance is not up at all
 // returns true if unhealthy
-func (kp *KibanaPlugin) checkIsInstanceDown(rootUrl string) bool {
-	// you need to insert kibana headers even for the index page
-	anything, statusCode, _ := EPUtils.SendFailSafeHTTPRequest(rootUrl, 15, false, kibanaHeader, "GET")
+func (kp *KibanaPlugin) checkIsInstanceDown(ctx context.Context, rootUrl string, headers map[string]string) bool {
+	// you need to insert kibana headers even for the index page.
+	// most of the instances in the list are down, so don't waste time retrying them
+	anything, statusCode, _ := kp.httpClient.SendFailSafeHTTPRequest(ctx, rootUrl, true, headers, "GET")
 
 	return anything == "" && statusCode != 200
 }
 
 // returns nil if could not get indices
-func (kp *KibanaPlugin) getIndices(rootUrl string) []IndexInfo {
-	EPUtils.EPLogger(fmt.Sprintf("%v has a working Kibana frontend", rootUrl))
+func (kp *KibanaPlugin) getIndices(ctx context.Context, rootUrl string, headers map[string]string) []IndexInfo {
+	EPUtils.EPLogger(fmt.Sprintf("%v has a working frontend", rootUrl))
 
 	var indicesArray []IndexInfo
 	allPossibleGetIndicesRequests := []string{
@@ -132,12 +301,12 @@ func (kp *KibanaPlugin) getIndices(rootUrl string) []IndexInfo {
 		case strings.HasSuffix(req, kibanaVer7_15_0.get.indices):
 			{
 				// recent versions of kibana has this weird system where you need to POST in order to GET through proxy
-				indicesArrayInJsonString, statusCode, _ = EPUtils.SendFailSafeHTTPRequest(req, 15, false, kibanaHeader, "POST")
+				indicesArrayInJsonString, statusCode, _ = kp.httpClient.SendFailSafeHTTPRequest(ctx, req, false, headers, "POST")
 				break
 			}
 		case strings.HasSuffix(req, kibanaVer5_2_1.get.indices):
 			{
-				indicesArrayInJsonString, statusCode, _ = EPUtils.SendFailSafeHTTPRequest(req, 15, false, kibanaHeader, "GET")
+				indicesArrayInJsonString, statusCode, _ = kp.httpClient.SendFailSafeHTTPRequest(ctx, req, false, headers, "GET")
 				break
 			}
 		}
@@ -155,61 +324,65 @@ func (kp *KibanaPlugin) getIndices(rootUrl string) []IndexInfo {
 }
 
 func (kp *KibanaPlugin) scanInterestingIndices(
-	singleKibanaInstanceScanResult *SingleKibanaInstanceScanResult,
+	ctx context.Context,
+	headers map[string]string,
+	instanceScanResult *InstanceScanResult,
 ) {
 	wg := sync.WaitGroup{}
-	// setting this number high will likely cause a panic (too many files open) and high memory usage
-	// because there could be many indices
-	concurrentGoroutines := make(chan struct{}, 5)
+	// see DEFAULT_INDEX_THREADS before raising -index-t
+	concurrentGoroutines := make(chan struct{}, kp.IndexThreadsNum)
 	mu := &sync.Mutex{}
 
-	maxIndicesNum := kp.MaxIndices
-	if len(singleKibanaInstanceScanResult.Indices) <= maxIndicesNum {
-		maxIndicesNum = len(singleKibanaInstanceScanResult.Indices)
-	}
-
 	// some low versions of kibana do not support /mget method (request multiple indices with one call), so just request each index respectively
-	for _, indexInfo := range singleKibanaInstanceScanResult.Indices[:maxIndicesNum] {
+	for _, indexInfo := range selectIndicesToSearch(instanceScanResult, kp.MaxIndices, &kp.IndexSizeFlags) {
 		wg.Add(1)
 
 		go func(indexInfo InterestingIndexInfo) {
 			defer wg.Done()
 			concurrentGoroutines <- struct{}{}
 
-			var indexInfoObject map[string]interface{}
 			allPossibleGetIndexSearchRequests := []string{
-				kibanaVer7_15_0.buildKibanaIndexSearchAPI(singleKibanaInstanceScanResult.RootUrl, indexInfo.Index, kp.MaxIndexSize),
-				kibanaVer5_2_1.buildKibanaIndexSearchAPI(singleKibanaInstanceScanResult.RootUrl, indexInfo.Index, kp.MaxIndexSize),
+				kibanaVer7_15_0.buildKibanaIndexSearchAPI(instanceScanResult.RootUrl, indexInfo.Index, kp.MaxIndexSize),
+				kibanaVer5_2_1.buildKibanaIndexSearchAPI(instanceScanResult.RootUrl, indexInfo.Index, kp.MaxIndexSize),
 			}
 			for _, req := range allPossibleGetIndexSearchRequests {
-				var indexInfoObjectInJsonString string
-				var statusCode int
+				var indexSearchResult *IndexSearchResult
+				// decoded as it streams in. keep -max-response-size reasonably low, otherwise will cause memory usage spike in low-end machines
+				decodeIndexSearchResult := func(statusCode int, body io.Reader) error {
+					if statusCode == 404 {
+						return nil
+					}
+					var decodeErr error
+					indexSearchResult, decodeErr = DecodeIndexSearchResult(body)
+
+					return decodeErr
+				}
+				var (
+					isTruncated bool
+					decodeErr   error
+				)
 				switch req {
 				case allPossibleGetIndexSearchRequests[0]:
 					{
 						// recent versions of kibana has this weird system where you need to POST in order to GET through proxy
-						// keep timeout reasonably low, otherwise will cause memory usage spike in low-end machines
-						indexInfoObjectInJsonString, statusCode, _ = EPUtils.SendFailSafeHTTPRequest(req, 30, false, kibanaHeader, "POST")
+						_, isTruncated, decodeErr = kp.httpClient.SendFailSafeHTTPRequestStreaming(ctx, req, false, headers, "POST", decodeIndexSearchResult)
 
 						break
 					}
 				case allPossibleGetIndexSearchRequests[1]:
 					{
-						indexInfoObjectInJsonString, statusCode, _ = EPUtils.SendFailSafeHTTPRequest(req, 30, false, kibanaHeader, "GET")
+						_, isTruncated, decodeErr = kp.httpClient.SendFailSafeHTTPRequestStreaming(ctx, req, false, headers, "GET", decodeIndexSearchResult)
 
 						break
 					}
 				}
 
-				jsonUnmarshalErr := json.Unmarshal([]byte(indexInfoObjectInJsonString), &indexInfoObject)
-
-				if jsonUnmarshalErr == nil && strings.TrimSpace(indexInfoObjectInJsonString) != "" && statusCode != 404 {
-					singleKibanaInstanceScanResult.IndicesInfo.Store(indexInfo.Index, indexInfoObject)
-
-					ProcessInterestingInfoAndWordsThreadSafely(mu, singleKibanaInstanceScanResult, indexInfoObjectInJsonString)
+				if indexSearchResult != nil && (decodeErr == nil || isTruncated) {
+					if isTruncated {
+						EPUtils.EPLogger(fmt.Sprintf("Result from %s was cut off at -max-response-size. Keeping hits received before the cut off", req))
+					}
+					ProcessIndexSearchResultThreadSafely(mu, instanceScanResult, indexInfo.Index, indexSearchResult, isTruncated)
 					break
-				} else {
-					indexInfoObject = nil
 				}
 			}
 
@@ -220,92 +393,84 @@ func (kp *KibanaPlugin) scanInterestingIndices(
 	wg.Wait()
 }
 
-// rootUrl example: 123.123.123.123:5601
-func (kp *KibanaPlugin) scanSingleKibanaInstance(rootUrl string) *SingleKibanaInstanceScanResult {
-	singleKibanaInstanceScanResult := &SingleKibanaInstanceScanResult{
-		IsInitialized: false,
-		RootUrl:       rootUrl,
-		Id:            primitive.NewObjectID(),
-		CreatedAt:     time.Now(),
-		IndicesInfo:   sync.Map{},
-	}
-
-	isInstanceDown := kp.checkIsInstanceDown(rootUrl)
+// scans rootUrl through the console proxy of kibana or opensearch dashboards,
+// which forwards requests to the elasticsearch (or opensearch) cluster behind it.
+// headers are kibanaHeader or dashboardsHeader, with credentials if any
+func (kp *KibanaPlugin) scanThroughConsoleProxy(ctx context.Context, rootUrl string, headers map[string]string, instanceScanResult *InstanceScanResult) {
+	isInstanceDown := kp.checkIsInstanceDown(ctx, rootUrl, headers)
 	if isInstanceDown {
 		EPUtils.EPLogger(fmt.Sprintf("%v is down\n", rootUrl))
 
-		return singleKibanaInstanceScanResult
+		return
 	}
 
-	allIndices := kp.getIndices(rootUrl)
+	allIndices := kp.getIndices(ctx, rootUrl, headers)
 	if allIndices == nil {
 		EPUtils.EPLogger(fmt.Sprintf("Failed to get indices from %v\n", rootUrl))
-		return singleKibanaInstanceScanResult
+		return
 	}
 
-	interestingIndices := ProcessInterestingIndices(allIndices)
-	if interestingIndices == nil {
+	instanceScanResult.setIndices(allIndices, nil)
+	// ransom note indices are uninteresting, and are read even if the instance is skipped by its size
+	readRansomNotes(instanceScanResult, func(indexName string) (string, bool) {
+		return kp.getRansomNote(ctx, rootUrl, headers, indexName)
+	})
+	if instanceScanResult.Indices == nil {
 		EPUtils.EPLogger(fmt.Sprintf("Failed to get interesting indices from %v\n", rootUrl))
-		return singleKibanaInstanceScanResult
+		return
+	}
+	instanceScanResult.IsInitialized = true
+	if skipReason := kp.IndexSizeFlags.instanceSkipReason(instanceScanResult); skipReason != "" {
+		EPUtils.EPLogger(fmt.Sprintf("Skipping indices of %s because it %s", rootUrl, skipReason))
+		instanceScanResult.SkippedReason = skipReason
+		return
 	}
-	singleKibanaInstanceScanResult.HasAtLeastOneIndexSizeOverGB = CheckOverGBIndexExistence(interestingIndices)
-	singleKibanaInstanceScanResult.IsInitialized = true
 
-	singleKibanaInstanceScanResult.Indices = interestingIndices
+	findSensitiveFieldsOfIndices(instanceScanResult, &kp.IndexSizeFlags, kp.IndexThreadsNum, func(indexNames string) (string, bool) {
+		return kp.getIndexMapping(ctx, rootUrl, headers, indexNames)
+	})
+	kp.scanInterestingIndices(ctx, headers, instanceScanResult)
+}
+
+// rootUrl example: 123.123.123.123:5601
+func (kp *KibanaPlugin) scanSingleKibanaInstance(ctx context.Context, rootUrl string) *SingleKibanaInstanceScanResult {
+	singleKibanaInstanceScanResult := &SingleKibanaInstanceScanResult{
+		InstanceScanResult: newInstanceScanResult(kp.Name(), rootUrl),
+	}
 
-	kp.scanInterestingIndices(singleKibanaInstanceScanResult)
+	// kibana forwards the Authorization header through the console proxy to elasticsearch
+	headers, authMode := authenticate(ctx, kp.httpClient, kp.credentials, rootUrl, kibanaHeader)
+	singleKibanaInstanceScanResult.AuthMode = authMode
+	kp.scanThroughConsoleProxy(ctx, rootUrl, headers, &singleKibanaInstanceScanResult.InstanceScanResult)
 
 	return singleKibanaInstanceScanResult
 }
 
-var kibanaPluginFileWriteMutex sync.Mutex
-
 func (kp *KibanaPlugin) outputSingleKibanaInstanceScanResult(
+	ctx context.Context,
 	singleKibanaInstanceScanResult *SingleKibanaInstanceScanResult,
-	kibanaCollection *mongo.Collection,
-) {
-	indicesInfoMap := EPUtils.ConvertSyncMapToMap(singleKibanaInstanceScanResult.IndicesInfo)
-	singleKibanaInstanceScanResult.IndicesInfoInJson = indicesInfoMap
-
-	singleKibanaInstanceScanResultMarshalled, singleKibanaInstanceScanResultMarshalErr := json.Marshal(singleKibanaInstanceScanResult)
+) error {
+	singleKibanaInstanceScanResult.fillIndicesInfoInJson()
 
-	if singleKibanaInstanceScanResultMarshalErr != nil {
-		EPUtils.EPLogger(fmt.Sprintf("Failed to marshall scan result for %v", singleKibanaInstanceScanResult.RootUrl))
-
-		return
-	}
-
-	switch kp.OutputMode {
-	case "json", "plain":
-		{
-			AppendScanResultToJSONFileWithNewline(kp.OutputFilePath, singleKibanaInstanceScanResultMarshalled, &kibanaPluginFileWriteMutex)
-		}
-	case "mongo":
-		{
-			if kibanaCollection == nil {
-				panic("mongo option was given, but collection is nil")
-			}
-			InsertSingleScanResultToMongo(kibanaCollection, singleKibanaInstanceScanResult, singleKibanaInstanceScanResult.RootUrl)
-		}
-	default:
-		{
-			panic(fmt.Sprintf("Unrecognized output mode: %v", kp.OutputMode))
-		}
-	}
+	return kp.outputSinks.Write(ctx, singleKibanaInstanceScanResult)
 }
 
-func (kp *KibanaPlugin) scanKibanaInstanceAndIpInfo(url string) *SingleKibanaInstanceScanResult {
+func (kp *KibanaPlugin) scanKibanaInstanceAndIpInfo(ctx context.Context, url string) *SingleKibanaInstanceScanResult {
 	singleKibanaInstanceScanResultChan := make(chan *SingleKibanaInstanceScanResult)
 	ipInfoChan := make(chan *IpInfo)
 	wg := sync.WaitGroup{}
 	wg.Add(1)
 	go func(url string) {
-		singleKibanaInstanceScanResult := kp.scanSingleKibanaInstance(url)
+		singleKibanaInstanceScanResult := kp.scanSingleKibanaInstance(ctx, url)
 		singleKibanaInstanceScanResultChan <- singleKibanaInstanceScanResult
 	}(url)
 	wg.Add(1)
 	go func(url string) {
-		cloudHostingProvider, subjectUrls, organizations, cname := EPLookup_addrs.GetIpInfo(url)
+		if kp.SkipIpInfo {
+			ipInfoChan <- nil
+			return
+		}
+		cloudHostingProvider, subjectUrls, organizations, cname := EPLookup_addrs.GetIpInfo(ctx, kp.httpClient, url)
 		ipInfoChan <- &IpInfo{
 			CloudHostingProvider: cloudHostingProvider,
 			SubjectUrls:          subjectUrls,
@@ -319,35 +484,46 @@ func (kp *KibanaPlugin) scanKibanaInstanceAndIpInfo(url string) *SingleKibanaIns
 	return singleKibanaInstanceScanResult
 }
 
-func (kp *KibanaPlugin) Run(urls []string, kibanaCollection *mongo.Collection) {
+// stops scheduling new URLs as soon as ctx is cancelled,
+// and gives in-flight URLs -grace seconds to finish before cancelling their requests too.
+func (kp *KibanaPlugin) Run(ctx context.Context) {
+	watchRulesFile(ctx, kp.RulesFilePath)
+	urls := kp.urls.Stream(ctx)
+	scanCtx, cancelScan := EPUtils.WithGracePeriod(ctx, time.Duration(kp.GracePeriod)*time.Second)
+	defer cancelScan()
+
 	wg := sync.WaitGroup{}
 	concurrentGoroutines := make(chan struct{}, kp.ThreadsNum)
 	var finishedGoRoutineCount EPUtils.Count32
+	var outOfScopeCount EPUtils.Count32
+
+	stopProgressLogger := EPUtils.LogProgressPeriodically(time.Duration(1*time.Second), func() string {
+		return kp.urls.progress(finishedGoRoutineCount.Get())
+	})
+	scheduledUrlsCount := EPUtils.ScheduleWhileNotCancelled(ctx, urls, concurrentGoroutines, &wg, func(url string) {
+		// also counts urls out of scope and scans discarded after the grace period
+		defer finishedGoRoutineCount.Inc()
+		if !checkScope(scanCtx, kp.httpClient, url, &outOfScopeCount) {
+			return
+		}
+		singleKibanaInstanceScanResult := kp.scanKibanaInstanceAndIpInfo(scanCtx, url)
+		if scanCtx.Err() != nil {
+			EPUtils.EPLogger(fmt.Sprintf("Scan of %s did not finish within the grace period. Discarding partial result.\n", url))
+			return
+		}
 
-	for _, url := range urls {
-		wg.Add(1)
-		go func(url string) {
-			defer wg.Done()
-			concurrentGoroutines <- struct{}{}
-			singleKibanaInstanceScanResult := kp.scanKibanaInstanceAndIpInfo(url)
-
-			kp.outputSingleKibanaInstanceScanResult(singleKibanaInstanceScanResult, kibanaCollection)
-			finishedGoRoutineCount.Inc()
-			<-concurrentGoroutines
-		}(url)
-	}
-	go func() {
-		for {
-			time.Sleep(time.Duration(1 * time.Second))
-			EPUtils.EPLogger(fmt.Sprintf("%d/%d of URLs completed\n", finishedGoRoutineCount.Get(), len(urls)))
+		outputErr := kp.outputSingleKibanaInstanceScanResult(scanCtx, singleKibanaInstanceScanResult)
+		if outputErr == nil {
+			markScanCompleted(kp.checkpoint, url, singleKibanaInstanceScanResult.IsInitialized)
 		}
-	}()
+	})
 	wg.Wait()
+	stopProgressLogger()
+	logOutOfScopeCount(outOfScopeCount.Get())
+	kp.urls.logScanEnd(scheduledUrlsCount)
 }
 
 func (kp *KibanaPlugin) PostProcess() {
-	if kp.OutputMode != "json" {
-		return
-	}
-	EPUtils.ConvertJSONObjectsToJSONArray(kp.OutputFilePath)
+	closeCheckpoint(kp.checkpoint)
+	closeOutputSinks(kp.outputSinks)
 }
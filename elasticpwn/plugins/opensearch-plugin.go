@@ -0,0 +1,167 @@
+package EPPlugins
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	EPUtils "github.com/9oelM/elasticpwn/elasticpwn/util"
+)
+
+// Scans opensearch clusters and opensearch dashboards.
+// opensearch forked elasticsearch 7.10.2 and dashboards forked kibana 7.10.2,
+// so this is the elasticsearch plugin, plus the security plugin of opensearch
+// and the console proxy of dashboards for URLs that are not a cluster.
+type OpenSearchPlugin struct {
+	*ElasticSearchPlugin
+
+	// scans dashboards through their console proxy. shares the flags and the http client of the plugin
+	dashboards *KibanaPlugin
+}
+
+func init() {
+	openSearchPlugin := &OpenSearchPlugin{ElasticSearchPlugin: newElasticSearchPlugin("opensearch")}
+	openSearchPlugin.scanInstance = openSearchPlugin.scanSingleOpenSearchInstance
+	RegisterPlugin(openSearchPlugin)
+}
+
+func (openSearchPlugin *OpenSearchPlugin) Prepare() {
+	openSearchPlugin.ElasticSearchPlugin.Prepare()
+	openSearchPlugin.dashboards = &KibanaPlugin{
+		MaxIndices:      openSearchPlugin.EsPluginMaxIndices,
+		MaxIndexSize:    openSearchPlugin.EsPluginMaxIndexSize,
+		IndexThreadsNum: openSearchPlugin.IndexThreadsNum,
+		IndexSizeFlags:  openSearchPlugin.IndexSizeFlags,
+		httpClient:      openSearchPlugin.httpClient,
+	}
+}
+
+// values of SingleOpenSearchInstanceScanResult.Component
+const (
+	OPENSEARCH_COMPONENT_CLUSTER    = "cluster"
+	OPENSEARCH_COMPONENT_DASHBOARDS = "dashboards"
+)
+
+type SingleOpenSearchInstanceScanResult struct {
+	SingleElasticsearchInstanceScanResult `bson:",inline"`
+	// cluster or dashboards. empty if the URL was down
+	Component string `bson:"component,omitempty" json:"component"`
+	// nil if the security plugin is not installed, or the URL is not a cluster
+	SecurityPlugin *OpenSearchSecurityPlugin `bson:"securityPlugin,omitempty" json:"securityPlugin"`
+}
+
+const (
+	API_SECURITY_PLUGIN = "/_plugins/_security"
+	// open distro for elasticsearch, which became opensearch, served the security plugin here.
+	// opensearch 1.x still does
+	API_OPENDISTRO_SECURITY_PLUGIN = "/_opendistro/_security"
+
+	// answers without authentication
+	SECURITY_PLUGIN_HEALTH = "/health"
+	// tells who the request was authenticated as
+	SECURITY_PLUGIN_AUTHINFO = "/authinfo"
+)
+
+// the user anonymous requests are authenticated as, if anonymous authentication is enabled
+const SECURITY_PLUGIN_ANONYMOUS_USER = "opendistro_security_anonymous"
+
+// OpenSearchSecurityPlugin is what the security plugin of an opensearch cluster tells about itself and the scanning user
+type OpenSearchSecurityPlugin struct {
+	// API_SECURITY_PLUGIN or API_OPENDISTRO_SECURITY_PLUGIN, whichever answered
+	ApiPath string `bson:"apiPath,omitempty" json:"apiPath"`
+	// UP or DOWN
+	Status string `bson:"status,omitempty" json:"status"`
+	// strict or lenient
+	Mode string `bson:"mode,omitempty" json:"mode"`
+	// empty if authinfo requires credentials that were not given
+	UserName     string   `bson:"userName,omitempty" json:"userName"`
+	Roles        []string `bson:"roles,omitempty" json:"roles"`
+	BackendRoles []string `bson:"backendRoles,omitempty" json:"backendRoles"`
+}
+
+type securityPluginHealthResponse struct {
+	Status string `json:"status"`
+	Mode   string `json:"mode"`
+}
+
+type securityPluginAuthinfoResponse struct {
+	UserName     string   `json:"user_name"`
+	Roles        []string `json:"roles"`
+	BackendRoles []string `json:"backend_roles"`
+}
+
+// returns true if requests without credentials are let in as the anonymous user
+func (securityPlugin *OpenSearchSecurityPlugin) AllowsAnonymousAccess() bool {
+	return securityPlugin != nil && securityPlugin.UserName == SECURITY_PLUGIN_ANONYMOUS_USER
+}
+
+// returns nil if the security plugin is not installed
+func (openSearchPlugin *OpenSearchPlugin) probeSecurityPlugin(ctx context.Context, url string, headers map[string]string) *OpenSearchSecurityPlugin {
+	for _, apiPath := range []string{API_SECURITY_PLUGIN, API_OPENDISTRO_SECURITY_PLUGIN} {
+		healthResp, statusCode, err := openSearchPlugin.httpClient.SendFailSafeHTTPRequest(ctx, fmt.Sprintf("%s%s%s", url, apiPath, SECURITY_PLUGIN_HEALTH), true, headers, "GET")
+		if err != nil || statusCode != 200 {
+			continue
+		}
+		var health securityPluginHealthResponse
+		if json.Unmarshal([]byte(healthResp), &health) != nil || health.Status == "" {
+			continue
+		}
+		securityPlugin := &OpenSearchSecurityPlugin{
+			ApiPath: apiPath,
+			Status:  health.Status,
+			Mode:    health.Mode,
+		}
+
+		authinfoResp, statusCode, err := openSearchPlugin.httpClient.SendFailSafeHTTPRequest(ctx, fmt.Sprintf("%s%s%s", url, apiPath, SECURITY_PLUGIN_AUTHINFO), true, headers, "GET")
+		var authinfo securityPluginAuthinfoResponse
+		if err == nil && statusCode == 200 && json.Unmarshal([]byte(authinfoResp), &authinfo) == nil {
+			securityPlugin.UserName = authinfo.UserName
+			securityPlugin.Roles = authinfo.Roles
+			securityPlugin.BackendRoles = authinfo.BackendRoles
+		}
+
+		return securityPlugin
+	}
+
+	return nil
+}
+
+func (openSearchPlugin *OpenSearchPlugin) scanSingleOpenSearchInstance(ctx context.Context, url string) ScanResult {
+	singleOpenSearchInstanceScanResult := &SingleOpenSearchInstanceScanResult{
+		SingleElasticsearchInstanceScanResult: SingleElasticsearchInstanceScanResult{
+			InstanceScanResult: newInstanceScanResult(openSearchPlugin.Name(), url),
+		},
+	}
+	clusterScanResult := &singleOpenSearchInstanceScanResult.SingleElasticsearchInstanceScanResult
+	headers, isUp := openSearchPlugin.probeRootUrl(ctx, url, clusterScanResult)
+	if !isUp {
+		return singleOpenSearchInstanceScanResult
+	}
+
+	// a cluster with the security plugin answers 401 at the root URL without credentials,
+	// but its health API still tells that it is there
+	securityPlugin := openSearchPlugin.probeSecurityPlugin(ctx, url, headers)
+	if clusterScanResult.ClusterInfo == nil && securityPlugin == nil {
+		EPUtils.EPLogger(fmt.Sprintf("%s is not an opensearch cluster. Trying it as opensearch dashboards\n", url))
+		singleOpenSearchInstanceScanResult.Component = OPENSEARCH_COMPONENT_DASHBOARDS
+		dashboardsHeaders, _ := authenticate(ctx, openSearchPlugin.httpClient, openSearchPlugin.credentials, url, dashboardsHeader)
+		openSearchPlugin.dashboards.scanThroughConsoleProxy(ctx, url, dashboardsHeaders, &clusterScanResult.InstanceScanResult)
+
+		return singleOpenSearchInstanceScanResult
+	}
+
+	singleOpenSearchInstanceScanResult.Component = OPENSEARCH_COMPONENT_CLUSTER
+	singleOpenSearchInstanceScanResult.SecurityPlugin = securityPlugin
+	if clusterInfo := clusterScanResult.ClusterInfo; clusterInfo != nil && !clusterInfo.IsOpenSearch() {
+		EPUtils.EPLogger(fmt.Sprintf("%s is %s, not opensearch. Scanning it anyway\n", url, clusterInfo.Distribution))
+	}
+	switch {
+	case securityPlugin == nil:
+		EPUtils.EPLogger(fmt.Sprintf("%s does not have the security plugin\n", url))
+	case securityPlugin.AllowsAnonymousAccess():
+		EPUtils.EPLogger(fmt.Sprintf("%s allows anonymous access with roles %v\n", url, securityPlugin.Roles))
+	}
+	openSearchPlugin.scanCluster(ctx, url, headers, clusterScanResult)
+
+	return singleOpenSearchInstanceScanResult
+}
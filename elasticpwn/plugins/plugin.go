@@ -1,5 +1,97 @@
 package EPPlugins
 
+import (
+	"context"
+	"flag"
+	"fmt"
+	"strings"
+
+	EPUtils "github.com/9oelM/elasticpwn/elasticpwn/util"
+)
+
+// Every mode of elasticpwn (elasticsearch, kibana, opensearch, report generate, report view)
+// is a plugin. A plugin declares its own flags and validation,
+// and main.go only drives it through the lifecycle below:
+// DefineFlags -> (flags parsed) -> Validate -> Prepare -> Run -> PostProcess
+// PostProcess is called even if Run returned early due to an interruption,
+// so that every output is finalized properly.
+//
+// To add a new plugin, create a new file in this package, implement this interface
+// and call RegisterPlugin from its init function. Nothing else needs to be touched.
 type ElasticpwnPlugin interface {
-	Run() interface{}
+	// command that selects this plugin, e.g. "elasticsearch" or "report generate"
+	Name() string
+	// example command shown when wrong options are given
+	Example() string
+	DefineFlags(fs *flag.FlagSet)
+	// returns true if any of the flags has an invalid value, just like EPUtils.Validate* functions
+	Validate() bool
+	// anything that needs to be done before Run, like reading input files or connecting to a database
+	Prepare()
+	// ctx gets cancelled when the user interrupts elasticpwn (Ctrl+C).
+	// Run should stop starting new work then, and return once in-flight work is finished or abandoned.
+	Run(ctx context.Context)
+	// anything that needs to be done after Run, like finalizing output files
+	PostProcess()
+}
+
+type registeredPlugin struct {
+	plugin  ElasticpwnPlugin
+	flagSet *flag.FlagSet
+}
+
+// keep it as a slice to print instructions in the order of registration
+var registeredPlugins []*registeredPlugin
+
+func RegisterPlugin(plugin ElasticpwnPlugin) {
+	for _, p := range registeredPlugins {
+		if p.plugin.Name() == plugin.Name() {
+			panic(fmt.Sprintf("plugin \"%v\" is already registered", plugin.Name()))
+		}
+	}
+	// ex. "report generate" -> "report-generate-plugin"
+	flagSet := flag.NewFlagSet(fmt.Sprintf("%s-plugin", strings.ReplaceAll(plugin.Name(), " ", "-")), flag.ContinueOnError)
+	plugin.DefineFlags(flagSet)
+
+	registeredPlugins = append(registeredPlugins, &registeredPlugin{
+		plugin:  plugin,
+		flagSet: flagSet,
+	})
+}
+
+// finds the plugin whose name matches the beginning of args
+// and returns it with the rest of args (the plugin options).
+// returns nil if no plugin matches.
+func LookupPlugin(args []string) (ElasticpwnPlugin, *flag.FlagSet, []string) {
+	var (
+		found         *registeredPlugin
+		foundNameSize int
+	)
+	for _, p := range registeredPlugins {
+		nameFields := strings.Fields(p.plugin.Name())
+		if len(nameFields) > len(args) || len(nameFields) <= foundNameSize {
+			continue
+		}
+		if strings.Join(nameFields, " ") == strings.Join(args[:len(nameFields)], " ") {
+			found = p
+			foundNameSize = len(nameFields)
+		}
+	}
+	if found == nil {
+		return nil, nil, args
+	}
+
+	return found.plugin, found.flagSet, args[foundNameSize:]
+}
+
+func PrintBasicInstruction() {
+	pluginNames := make([]string, 0, len(registeredPlugins))
+	for _, p := range registeredPlugins {
+		pluginNames = append(pluginNames, p.plugin.Name())
+	}
+	EPUtils.Printf("Usage: elasticpwn [%s] [...plugin options]\n", strings.Join(pluginNames, "|"))
+	for _, p := range registeredPlugins {
+		EPUtils.Printf("[%s] plugin options:\n", p.plugin.Name())
+		p.flagSet.PrintDefaults()
+	}
 }
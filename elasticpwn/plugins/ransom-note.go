@@ -0,0 +1,144 @@
+package EPPlugins
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	EPUtils "github.com/9oelM/elasticpwn/elasticpwn/util"
+)
+
+const (
+	// ransom notes are read from at most this many indices of a single instance. meow bot leaves hundreds of them
+	MAX_RANSOM_NOTE_INDICES = 3
+	// documents requested from each ransom note index. a note is usually a single document
+	MAX_RANSOM_NOTE_DOCS = 5
+	// bytes of the notes kept in Compromise
+	MAX_RANSOM_NOTE_LEN = 4096
+)
+
+// Compromise tells that an instance was already wiped or ransomed, so that it can be reported to its owner
+type Compromise struct {
+	// indices named like a ransom note, like read_me or 3ac0vxcqkm-meow. those with docs come first
+	NoteIndices []string `bson:"noteIndices" json:"noteIndices"`
+	// texts of the documents of the first MAX_RANSOM_NOTE_INDICES note indices, cut off at MAX_RANSOM_NOTE_LEN.
+	// empty if none could be read, like the empty indices meow bot leaves
+	Note           string   `bson:"note,omitempty" json:"note"`
+	ContactEmails  []string `bson:"contactEmails,omitempty" json:"contactEmails"`
+	BtcAddresses   []string `bson:"btcAddresses,omitempty" json:"btcAddresses"`
+	XmrAddresses   []string `bson:"xmrAddresses,omitempty" json:"xmrAddresses"`
+	DemandedAmount string   `bson:"demandedAmount,omitempty" json:"demandedAmount"`
+}
+
+// returns a Compromise with the ransom note indices among all indices from _cat/indices, or nil if there is none
+func newCompromise(indices []IndexInfo) *Compromise {
+	var noteIndices []IndexInfo
+	for _, index := range indices {
+		if EPUtils.IsRansomNoteIndexName(index.Index) {
+			noteIndices = append(noteIndices, index)
+		}
+	}
+	if len(noteIndices) == 0 {
+		return nil
+	}
+	hasDocs := func(index IndexInfo) bool {
+		return index.DocsCountNumber == nil || *index.DocsCountNumber > 0
+	}
+	sort.SliceStable(noteIndices, func(i, j int) bool {
+		return hasDocs(noteIndices[i]) && !hasDocs(noteIndices[j])
+	})
+
+	compromise := &Compromise{}
+	for _, index := range noteIndices {
+		compromise.NoteIndices = append(compromise.NoteIndices, index.Index)
+	}
+
+	return compromise
+}
+
+// requests the documents of the ransom note indices of instanceScanResult with requestNote,
+// and stores the notes and the contacts, wallets and amount found in them in its Compromise.
+// does nothing if instanceScanResult has no Compromise.
+// requestNote returns the response of /<index>/_search with MAX_RANSOM_NOTE_DOCS documents, or false if there was none
+func readRansomNotes(instanceScanResult *InstanceScanResult, requestNote func(indexName string) (string, bool)) {
+	compromise := instanceScanResult.Compromise
+	if compromise == nil {
+		return
+	}
+	noteIndices := compromise.NoteIndices
+	if len(noteIndices) > MAX_RANSOM_NOTE_INDICES {
+		noteIndices = noteIndices[:MAX_RANSOM_NOTE_INDICES]
+	}
+
+	var notes []string
+	for _, indexName := range noteIndices {
+		searchResponse, ok := requestNote(indexName)
+		if !ok {
+			continue
+		}
+		note, err := ransomNoteFromSearchResponse(searchResponse)
+		if err != nil {
+			EPUtils.EPLogger(fmt.Sprintf("Error while unmarshalling ransom note %s from %s: %v", indexName, instanceScanResult.RootUrl, err))
+			continue
+		}
+		if note != "" {
+			notes = append(notes, note)
+		}
+	}
+	// parsed before it is cut off, since wallets and contacts are often at the end of a long note
+	note := strings.Join(notes, "\n")
+	details := EPUtils.ParseRansomNote(note)
+	if len(note) > MAX_RANSOM_NOTE_LEN {
+		note = strings.ToValidUTF8(note[:MAX_RANSOM_NOTE_LEN], "")
+	}
+	compromise.Note = note
+	compromise.ContactEmails = details.ContactEmails
+	compromise.BtcAddresses = details.BtcAddresses
+	compromise.XmrAddresses = details.XmrAddresses
+	compromise.DemandedAmount = details.DemandedAmount
+	EPUtils.EPLogger(fmt.Sprintf("%s is compromised. Found ransom note indices %s, contacts %v, BTC addresses %v and XMR addresses %v",
+		instanceScanResult.RootUrl, strings.Join(compromise.NoteIndices, ","), compromise.ContactEmails, compromise.BtcAddresses, compromise.XmrAddresses))
+}
+
+// joins all string values of the _source of each hit of a _search response, one line per value
+func ransomNoteFromSearchResponse(searchResponse string) (string, error) {
+	var response struct {
+		Hits struct {
+			Hits []struct {
+				Source interface{} `json:"_source"`
+			} `json:"hits"`
+		} `json:"hits"`
+	}
+	if err := json.Unmarshal([]byte(searchResponse), &response); err != nil {
+		return "", err
+	}
+
+	var lines []string
+	var collectStrings func(value interface{})
+	collectStrings = func(value interface{}) {
+		switch typedValue := value.(type) {
+		case string:
+			lines = append(lines, typedValue)
+		case []interface{}:
+			for _, element := range typedValue {
+				collectStrings(element)
+			}
+		case map[string]interface{}:
+			keys := make([]string, 0, len(typedValue))
+			for key := range typedValue {
+				keys = append(keys, key)
+			}
+			// notes with several fields read the same every time
+			sort.Strings(keys)
+			for _, key := range keys {
+				collectStrings(typedValue[key])
+			}
+		}
+	}
+	for _, hit := range response.Hits.Hits {
+		collectStrings(hit.Source)
+	}
+
+	return strings.Join(lines, "\n"), nil
+}
@@ -0,0 +1,68 @@
+package EPPlugins
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func noteIndex(name string, docsCount *int64) IndexInfo {
+	return IndexInfo{InterestingIndexInfo: InterestingIndexInfo{Index: name, DocsCountNumber: docsCount}}
+}
+
+func TestNewCompromise(t *testing.T) {
+	zero, one := int64(0), int64(1)
+	compromise := newCompromise([]IndexInfo{
+		noteIndex("3ac0vxcqkm-meow", &zero),
+		noteIndex("customers", &one),
+		noteIndex("read_me", &one),
+		noteIndex("f8sk2ld0qp-meow", &zero),
+		// closed, so its docs are unknown
+		noteIndex("how_to_recover_your_data", nil),
+	})
+	expected := []string{"read_me", "how_to_recover_your_data", "3ac0vxcqkm-meow", "f8sk2ld0qp-meow"}
+	if compromise == nil || !reflect.DeepEqual(compromise.NoteIndices, expected) {
+		t.Errorf("expected note indices with docs first in %v but got %+v", expected, compromise)
+	}
+
+	if compromise := newCompromise([]IndexInfo{noteIndex("customers", &one)}); compromise != nil {
+		t.Errorf("expected no compromise but got %+v", *compromise)
+	}
+}
+
+func TestRansomNoteFromSearchResponse(t *testing.T) {
+	searchResponse := `{"hits": {"total": 2, "hits": [
+		{"_source": {"message": "All your data is backed up.", "btc": "bc1qexampleexampleexample", "count": 1}},
+		{"_source": {"contact": {"email": "restore@example.com"}, "lines": ["pay 0.015 BTC", 2]}}
+	]}}`
+	note, err := ransomNoteFromSearchResponse(searchResponse)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "bc1qexampleexampleexample\nAll your data is backed up.\nrestore@example.com\npay 0.015 BTC"
+	if note != expected {
+		t.Errorf("expected %q but got %q", expected, note)
+	}
+
+	if _, err := ransomNoteFromSearchResponse("<html>"); err == nil {
+		t.Error("expected an error for a response that is not JSON")
+	}
+}
+
+func TestReadRansomNotesParsesBeforeCuttingOff(t *testing.T) {
+	email := "restore@example.com"
+	instanceScanResult := &InstanceScanResult{
+		RootUrl:    "http://1.1.1.1:9200",
+		Compromise: &Compromise{NoteIndices: []string{"read_me"}},
+	}
+	readRansomNotes(instanceScanResult, func(indexName string) (string, bool) {
+		return `{"hits": {"hits": [{"_source": {"message": "` + strings.Repeat("a", MAX_RANSOM_NOTE_LEN) + ` contact ` + email + `"}}]}}`, true
+	})
+	compromise := instanceScanResult.Compromise
+	if len(compromise.Note) != MAX_RANSOM_NOTE_LEN {
+		t.Errorf("expected the note to be cut off at %d bytes but got %d", MAX_RANSOM_NOTE_LEN, len(compromise.Note))
+	}
+	if !reflect.DeepEqual(compromise.ContactEmails, []string{email}) {
+		t.Errorf("expected %s from the end of the note but got %v", email, compromise.ContactEmails)
+	}
+}
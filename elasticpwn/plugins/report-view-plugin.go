@@ -1,9 +1,14 @@
 package EPPlugins
 
 import (
+	"context"
+	"errors"
+	"flag"
 	"fmt"
 	"log"
 	"net/http"
+	"path/filepath"
+	"time"
 )
 
 type ReportViewPlugin struct {
@@ -11,10 +16,46 @@ type ReportViewPlugin struct {
 	ServeAtPort     string
 }
 
-func (rvp *ReportViewPlugin) Run() {
+func init() {
+	RegisterPlugin(&ReportViewPlugin{})
+}
+
+func (rvp *ReportViewPlugin) Name() string {
+	return "report view"
+}
+
+func (rvp *ReportViewPlugin) Example() string {
+	return "elasticpwn report view -d ./report"
+}
+
+func (rvp *ReportViewPlugin) DefineFlags(fs *flag.FlagSet) {
+	fs.StringVar(&rvp.ReportDirectory, "d", filepath.FromSlash("./report"), "[OPTIONAL] the directory of generated report")
+	fs.StringVar(&rvp.ServeAtPort, "p", "9999", "[OPTIONAL] local port to serve report page from")
+}
+
+func (rvp *ReportViewPlugin) Validate() bool {
+	return false
+}
+
+func (rvp *ReportViewPlugin) Prepare() {}
+
+func (rvp *ReportViewPlugin) PostProcess() {}
+
+// serves until ctx is cancelled
+func (rvp *ReportViewPlugin) Run(ctx context.Context) {
+	server := &http.Server{
+		Addr:    fmt.Sprintf(":%v", rvp.ServeAtPort),
+		Handler: http.FileServer(http.Dir(rvp.ReportDirectory)),
+	}
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancelShutdown := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancelShutdown()
+		server.Shutdown(shutdownCtx)
+	}()
 	log.Println(fmt.Sprintf("Report being served at http://localhost:%v", rvp.ServeAtPort))
-	err := http.ListenAndServe(fmt.Sprintf(":%v", rvp.ServeAtPort), http.FileServer(http.Dir(rvp.ReportDirectory)))
-	if err != nil {
+	err := server.ListenAndServe()
+	if err != nil && !errors.Is(err, http.ErrServerClosed) {
 		log.Fatal(err)
 	}
 }
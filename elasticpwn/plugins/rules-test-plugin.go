@@ -0,0 +1,77 @@
+package EPPlugins
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	EPUtils "github.com/9oelM/elasticpwn/elasticpwn/util"
+)
+
+// Tells whether index names given as arguments are interesting, and which rule decided it.
+// Used to check a rules file for -rules before scanning with it.
+type RulesTestPlugin struct {
+	RulesFilePath string
+
+	// to read index names after the flags
+	flagSet *flag.FlagSet
+}
+
+func init() {
+	RegisterPlugin(&RulesTestPlugin{})
+}
+
+func (rtp *RulesTestPlugin) Name() string {
+	return "rules test"
+}
+
+func (rtp *RulesTestPlugin) Example() string {
+	return "elasticpwn rules test -rules rules.yml customers .kibana_1 filebeat-2021.01.01"
+}
+
+func (rtp *RulesTestPlugin) DefineFlags(fs *flag.FlagSet) {
+	fs.StringVar(&rtp.RulesFilePath, "rules", "", `[OPTIONAL] path to the rules file to test along with the built-in rules.
+Index names to test follow the options.`)
+	rtp.flagSet = fs
+}
+
+func (rtp *RulesTestPlugin) Validate() bool {
+	// stdout only has the result of each index name
+	EPUtils.LogToStderr()
+	needsExit := validateRulesFile(rtp.RulesFilePath)
+	if rtp.flagSet.NArg() == 0 {
+		EPUtils.Printf("Index names to test are not given. Please try again.\nexample: %v\n", rtp.Example())
+		needsExit = true
+	}
+
+	return needsExit
+}
+
+func (rtp *RulesTestPlugin) Prepare() {
+	EPUtils.ExitOnError(useRulesFile(rtp.RulesFilePath))
+}
+
+func (rtp *RulesTestPlugin) Run(ctx context.Context) {
+	printIndexNameMatches(os.Stdout, rtp.flagSet.Args())
+}
+
+// prints which rule decides each of indexNames, one line per name
+func printIndexNameMatches(w io.Writer, indexNames []string) {
+	for _, indexName := range indexNames {
+		match := getIndexRules().MatchIndexName(indexName)
+		switch {
+		case match.IsUninteresting:
+			fmt.Fprintf(w, "%s: uninteresting. matched %v\n", indexName, match.UninterestingRule)
+		case match.UninterestingRule != nil:
+			fmt.Fprintf(w, "%s: interesting. matched %v, but also %v, which wins\n", indexName, match.UninterestingRule, match.InterestingRule)
+		case match.InterestingRule != nil:
+			fmt.Fprintf(w, "%s: interesting. matched %v\n", indexName, match.InterestingRule)
+		default:
+			fmt.Fprintf(w, "%s: interesting. no rule matched\n", indexName)
+		}
+	}
+}
+
+func (rtp *RulesTestPlugin) PostProcess() {}
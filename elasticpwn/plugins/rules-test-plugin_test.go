@@ -0,0 +1,40 @@
+package EPPlugins
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestPrintIndexNameMatches(t *testing.T) {
+	rulesFilePath := filepath.Join(t.TempDir(), "rules.yml")
+	rules := `
+uninterestingIndices:
+  - glob: "tmp-*"
+interestingIndices:
+  - prefix: tmp-keep
+  - exact: customers
+`
+	if err := os.WriteFile(rulesFilePath, []byte(rules), 0644); err != nil {
+		t.Fatal(err)
+	}
+	builtInRules := currentRules.Load()
+	defer currentRules.Store(builtInRules)
+	if err := useRulesFile(rulesFilePath); err != nil {
+		t.Fatal(err)
+	}
+
+	var output bytes.Buffer
+	printIndexNameMatches(&output, []string{"tmp-1", "tmp-keep-1", "customers", "orders"})
+	expected := []string{
+		`tmp-1: uninteresting. matched glob "tmp-*" (` + rulesFilePath + `)`,
+		`tmp-keep-1: interesting. matched glob "tmp-*" (` + rulesFilePath + `), but also prefix "tmp-keep" (` + rulesFilePath + `), which wins`,
+		`customers: interesting. matched exact "customers" (` + rulesFilePath + `)`,
+		`orders: interesting. no rule matched`,
+	}
+	if expectedOutput := strings.Join(expected, "\n") + "\n"; output.String() != expectedOutput {
+		t.Errorf("expected\n%sbut got\n%s", expectedOutput, output.String())
+	}
+}
@@ -0,0 +1,357 @@
+package EPPlugins
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+
+	EPUtils "github.com/9oelM/elasticpwn/elasticpwn/util"
+
+	// pure go sqlite driver, so that elasticpwn can still be installed without cgo
+	_ "modernc.org/sqlite"
+)
+
+// Tables are normalized so that results can be queried with plain SQL, for example:
+//
+// SELECT DISTINCT i.root_url FROM instances i
+// JOIN extracted_values e ON e.instance_id = i.id
+// WHERE e.kind = 'email' AND e.value LIKE '%@example.com';
+var sqliteSchema = []string{
+	`CREATE TABLE IF NOT EXISTS instances (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		scan_id TEXT NOT NULL,
+		schema_version INTEGER NOT NULL,
+		product TEXT NOT NULL,
+		root_url TEXT NOT NULL,
+		auth_mode TEXT,
+		version_number TEXT,
+		distribution TEXT,
+		cluster_name TEXT,
+		cluster_uuid TEXT,
+		auth_disabled INTEGER,
+		license_type TEXT,
+		is_initialized INTEGER NOT NULL,
+		has_index_over_gb INTEGER NOT NULL,
+		total_store_size_bytes INTEGER,
+		total_docs_count INTEGER,
+		skipped_reason TEXT,
+		classification_label TEXT,
+		classification_confidence REAL,
+		classification_evidence TEXT,
+		created_at TEXT NOT NULL,
+		cloud_hosting_provider TEXT,
+		subject_urls TEXT,
+		organizations TEXT,
+		cname TEXT,
+		indices_info_json BLOB
+	)`,
+	`CREATE INDEX IF NOT EXISTS instances_root_url ON instances (root_url)`,
+	`CREATE TABLE IF NOT EXISTS indices (
+		instance_id INTEGER NOT NULL REFERENCES instances (id) ON DELETE CASCADE,
+		name TEXT NOT NULL,
+		docs_count TEXT,
+		docs_deleted TEXT,
+		store_size TEXT,
+		pri_store_size TEXT,
+		docs_count_number INTEGER,
+		docs_deleted_number INTEGER,
+		store_size_bytes INTEGER,
+		pri_store_size_bytes INTEGER,
+		score INTEGER,
+		score_reason TEXT
+	)`,
+	`CREATE INDEX IF NOT EXISTS indices_instance_id ON indices (instance_id)`,
+	// category is one of EPUtils.SENSITIVE_FIELD_* constants
+	`CREATE TABLE IF NOT EXISTS sensitive_fields (
+		instance_id INTEGER NOT NULL REFERENCES instances (id) ON DELETE CASCADE,
+		index_name TEXT NOT NULL,
+		path TEXT NOT NULL,
+		type TEXT,
+		category TEXT NOT NULL,
+		nested INTEGER NOT NULL
+	)`,
+	`CREATE INDEX IF NOT EXISTS sensitive_fields_category ON sensitive_fields (category)`,
+	// lists are comma separated
+	`CREATE TABLE IF NOT EXISTS compromises (
+		instance_id INTEGER NOT NULL REFERENCES instances (id) ON DELETE CASCADE,
+		note_indices TEXT NOT NULL,
+		note TEXT,
+		contact_emails TEXT,
+		btc_addresses TEXT,
+		xmr_addresses TEXT,
+		demanded_amount TEXT
+	)`,
+	// kind is one of SQLITE_EXTRACTED_* constants
+	`CREATE TABLE IF NOT EXISTS extracted_values (
+		instance_id INTEGER NOT NULL REFERENCES instances (id) ON DELETE CASCADE,
+		kind TEXT NOT NULL,
+		value TEXT NOT NULL
+	)`,
+	`CREATE INDEX IF NOT EXISTS extracted_values_kind_value ON extracted_values (kind, value)`,
+	`CREATE TABLE IF NOT EXISTS interesting_words (
+		instance_id INTEGER NOT NULL REFERENCES instances (id) ON DELETE CASCADE,
+		word TEXT NOT NULL
+	)`,
+	`CREATE INDEX IF NOT EXISTS interesting_words_instance_id ON interesting_words (instance_id)`,
+	`CREATE TABLE IF NOT EXISTS nodes (
+		instance_id INTEGER NOT NULL REFERENCES instances (id) ON DELETE CASCADE,
+		name TEXT,
+		ip TEXT,
+		node_role TEXT,
+		master TEXT,
+		raw_json TEXT
+	)`,
+	`CREATE TABLE IF NOT EXISTS allocations (
+		instance_id INTEGER NOT NULL REFERENCES instances (id) ON DELETE CASCADE,
+		node TEXT,
+		host TEXT,
+		ip TEXT,
+		shards TEXT,
+		disk_used TEXT,
+		disk_total TEXT,
+		raw_json TEXT
+	)`,
+}
+
+const (
+	SQLITE_EXTRACTED_EMAIL                      = "email"
+	SQLITE_EXTRACTED_URL                        = "url"
+	SQLITE_EXTRACTED_PUBLIC_IP                  = "public_ip"
+	SQLITE_EXTRACTED_MORE_THAN_TWO_DOTS_IN_NAME = "more_than_two_dots_in_name"
+)
+
+// writes each result into a sqlite database file, one row in instances table per result
+// and the rest of the result in the tables referencing it.
+type sqliteSink struct {
+	path string
+
+	db *sql.DB
+}
+
+func (sink *sqliteSink) Open() error {
+	db, err := sql.Open("sqlite", filepath.FromSlash(sink.path))
+	if err != nil {
+		return err
+	}
+	// sqlite allows only one writer at a time anyway.
+	// a single connection also keeps the pragmas below applied to every statement
+	db.SetMaxOpenConns(1)
+	for _, statement := range append([]string{
+		"PRAGMA foreign_keys = ON",
+		"PRAGMA journal_mode = WAL",
+	}, sqliteSchema...) {
+		if _, err := db.Exec(statement); err != nil {
+			db.Close()
+			return fmt.Errorf("failed to initialize %v: %v", sink.path, err)
+		}
+	}
+	sink.db = db
+
+	return nil
+}
+
+// the parts of a scan result that are stored in sqlite
+type sqliteInstanceRow struct {
+	*InstanceScanResult
+	// only from kibana
+	ipInfo *IpInfo
+	// only from elasticsearch and opensearch
+	clusterInfo *ClusterInfo
+	// only from elasticsearch
+	securityPosture *SecurityPosture
+	nodes           []CatNode
+	allocations     []CatAllocation
+}
+
+func newSqliteInstanceRow(scanResult ScanResult) *sqliteInstanceRow {
+	row := &sqliteInstanceRow{InstanceScanResult: scanResult.GetInstanceScanResult()}
+	switch result := scanResult.(type) {
+	case *SingleElasticsearchInstanceScanResult:
+		row.clusterInfo = result.ClusterInfo
+		row.securityPosture = result.SecurityPosture
+		row.nodes = result.Nodes
+		row.allocations = result.Allocations
+	case *SingleOpenSearchInstanceScanResult:
+		row.clusterInfo = result.ClusterInfo
+		row.nodes = result.Nodes
+		row.allocations = result.Allocations
+	case *SingleKibanaInstanceScanResult:
+		row.ipInfo = result.IpInfo
+	}
+
+	return row
+}
+
+func (sink *sqliteSink) Write(ctx context.Context, scanResult ScanResult) error {
+	row := newSqliteInstanceRow(scanResult)
+	rootUrl := row.RootUrl
+	var indicesInfoInJson []byte
+	if row.IndicesInfoInJson != nil {
+		var err error
+		indicesInfoInJson, err = json.Marshal(row.IndicesInfoInJson)
+		if err != nil {
+			EPUtils.EPLogger(fmt.Sprintf("Error while marshalling info about %s\n", rootUrl))
+			return err
+		}
+	}
+
+	tx, err := sink.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	if err := insertSqliteInstanceRow(ctx, tx, row, indicesInfoInJson); err != nil {
+		tx.Rollback()
+		EPUtils.EPLogger(fmt.Sprintf("Error while inserting info about %s into %v: %v", rootUrl, sink.path, err))
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func insertSqliteInstanceRow(ctx context.Context, tx *sql.Tx, row *sqliteInstanceRow, indicesInfoInJson []byte) error {
+	var cloudHostingProvider, subjectUrls, organizations, cname sql.NullString
+	if row.ipInfo != nil {
+		cloudHostingProvider = sql.NullString{String: row.ipInfo.CloudHostingProvider, Valid: true}
+		subjectUrls = sql.NullString{String: row.ipInfo.SubjectUrls, Valid: true}
+		organizations = sql.NullString{String: row.ipInfo.Organizations, Valid: true}
+		cname = sql.NullString{String: row.ipInfo.Cname, Valid: true}
+	}
+	var versionNumber, distribution, clusterName, clusterUuid sql.NullString
+	if row.clusterInfo != nil {
+		versionNumber = sql.NullString{String: row.clusterInfo.VersionNumber, Valid: true}
+		distribution = sql.NullString{String: row.clusterInfo.Distribution, Valid: true}
+		clusterName = sql.NullString{String: row.clusterInfo.ClusterName, Valid: true}
+		clusterUuid = sql.NullString{String: row.clusterInfo.ClusterUuid, Valid: true}
+	}
+	var authDisabled sql.NullBool
+	var licenseType sql.NullString
+	if row.securityPosture != nil {
+		authDisabled = sql.NullBool{Bool: row.securityPosture.AuthDisabled, Valid: true}
+		licenseType = sql.NullString{String: row.securityPosture.LicenseType, Valid: row.securityPosture.LicenseType != ""}
+	}
+	var classificationLabel, classificationEvidence sql.NullString
+	var classificationConfidence sql.NullFloat64
+	if row.Classification != nil {
+		classificationLabel = sql.NullString{String: row.Classification.Label, Valid: true}
+		classificationConfidence = sql.NullFloat64{Float64: row.Classification.Confidence, Valid: true}
+		classificationEvidence = sql.NullString{String: strings.Join(row.Classification.Evidence, ","), Valid: true}
+	}
+	result, err := tx.ExecContext(ctx,
+		`INSERT INTO instances (scan_id, schema_version, product, root_url, auth_mode, version_number, distribution, cluster_name, cluster_uuid,
+			auth_disabled, license_type, is_initialized, has_index_over_gb, total_store_size_bytes, total_docs_count, skipped_reason,
+			classification_label, classification_confidence, classification_evidence,
+			created_at, cloud_hosting_provider, subject_urls, organizations, cname, indices_info_json)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		row.Id.Hex(), row.SchemaVersion, row.Product, row.RootUrl, row.AuthMode, versionNumber, distribution, clusterName, clusterUuid,
+		authDisabled, licenseType, row.IsInitialized, row.HasAtLeastOneIndexSizeOverGB, row.TotalStoreSizeBytes, row.TotalDocsCount, row.SkippedReason,
+		classificationLabel, classificationConfidence, classificationEvidence,
+		row.CreatedAt.UTC().Format(time.RFC3339), cloudHostingProvider, subjectUrls, organizations, cname, indicesInfoInJson,
+	)
+	if err != nil {
+		return err
+	}
+	instanceId, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+
+	for _, index := range row.Indices {
+		if _, err := tx.ExecContext(ctx,
+			`INSERT INTO indices (instance_id, name, docs_count, docs_deleted, store_size, pri_store_size,
+				docs_count_number, docs_deleted_number, store_size_bytes, pri_store_size_bytes, score, score_reason)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			instanceId, index.Index, index.DocsCount, index.DocsDeleted, index.StoreSize, index.PriStoreSize,
+			index.DocsCountNumber, index.DocsDeletedNumber, index.StoreSizeBytes, index.PriStoreSizeBytes, index.Score, index.ScoreReason,
+		); err != nil {
+			return err
+		}
+		for _, sensitiveField := range index.SensitiveFields {
+			if _, err := tx.ExecContext(ctx,
+				`INSERT INTO sensitive_fields (instance_id, index_name, path, type, category, nested) VALUES (?, ?, ?, ?, ?, ?)`,
+				instanceId, index.Index, sensitiveField.Path, sensitiveField.Type, sensitiveField.Category, sensitiveField.Nested,
+			); err != nil {
+				return err
+			}
+		}
+	}
+
+	if compromise := row.Compromise; compromise != nil {
+		if _, err := tx.ExecContext(ctx,
+			`INSERT INTO compromises (instance_id, note_indices, note, contact_emails, btc_addresses, xmr_addresses, demanded_amount)
+			VALUES (?, ?, ?, ?, ?, ?, ?)`,
+			instanceId, strings.Join(compromise.NoteIndices, ","), compromise.Note, strings.Join(compromise.ContactEmails, ","),
+			strings.Join(compromise.BtcAddresses, ","), strings.Join(compromise.XmrAddresses, ","), compromise.DemandedAmount,
+		); err != nil {
+			return err
+		}
+	}
+
+	if row.InterestingInfo != nil {
+		extractedValues := map[string][]string{
+			SQLITE_EXTRACTED_EMAIL:                      row.InterestingInfo.Emails,
+			SQLITE_EXTRACTED_URL:                        row.InterestingInfo.Urls,
+			SQLITE_EXTRACTED_PUBLIC_IP:                  row.InterestingInfo.PublicIPs,
+			SQLITE_EXTRACTED_MORE_THAN_TWO_DOTS_IN_NAME: row.InterestingInfo.MoreThanTwoDotsInName,
+		}
+		for kind, values := range extractedValues {
+			for _, value := range EPUtils.Unique(values) {
+				if _, err := tx.ExecContext(ctx,
+					`INSERT INTO extracted_values (instance_id, kind, value) VALUES (?, ?, ?)`,
+					instanceId, kind, value,
+				); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	for _, word := range EPUtils.Unique(row.InterestingWords) {
+		if _, err := tx.ExecContext(ctx,
+			`INSERT INTO interesting_words (instance_id, word) VALUES (?, ?)`,
+			instanceId, word,
+		); err != nil {
+			return err
+		}
+	}
+
+	for _, node := range row.nodes {
+		rawJson, _ := json.Marshal(node)
+		master := catField(node.Master)
+		if !master.Valid {
+			// opensearch 2.0 and later
+			master = catField(node.ClusterManager)
+		}
+		if _, err := tx.ExecContext(ctx,
+			`INSERT INTO nodes (instance_id, name, ip, node_role, master, raw_json) VALUES (?, ?, ?, ?, ?, ?)`,
+			instanceId, catField(node.Name), catField(node.Ip), catField(node.NodeRole), master, string(rawJson),
+		); err != nil {
+			return err
+		}
+	}
+
+	for _, allocation := range row.allocations {
+		rawJson, _ := json.Marshal(allocation)
+		if _, err := tx.ExecContext(ctx,
+			`INSERT INTO allocations (instance_id, node, host, ip, shards, disk_used, disk_total, raw_json) VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+			instanceId, catField(allocation.Node), catField(allocation.Host), catField(allocation.Ip), catField(allocation.Shards),
+			catField(allocation.DiskUsed), catField(allocation.DiskTotal), string(rawJson),
+		); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// a column of a _cat API response. empty if the instance did not answer the column, or answered null
+func catField(value string) sql.NullString {
+	return sql.NullString{String: value, Valid: value != ""}
+}
+
+func (sink *sqliteSink) Close() error {
+	return sink.db.Close()
+}
@@ -0,0 +1,211 @@
+package EPUtils
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// how a scan authenticated to an instance. recorded in the scan result
+const (
+	AUTH_MODE_NONE    = "none"
+	AUTH_MODE_BASIC   = "basic"
+	AUTH_MODE_API_KEY = "apikey"
+	AUTH_MODE_BEARER  = "bearer"
+)
+
+var AUTH_MODES = []string{AUTH_MODE_BASIC, AUTH_MODE_API_KEY, AUTH_MODE_BEARER}
+
+// Credentials for a secured cluster. a nil *Credentials means no authentication
+type Credentials struct {
+	// one of AUTH_MODES
+	Mode string
+	// user:password for basic, the API key for apikey and the token for bearer
+	secret string
+}
+
+func NewCredentials(mode string, secret string) (*Credentials, error) {
+	mode = strings.ToLower(mode)
+	if ContainsExactlyMatchesWith(mode, AUTH_MODES) == -1 {
+		return nil, fmt.Errorf("unknown auth mode %v. Possible values: %v", mode, strings.Join(AUTH_MODES, ","))
+	}
+	if secret == "" {
+		return nil, fmt.Errorf("%v needs a secret", mode)
+	}
+	if mode == AUTH_MODE_BASIC && !strings.Contains(secret, ":") {
+		return nil, fmt.Errorf("basic needs user:password")
+	}
+
+	return &Credentials{Mode: mode, secret: secret}, nil
+}
+
+func (credentials *Credentials) GetMode() string {
+	if credentials == nil {
+		return AUTH_MODE_NONE
+	}
+
+	return credentials.Mode
+}
+
+// value of the Authorization header. empty for nil credentials
+func (credentials *Credentials) AuthorizationHeader() string {
+	if credentials == nil {
+		return ""
+	}
+	switch credentials.Mode {
+	case AUTH_MODE_BASIC:
+		return "Basic " + base64.StdEncoding.EncodeToString([]byte(credentials.secret))
+	case AUTH_MODE_API_KEY:
+		// elasticsearch returns both the id:api_key pair and its base64 encoded form. accept either
+		if strings.Contains(credentials.secret, ":") {
+			return "ApiKey " + base64.StdEncoding.EncodeToString([]byte(credentials.secret))
+		}
+		return "ApiKey " + credentials.secret
+	case AUTH_MODE_BEARER:
+		return "Bearer " + credentials.secret
+	default:
+		return ""
+	}
+}
+
+// returns a copy of headers with the Authorization header added. headers itself is never modified
+func (credentials *Credentials) AddTo(headers map[string]string) map[string]string {
+	headersWithAuth := make(map[string]string, len(headers)+1)
+	for name, value := range headers {
+		headersWithAuth[name] = value
+	}
+	if authorizationHeader := credentials.AuthorizationHeader(); authorizationHeader != "" {
+		headersWithAuth["Authorization"] = authorizationHeader
+	}
+
+	return headersWithAuth
+}
+
+type credentialsEntry struct {
+	// nil for *, which matches any target
+	rule        *scopeRule
+	credentials *Credentials
+}
+
+// CredentialsFile maps targets to the credentials to scan them with. each line is
+//
+// <target> <mode> <secret>
+//
+// where target is written the same way as a -scope rule, or * for any target, like
+//
+// 10.0.0.0/8:9200     basic   elastic:changeme
+// *.example.com       apikey  VnVhQ2ZHY0JDZGJrUW0tZTVhT3g6dWkybHAyYXhUTm1zeWFrdzl0dk5udw==
+// *                   bearer  eyJhbGciOi...
+//
+// the first matching line wins, so put * last.
+// blank lines and lines starting with # are ignored.
+// a nil *CredentialsFile has no credentials for any target.
+type CredentialsFile struct {
+	entries []*credentialsEntry
+}
+
+func LoadCredentialsFile(path string) (*CredentialsFile, error) {
+	if path == "" {
+		return nil, nil
+	}
+	f, err := os.Open(filepath.FromSlash(path))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	credentialsFile := &CredentialsFile{}
+	scanner := bufio.NewScanner(f)
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		entry, err := parseCredentialsLine(line)
+		if err != nil {
+			// don't print the line. it has a secret in it
+			return nil, fmt.Errorf("%v:%d: %v", path, lineNum, err)
+		}
+		credentialsFile.entries = append(credentialsFile.entries, entry)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(credentialsFile.entries) == 0 {
+		return nil, fmt.Errorf("no credentials found in %v", path)
+	}
+
+	return credentialsFile, nil
+}
+
+func parseCredentialsLine(line string) (*credentialsEntry, error) {
+	fields := strings.Fields(line)
+	if len(fields) < 3 {
+		return nil, fmt.Errorf("expected <target> <mode> <secret>")
+	}
+	// the secret is the rest of the line, so that a password can have spaces
+	rest := strings.TrimSpace(strings.TrimPrefix(line, fields[0]))
+	secret := strings.TrimSpace(strings.TrimPrefix(rest, fields[1]))
+
+	credentials, err := NewCredentials(fields[1], secret)
+	if err != nil {
+		return nil, err
+	}
+	entry := &credentialsEntry{credentials: credentials}
+	if fields[0] != "*" {
+		if entry.rule, err = parseScopeRule(fields[0]); err != nil {
+			return nil, err
+		}
+	}
+
+	return entry, nil
+}
+
+// returns the credentials of the first line matching target, or nil if none matches.
+// hostnames are resolved with resolver only if there are CIDRs or IPs in the file.
+// returns an error only if target is malformed.
+func (credentialsFile *CredentialsFile) Lookup(ctx context.Context, resolver *Resolver, target string) (*Credentials, error) {
+	if credentialsFile == nil {
+		return nil, nil
+	}
+	var rules []*scopeRule
+	for _, entry := range credentialsFile.entries {
+		if entry.rule != nil {
+			rules = append(rules, entry.rule)
+		}
+	}
+	hostname, ports, ips, err := resolveRuleTarget(ctx, target, nil)
+	if err != nil {
+		return nil, err
+	}
+	if ips == nil && hasNetworkRules(rules) {
+		// unlike -scope, a host that can't be resolved is not an error. it just doesn't match CIDRs
+		if ips, err = resolver.LookupIP(ctx, hostname); err != nil {
+			EPLogger(fmt.Sprintf("Matching %v against -creds only by its name, because it could not be resolved: %v", hostname, err))
+		}
+	}
+
+	for _, entry := range credentialsFile.entries {
+		if entry.rule == nil {
+			return entry.credentials, nil
+		}
+		matchesAllPorts := true
+		for _, port := range ports {
+			if !entry.rule.includes(hostname, ips, port) {
+				matchesAllPorts = false
+				break
+			}
+		}
+		if matchesAllPorts {
+			return entry.credentials, nil
+		}
+	}
+
+	return nil, nil
+}
@@ -0,0 +1,92 @@
+package EPUtils
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestAuthorizationHeader(t *testing.T) {
+	cases := []struct {
+		mode     string
+		secret   string
+		expected string
+	}{
+		{AUTH_MODE_BASIC, "elastic:change me", "Basic ZWxhc3RpYzpjaGFuZ2UgbWU="},
+		{AUTH_MODE_API_KEY, "id:key", "ApiKey aWQ6a2V5"},
+		{AUTH_MODE_API_KEY, "aWQ6a2V5", "ApiKey aWQ6a2V5"},
+		{"Bearer", "token", "Bearer token"},
+	}
+	for _, c := range cases {
+		credentials, err := NewCredentials(c.mode, c.secret)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if header := credentials.AuthorizationHeader(); header != c.expected {
+			t.Errorf("%v %v: expected %v but got %v", c.mode, c.secret, c.expected, header)
+		}
+	}
+
+	var noCredentials *Credentials
+	headers := noCredentials.AddTo(map[string]string{"kbn-xsrf": "_"})
+	if len(headers) != 1 || noCredentials.GetMode() != AUTH_MODE_NONE {
+		t.Errorf("expected nil credentials to add nothing, got %v", headers)
+	}
+}
+
+func TestNewCredentialsInvalid(t *testing.T) {
+	for _, c := range [][2]string{{"digest", "a:b"}, {AUTH_MODE_BASIC, "no-colon"}, {AUTH_MODE_BEARER, ""}} {
+		if _, err := NewCredentials(c[0], c[1]); err == nil {
+			t.Errorf("expected %v %v to be rejected", c[0], c[1])
+		}
+	}
+}
+
+func TestCredentialsFileLookup(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "creds.txt")
+	content := `# audited clusters
+10.0.0.0/8:9200   basic  elastic:pass word
+*.example.com     apikey id:key
+*                 bearer token
+`
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	credentialsFile, err := LoadCredentialsFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		target string
+		mode   string
+	}{
+		{"10.1.2.3:9200", AUTH_MODE_BASIC},
+		{"https://10.1.2.3:9200", AUTH_MODE_BASIC},
+		{"10.1.2.3:9243", AUTH_MODE_BEARER},
+		{"es.example.com:9200", AUTH_MODE_API_KEY},
+		{"1.1.1.1:9200", AUTH_MODE_BEARER},
+	}
+	for _, c := range cases {
+		credentials, err := credentialsFile.Lookup(context.Background(), nil, c.target)
+		if err != nil || credentials.GetMode() != c.mode {
+			t.Errorf("%v: expected %v but got %v (%v)", c.target, c.mode, credentials.GetMode(), err)
+		}
+	}
+}
+
+func TestLoadCredentialsFileInvalid(t *testing.T) {
+	if credentialsFile, err := LoadCredentialsFile(""); credentialsFile != nil || err != nil {
+		t.Errorf("expected no credentials without a path")
+	}
+	path := filepath.Join(t.TempDir(), "creds.txt")
+	for _, content := range []string{"", "# only a comment\n", "1.1.1.1 basic\n", "1.1.1.1:abc basic a:b\n"} {
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := LoadCredentialsFile(path); err == nil {
+			t.Errorf("expected %q to be rejected", content)
+		}
+	}
+}
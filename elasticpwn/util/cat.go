@@ -0,0 +1,35 @@
+package EPUtils
+
+import (
+	"strings"
+)
+
+// parses the plain text output of an elasticsearch _cat API requested with ?v, like
+//
+// health status index   pri rep docs.count docs.deleted store.size pri.store.size
+// green  open   .kibana   1   0          3            0     15.2kb         15.2kb
+//
+// into a row per line, keyed by the column names in the header.
+// elasticsearch before 5.0 can't answer _cat APIs in JSON.
+// cells are separated by whitespace, so rows with empty cells (like unassigned shards) can't be told apart and are skipped.
+func ParseCatTable(text string) []map[string]string {
+	lines := strings.Split(strings.TrimSpace(text), "\n")
+	if len(lines) == 0 {
+		return nil
+	}
+	header := strings.Fields(lines[0])
+	var rows []map[string]string
+	for _, line := range lines[1:] {
+		cells := strings.Fields(line)
+		if len(cells) != len(header) {
+			continue
+		}
+		row := make(map[string]string, len(header))
+		for i, column := range header {
+			row[column] = cells[i]
+		}
+		rows = append(rows, row)
+	}
+
+	return rows
+}
@@ -0,0 +1,119 @@
+package EPUtils
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// a single line of a checkpoint file
+type CheckpointEntry struct {
+	RootUrl    string    `json:"rootUrl"`
+	Outcome    string    `json:"outcome"`
+	FinishedAt time.Time `json:"finishedAt"`
+}
+
+// Checkpoint journals URLs that were completely scanned and written to the output,
+// one JSON object per line, so that an interrupted scan can be resumed later
+// without scanning the same URLs again.
+type Checkpoint struct {
+	path string
+	file *os.File
+	mu   sync.Mutex
+	// rootUrl -> outcome
+	completed map[string]string
+}
+
+// opens a checkpoint file, creating it if it does not exist.
+// URLs already journaled in the file are loaded as completed.
+func OpenCheckpoint(path string) (*Checkpoint, error) {
+	checkpoint := &Checkpoint{
+		path:      filepath.FromSlash(path),
+		completed: make(map[string]string),
+	}
+
+	existingFile, err := os.Open(checkpoint.path)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		break
+	case err != nil:
+		return nil, err
+	default:
+		scanner := bufio.NewScanner(existingFile)
+		lineNum := 0
+		for scanner.Scan() {
+			lineNum++
+			if len(scanner.Bytes()) == 0 {
+				continue
+			}
+			var entry CheckpointEntry
+			// the last line may be cut in half if elasticpwn was killed while writing it.
+			// the URL will just be scanned again.
+			if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+				EPLogger(fmt.Sprintf("Ignoring malformed line %d in checkpoint file %v", lineNum, path))
+				continue
+			}
+			checkpoint.completed[entry.RootUrl] = entry.Outcome
+		}
+		scanErr := scanner.Err()
+		existingFile.Close()
+		if scanErr != nil {
+			return nil, scanErr
+		}
+	}
+
+	checkpoint.file, err = os.OpenFile(checkpoint.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	return checkpoint, nil
+}
+
+func (checkpoint *Checkpoint) IsCompleted(rootUrl string) bool {
+	checkpoint.mu.Lock()
+	defer checkpoint.mu.Unlock()
+	_, ok := checkpoint.completed[rootUrl]
+
+	return ok
+}
+
+func (checkpoint *Checkpoint) CompletedCount() int {
+	checkpoint.mu.Lock()
+	defer checkpoint.mu.Unlock()
+
+	return len(checkpoint.completed)
+}
+
+// call this only after the scan result of rootUrl is written to the output
+func (checkpoint *Checkpoint) MarkCompleted(rootUrl string, outcome string) error {
+	entry, err := json.Marshal(&CheckpointEntry{
+		RootUrl:    rootUrl,
+		Outcome:    outcome,
+		FinishedAt: time.Now(),
+	})
+	if err != nil {
+		return err
+	}
+
+	checkpoint.mu.Lock()
+	defer checkpoint.mu.Unlock()
+	if _, err := checkpoint.file.Write(append(entry, '\n')); err != nil {
+		return err
+	}
+	checkpoint.completed[rootUrl] = outcome
+
+	return nil
+}
+
+func (checkpoint *Checkpoint) Close() error {
+	checkpoint.mu.Lock()
+	defer checkpoint.mu.Unlock()
+
+	return checkpoint.file.Close()
+}
@@ -0,0 +1,259 @@
+package EPUtils
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// labels of InstanceClassification
+const (
+	// indices were wiped and replaced with a ransom note, by meow bot or ransom gangs
+	INSTANCE_LABEL_RANSOMED = "ransomed"
+	INSTANCE_LABEL_HONEYPOT = "honeypot"
+	// indices come from a framework, not from a business
+	INSTANCE_LABEL_FRAMEWORK_BOILERPLATE = "framework_boilerplate"
+	// indices are sample data from tutorials, like kibana_sample_data_flights
+	INSTANCE_LABEL_DEMO_DATASET = "demo_dataset"
+)
+
+var INSTANCE_LABELS = []string{
+	INSTANCE_LABEL_RANSOMED,
+	INSTANCE_LABEL_HONEYPOT,
+	INSTANCE_LABEL_FRAMEWORK_BOILERPLATE,
+	INSTANCE_LABEL_DEMO_DATASET,
+}
+
+// classifications less confident than this are not given
+const MIN_CLASSIFICATION_CONFIDENCE = 0.5
+
+// names of indices holding a ransom note, or left by meow bot in place of wiped ones, like 3ac0vxcqkm-meow
+var RansomNoteIndexNameRegexes = []*regexp.Regexp{
+	regexp.MustCompile(`^read[_-]*me`),
+	regexp.MustCompile(`(^|[-_.])meow$`),
+	regexp.MustCompile(`how[_-]?to[_-]?(recover|restore|get[_-]?back)`),
+	regexp.MustCompile(`recover[_-]?(your[_-]?)?(data|db|database|index|indices)`),
+	regexp.MustCompile(`^(warning|hacked|pwned|please[_-]?read)`),
+	regexp.MustCompile(`(backed[_-]?up|deleted)[_-]?(your[_-]?)?(data|db|database|indices)`),
+}
+
+// indices of sample data loaded by kibana, and of the shakespeare and logs tutorials in the elasticsearch docs.
+// no one names their own data like them
+var DEMO_DATASET_INDEX_NAMES = []string{
+	"kibana_sample_data_ecommerce",
+	"kibana_sample_data_flights",
+	"kibana_sample_data_logs",
+	"shakespeare",
+	"logstash-2015.05.18",
+	"logstash-2015.05.19",
+	"logstash-2015.05.20",
+}
+
+// indices of other tutorials in the elasticsearch docs. common names of real data on their own,
+// so they only count when at least MIN_TUTORIAL_INDICES_FOR_DEMO_DATASET of them are there
+var TUTORIAL_INDEX_NAMES = []string{
+	"bank",
+	"customer",
+	"megacorp",
+	"movies",
+	"twitter",
+}
+
+const MIN_TUTORIAL_INDICES_FOR_DEMO_DATASET = 3
+
+// root URL answers of honeypots pretending to be elasticsearch
+var HONEYPOT_FINGERPRINTS = []struct {
+	Name          string
+	VersionNumber string
+	NodeName      string
+}{
+	// https://github.com/jordan-wright/elastichoney
+	{"elastichoney", "1.4.1", "Flake"},
+}
+
+// honeypots fill every decoy index with the same data. only looked at with at least this many indices
+const MIN_INDICES_FOR_IDENTICAL_DECOYS = 3
+
+// InstanceClassification tells what kind of instance it is, judged from its whole set of indices
+type InstanceClassification struct {
+	// one of INSTANCE_LABEL_*
+	Label string `bson:"label" json:"label"`
+	// between MIN_CLASSIFICATION_CONFIDENCE and 1
+	Confidence float64 `bson:"confidence" json:"confidence"`
+	// index names, or the root URL answer, that led to the label
+	Evidence []string `bson:"evidence,omitempty" json:"evidence"`
+}
+
+// what an instance tells about itself, used to classify it
+type InstanceFacts struct {
+	// all indices from _cat/indices, including uninteresting ones
+	Indices []IndexFacts
+	// from the root URL. empty if unknown, like for kibana
+	VersionNumber string
+	NodeName      string
+}
+
+type IndexFacts struct {
+	Name string
+	// nil if unknown
+	DocsCount      *int64
+	StoreSizeBytes *int64
+}
+
+// indices not starting with a dot, which are internal to elastic products
+func (facts *InstanceFacts) dataIndexNames() []string {
+	var names []string
+	for _, index := range facts.Indices {
+		if !strings.HasPrefix(index.Name, ".") {
+			names = append(names, index.Name)
+		}
+	}
+
+	return names
+}
+
+type instanceClassifier struct {
+	label string
+	// returns the confidence between 0 and 1, and the evidence
+	classify func(facts *InstanceFacts, uninterestingIfAllOfTheseInIndices []string) (float64, []string)
+}
+
+// in the order of priority when confidences are the same
+var instanceClassifiers = []instanceClassifier{
+	{INSTANCE_LABEL_RANSOMED, classifyRansomed},
+	{INSTANCE_LABEL_HONEYPOT, classifyHoneypot},
+	{INSTANCE_LABEL_FRAMEWORK_BOILERPLATE, classifyFrameworkBoilerplate},
+	{INSTANCE_LABEL_DEMO_DATASET, classifyDemoDataset},
+}
+
+// returns the most confident classification of an instance, or nil if none is confident enough.
+// uninterestingIfAllOfTheseInIndices are index names coming from a framework, from the rules in use
+func ClassifyInstance(facts *InstanceFacts, uninterestingIfAllOfTheseInIndices []string) *InstanceClassification {
+	var classifications []*InstanceClassification
+	for _, classifier := range instanceClassifiers {
+		confidence, evidence := classifier.classify(facts, uninterestingIfAllOfTheseInIndices)
+		if confidence < MIN_CLASSIFICATION_CONFIDENCE {
+			continue
+		}
+		classifications = append(classifications, &InstanceClassification{
+			Label:      classifier.label,
+			Confidence: math.Round(confidence*100) / 100,
+			Evidence:   evidence,
+		})
+	}
+	if len(classifications) == 0 {
+		return nil
+	}
+	sort.SliceStable(classifications, func(i, j int) bool {
+		return classifications[i].Confidence > classifications[j].Confidence
+	})
+
+	return classifications[0]
+}
+
+func IsRansomNoteIndexName(indexName string) bool {
+	for _, regex := range RansomNoteIndexNameRegexes {
+		if regex.MatchString(strings.ToLower(indexName)) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// a ransom note is almost always left on purpose. it is certain if nothing else is left
+func classifyRansomed(facts *InstanceFacts, _ []string) (float64, []string) {
+	dataIndexNames := facts.dataIndexNames()
+	var noteIndexNames []string
+	for _, indexName := range dataIndexNames {
+		if IsRansomNoteIndexName(indexName) {
+			noteIndexNames = append(noteIndexNames, indexName)
+		}
+	}
+	switch {
+	case len(noteIndexNames) == 0:
+		return 0, nil
+	case len(noteIndexNames) == len(dataIndexNames):
+		return 1, noteIndexNames
+	}
+
+	return 0.9, noteIndexNames
+}
+
+func classifyHoneypot(facts *InstanceFacts, _ []string) (float64, []string) {
+	for _, fingerprint := range HONEYPOT_FINGERPRINTS {
+		if facts.VersionNumber == fingerprint.VersionNumber && facts.NodeName == fingerprint.NodeName {
+			return 0.95, []string{fmt.Sprintf("%s: version %s with node name %s", fingerprint.Name, fingerprint.VersionNumber, fingerprint.NodeName)}
+		}
+	}
+
+	// real indices hardly have the same number of docs and the same size
+	var decoys []IndexFacts
+	for _, index := range facts.Indices {
+		if !strings.HasPrefix(index.Name, ".") {
+			decoys = append(decoys, index)
+		}
+	}
+	if len(decoys) < MIN_INDICES_FOR_IDENTICAL_DECOYS {
+		return 0, nil
+	}
+	var evidence []string
+	for _, decoy := range decoys {
+		if decoy.DocsCount == nil || decoy.StoreSizeBytes == nil || *decoy.DocsCount == 0 ||
+			*decoy.DocsCount != *decoys[0].DocsCount || *decoy.StoreSizeBytes != *decoys[0].StoreSizeBytes {
+			return 0, nil
+		}
+		evidence = append(evidence, decoy.Name)
+	}
+
+	return 0.6, evidence
+}
+
+// certain if every one of uninterestingIfAllOfTheseInIndices is there
+func classifyFrameworkBoilerplate(facts *InstanceFacts, uninterestingIfAllOfTheseInIndices []string) (float64, []string) {
+	if len(uninterestingIfAllOfTheseInIndices) == 0 {
+		return 0, nil
+	}
+	var evidence []string
+	for _, frameworkIndexName := range uninterestingIfAllOfTheseInIndices {
+		for _, index := range facts.Indices {
+			if index.Name == frameworkIndexName {
+				evidence = append(evidence, frameworkIndexName)
+				break
+			}
+		}
+	}
+	if len(evidence) == len(uninterestingIfAllOfTheseInIndices) {
+		return 1, evidence
+	}
+	// a single one of them, like auth, is a common name on its own
+	if len(evidence) < 2 {
+		return 0, nil
+	}
+
+	return 0.8 * float64(len(evidence)) / float64(len(uninterestingIfAllOfTheseInIndices)), evidence
+}
+
+// the share of data indices that are demo datasets
+func classifyDemoDataset(facts *InstanceFacts, _ []string) (float64, []string) {
+	dataIndexNames := facts.dataIndexNames()
+	var evidence, tutorialIndexNames []string
+	for _, indexName := range dataIndexNames {
+		switch {
+		case ContainsExactlyMatchesWith(indexName, DEMO_DATASET_INDEX_NAMES) != -1:
+			evidence = append(evidence, indexName)
+		case ContainsExactlyMatchesWith(indexName, TUTORIAL_INDEX_NAMES) != -1:
+			tutorialIndexNames = append(tutorialIndexNames, indexName)
+		}
+	}
+	if len(tutorialIndexNames) >= MIN_TUTORIAL_INDICES_FOR_DEMO_DATASET {
+		evidence = append(evidence, tutorialIndexNames...)
+	}
+	if len(evidence) == 0 {
+		return 0, nil
+	}
+
+	return float64(len(evidence)) / float64(len(dataIndexNames)), evidence
+}
@@ -0,0 +1,115 @@
+package EPUtils
+
+import "testing"
+
+func indexFacts(name string, docsCount int64, storeSizeBytes int64) IndexFacts {
+	return IndexFacts{Name: name, DocsCount: &docsCount, StoreSizeBytes: &storeSizeBytes}
+}
+
+func TestClassifyInstance(t *testing.T) {
+	frameworkIndices := []string{"service", "actuator", "casa", "auth"}
+	for _, testCase := range []struct {
+		name               string
+		facts              InstanceFacts
+		expectedLabel      string
+		expectedConfidence float64
+	}{
+		{
+			name: "only a ransom note left",
+			facts: InstanceFacts{Indices: []IndexFacts{
+				indexFacts(".kibana_1", 3, 10240), indexFacts("read_me", 1, 5120),
+			}},
+			expectedLabel: INSTANCE_LABEL_RANSOMED, expectedConfidence: 1,
+		},
+		{
+			name: "meow bot left some indices",
+			facts: InstanceFacts{Indices: []IndexFacts{
+				indexFacts("3ac0vxcqkm-meow", 0, 208), indexFacts("customers", 100, 10240),
+			}},
+			expectedLabel: INSTANCE_LABEL_RANSOMED, expectedConfidence: 0.9,
+		},
+		{
+			name: "elastichoney",
+			facts: InstanceFacts{
+				Indices:       []IndexFacts{indexFacts("customers", 100, 10240)},
+				VersionNumber: "1.4.1", NodeName: "Flake",
+			},
+			expectedLabel: INSTANCE_LABEL_HONEYPOT, expectedConfidence: 0.95,
+		},
+		{
+			name: "identical decoys",
+			facts: InstanceFacts{Indices: []IndexFacts{
+				indexFacts("customers", 100, 10240), indexFacts("payments", 100, 10240), indexFacts("users", 100, 10240),
+			}},
+			expectedLabel: INSTANCE_LABEL_HONEYPOT, expectedConfidence: 0.6,
+		},
+		{
+			name: "all framework indices",
+			facts: InstanceFacts{Indices: []IndexFacts{
+				indexFacts("service", 1, 1), indexFacts("actuator", 2, 2), indexFacts("casa", 3, 3), indexFacts("auth", 4, 4),
+			}},
+			expectedLabel: INSTANCE_LABEL_FRAMEWORK_BOILERPLATE, expectedConfidence: 1,
+		},
+		{
+			name: "three of four framework indices",
+			facts: InstanceFacts{Indices: []IndexFacts{
+				indexFacts("service", 1, 1), indexFacts("actuator", 2, 2), indexFacts("casa", 3, 3),
+			}},
+			expectedLabel: INSTANCE_LABEL_FRAMEWORK_BOILERPLATE, expectedConfidence: 0.6,
+		},
+		{
+			name: "kibana sample data",
+			facts: InstanceFacts{Indices: []IndexFacts{
+				indexFacts(".kibana_1", 3, 10240), indexFacts("kibana_sample_data_flights", 13059, 6291456),
+				indexFacts("kibana_sample_data_logs", 14074, 11534336),
+			}},
+			expectedLabel: INSTANCE_LABEL_DEMO_DATASET, expectedConfidence: 1,
+		},
+		{
+			name: "elasticsearch tutorials",
+			facts: InstanceFacts{Indices: []IndexFacts{
+				indexFacts("bank", 1000, 10240), indexFacts("customer", 1, 1024), indexFacts("megacorp", 3, 1024),
+				indexFacts("orders", 100, 10240),
+			}},
+			expectedLabel: INSTANCE_LABEL_DEMO_DATASET, expectedConfidence: 0.75,
+		},
+	} {
+		classification := ClassifyInstance(&testCase.facts, frameworkIndices)
+		if classification == nil {
+			t.Errorf("%s: expected %s but got nothing", testCase.name, testCase.expectedLabel)
+			continue
+		}
+		if classification.Label != testCase.expectedLabel || classification.Confidence != testCase.expectedConfidence {
+			t.Errorf("%s: expected %s (%.2f) but got %+v", testCase.name, testCase.expectedLabel, testCase.expectedConfidence, *classification)
+		}
+	}
+
+	for _, facts := range []InstanceFacts{
+		{Indices: []IndexFacts{indexFacts("customers", 100, 10240), indexFacts("logs-2021", 1000, 1048576)}},
+		// a single framework index name is common on its own
+		{Indices: []IndexFacts{indexFacts("auth", 10, 10240), indexFacts("orders", 100, 10240)}},
+		// a demo dataset among real data
+		{Indices: []IndexFacts{indexFacts("bank", 1000, 10240), indexFacts("orders", 100, 10240), indexFacts("users", 10, 1024)}},
+		// tutorial names are common names of real data on their own
+		{Indices: []IndexFacts{indexFacts("customer", 1000, 10240)}},
+		{Indices: []IndexFacts{indexFacts("customer", 1000, 10240), indexFacts("twitter", 100, 10240)}},
+		{},
+	} {
+		if classification := ClassifyInstance(&facts, frameworkIndices); classification != nil {
+			t.Errorf("expected no classification of %+v but got %+v", facts.Indices, *classification)
+		}
+	}
+}
+
+func TestIsRansomNoteIndexName(t *testing.T) {
+	for _, indexName := range []string{"read_me", "README", "read__me_to_recover", "3ac0vxcqkm-meow", "how_to_recover_your_data", "warning"} {
+		if !IsRansomNoteIndexName(indexName) {
+			t.Errorf("expected %s to be a ransom note", indexName)
+		}
+	}
+	for _, indexName := range []string{"readings", "homeowners", "customers", "recovery-logs"} {
+		if IsRansomNoteIndexName(indexName) {
+			t.Errorf("expected %s not to be a ransom note", indexName)
+		}
+	}
+}
@@ -1,6 +1,11 @@
 package EPUtils
 
-import "sync/atomic"
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+)
 
 type Count32 int32
 
@@ -15,3 +20,81 @@ func (c *Count32) Dec() int32 {
 func (c *Count32) Get() int32 {
 	return atomic.LoadInt32((*int32)(c))
 }
+
+// returns a context that gets cancelled gracePeriod after parent is done.
+// use it for work that should be allowed to finish for a while even after parent got cancelled.
+func WithGracePeriod(parent context.Context, gracePeriod time.Duration) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		select {
+		case <-parent.Done():
+			timer := time.NewTimer(gracePeriod)
+			defer timer.Stop()
+			select {
+			case <-timer.C:
+				cancel()
+			case <-ctx.Done():
+			}
+		case <-ctx.Done():
+		}
+	}()
+
+	return ctx, cancel
+}
+
+// runs work for each item received from items in a new goroutine, at most cap(concurrentGoroutines) at once.
+// items are scheduled as they arrive, until items is closed or ctx is cancelled.
+// returns the number of items scheduled.
+// call wg.Wait() to wait for the scheduled items to finish.
+func ScheduleWhileNotCancelled(
+	ctx context.Context,
+	items <-chan string,
+	concurrentGoroutines chan struct{},
+	wg *sync.WaitGroup,
+	work func(item string),
+) int {
+	scheduledCount := 0
+	for {
+		var item string
+		select {
+		case <-ctx.Done():
+			return scheduledCount
+		case receivedItem, ok := <-items:
+			if !ok {
+				return scheduledCount
+			}
+			item = receivedItem
+		}
+		select {
+		case <-ctx.Done():
+			return scheduledCount
+		case concurrentGoroutines <- struct{}{}:
+		}
+		scheduledCount++
+		wg.Add(1)
+		go func(item string) {
+			defer wg.Done()
+			defer func() { <-concurrentGoroutines }()
+			work(item)
+		}(item)
+	}
+}
+
+// logs the message from getMessage every interval until the returned function is called
+func LogProgressPeriodically(interval time.Duration, getMessage func() string) (stop func()) {
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				EPLogger(getMessage())
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	return func() { close(done) }
+}
@@ -0,0 +1,53 @@
+package EPUtils
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestWithGracePeriod(t *testing.T) {
+	parent, cancelParent := context.WithCancel(context.Background())
+	ctx, cancel := WithGracePeriod(parent, 50*time.Millisecond)
+	defer cancel()
+
+	cancelParent()
+	if ctx.Err() != nil {
+		t.Errorf("context was cancelled right after parent was cancelled, without grace period")
+	}
+
+	select {
+	case <-ctx.Done():
+	case <-time.After(time.Second):
+		t.Errorf("context was not cancelled after grace period")
+	}
+}
+
+func TestScheduleWhileNotCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	items := []string{"a", "b", "c", "d", "e"}
+	itemsChannel := make(chan string, len(items))
+	for _, item := range items {
+		itemsChannel <- item
+	}
+	close(itemsChannel)
+	concurrentGoroutines := make(chan struct{}, 1)
+	wg := sync.WaitGroup{}
+	var doneCount Count32
+
+	scheduledCount := ScheduleWhileNotCancelled(ctx, itemsChannel, concurrentGoroutines, &wg, func(item string) {
+		if item == "b" {
+			cancel()
+		}
+		doneCount.Inc()
+	})
+	wg.Wait()
+
+	if scheduledCount >= len(items) {
+		t.Errorf("expected scheduling to stop after cancellation, but all %d items were scheduled", scheduledCount)
+	}
+	if int(doneCount.Get()) != scheduledCount {
+		t.Errorf("expected all %d scheduled items to finish, but %d finished", scheduledCount, doneCount.Get())
+	}
+}
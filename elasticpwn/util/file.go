@@ -1,8 +1,12 @@
 package EPUtils
 
 import (
+	"bufio"
+	"bytes"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"log"
 	"os"
@@ -29,37 +33,55 @@ func ReadUrlsFromFile(path_to_url_text_file string) string {
 // [{"something": 1 },
 // {"something": 2 },
 // {"something": 3 }]
+// the file is streamed into a temporary file, so it is never read into memory at once.
 func ConvertJSONObjectsToJSONArray(pathToJsonFile string) {
-	output, err := ioutil.ReadFile(pathToJsonFile)
+	src, err := os.Open(pathToJsonFile)
 	ExitOnError(err)
+	defer src.Close()
 
+	stat, err := src.Stat()
+	ExitOnError(err)
+	contentSize := stat.Size()
+	// no object was written, or only the "[" left by ReopenJSONArrayForAppending
+	if contentSize < 2 {
+		src.Close()
+		ExitOnError(os.WriteFile(pathToJsonFile, []byte("[]"), 0644))
+		return
+	}
 	// this is because we can't take care of the last comma when we finish writing json
-	withoutLastTrailingComma := strings.TrimSuffix(string(output), ",\n")
-	// right square bracket of the JSON array
-	output = append([]byte(withoutLastTrailingComma), "]"...)
+	tail, err := readFileTail(src, contentSize, 2)
+	ExitOnError(err)
+	if string(tail) == ",\n" {
+		contentSize -= 2
+	}
+	head, err := readFileTail(src, 1, 1)
+	ExitOnError(err)
 
 	tmpFile := fmt.Sprintf("%s.tmp", pathToJsonFile)
-	f, err := os.OpenFile(tmpFile, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
-	defer func() {
-		err := f.Close()
-		if err != nil {
-			EPLogger(fmt.Sprintf("Failed to close %v while finalizing\n", pathToJsonFile))
-			return
-		}
-	}()
-
+	f, err := os.OpenFile(tmpFile, os.O_WRONLY|os.O_TRUNC|os.O_CREATE, 0644)
 	if err != nil {
 		EPLogger(fmt.Sprintf("Failed to open %v while finalizing\n", pathToJsonFile))
 		return
 	}
 
-	// left square bracket of the JSON array
-	_, err = f.WriteString("[")
+	// left square bracket of the JSON array.
+	// it is already there if the file was reopened by ReopenJSONArrayForAppending
+	if string(head) != "[" {
+		_, err = f.WriteString("[")
+		ExitOnError(err)
+	}
+	_, err = io.CopyN(f, src, contentSize)
 	ExitOnError(err)
-
-	_, err = f.Write(output)
+	// right square bracket of the JSON array
+	_, err = f.WriteString("]")
 	ExitOnError(err)
 
+	if err := f.Close(); err != nil {
+		EPLogger(fmt.Sprintf("Failed to close %v while finalizing\n", pathToJsonFile))
+		return
+	}
+	src.Close()
+
 	err = os.Remove(pathToJsonFile)
 	ExitOnError(err)
 
@@ -67,6 +89,146 @@ func ConvertJSONObjectsToJSONArray(pathToJsonFile string) {
 	ExitOnError(err)
 }
 
+// reads the last n bytes before offset end of f (or less if the file is shorter)
+func readFileTail(f *os.File, end int64, n int64) ([]byte, error) {
+	if end < n {
+		n = end
+	}
+	tail := make([]byte, n)
+	if _, err := f.ReadAt(tail, end-n); err != nil {
+		return nil, err
+	}
+
+	return tail, nil
+}
+
+// streams JSON objects written one per line (jsonl), optionally followed by a comma like plain mode does,
+// into a JSON array. Only a single line is held in memory at once.
+// returns the number of objects converted.
+func ConvertJSONLinesToJSONArray(r io.Reader, w io.Writer) (int, error) {
+	reader := bufio.NewReader(r)
+	writer := bufio.NewWriter(w)
+	count := 0
+
+	if _, err := writer.WriteString("["); err != nil {
+		return count, err
+	}
+	for lineNum := 1; ; lineNum++ {
+		line, readErr := reader.ReadBytes('\n')
+		if readErr != nil && !errors.Is(readErr, io.EOF) {
+			return count, readErr
+		}
+		object := bytes.TrimSuffix(bytes.TrimSpace(line), []byte(","))
+		if len(object) > 0 {
+			if !json.Valid(object) {
+				return count, fmt.Errorf("line %d is not a valid JSON value", lineNum)
+			}
+			if count > 0 {
+				if _, err := writer.WriteString(",\n"); err != nil {
+					return count, err
+				}
+			}
+			if _, err := writer.Write(object); err != nil {
+				return count, err
+			}
+			count++
+		}
+		if errors.Is(readErr, io.EOF) {
+			break
+		}
+	}
+	if _, err := writer.WriteString("]\n"); err != nil {
+		return count, err
+	}
+
+	return count, writer.Flush()
+}
+
+// streams elements of a JSON array into JSON lines (one element per line).
+// Only a single element is held in memory at once.
+// returns the number of elements converted.
+func ConvertJSONArrayToJSONLines(r io.Reader, w io.Writer) (int, error) {
+	decoder := json.NewDecoder(bufio.NewReader(r))
+	writer := bufio.NewWriter(w)
+	count := 0
+
+	token, err := decoder.Token()
+	if err != nil {
+		return count, err
+	}
+	if delim, ok := token.(json.Delim); !ok || delim != '[' {
+		return count, errors.New("input is not a JSON array")
+	}
+	compacted := &bytes.Buffer{}
+	for decoder.More() {
+		var element json.RawMessage
+		if err := decoder.Decode(&element); err != nil {
+			return count, err
+		}
+		compacted.Reset()
+		if err := json.Compact(compacted, element); err != nil {
+			return count, err
+		}
+		compacted.WriteByte('\n')
+		if _, err := writer.Write(compacted.Bytes()); err != nil {
+			return count, err
+		}
+		count++
+	}
+	if _, err := decoder.Token(); err != nil {
+		return count, err
+	}
+
+	return count, writer.Flush()
+}
+
+// reverts ConvertJSONObjectsToJSONArray so that more objects can be appended to the file,
+// by turning the trailing "]" back into ",\n".
+// The leading "[" is kept, and ConvertJSONObjectsToJSONArray will not add another one.
+// Does nothing if the file does not exist or is not a finalized JSON array.
+func ReopenJSONArrayForAppending(pathToJsonFile string) error {
+	f, err := os.OpenFile(filepath.FromSlash(pathToJsonFile), os.O_RDWR, 0644)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	firstByte := make([]byte, 1)
+	if _, err := f.ReadAt(firstByte, 0); err != nil || firstByte[0] != '[' {
+		// empty, or still a list of objects that was never finalized
+		return nil
+	}
+
+	stat, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	// the file ends with "]", possibly followed by whitespace
+	tail, err := readFileTail(f, stat.Size(), 16)
+	if err != nil {
+		return err
+	}
+	tailSize := int64(len(tail))
+	trimmedTail := strings.TrimRight(string(tail), " \r\n\t")
+	if !strings.HasSuffix(trimmedTail, "]") {
+		return fmt.Errorf("%v starts with \"[\" but does not end with \"]\"", pathToJsonFile)
+	}
+	closingBracketOffset := stat.Size() - tailSize + int64(len(trimmedTail)) - 1
+	if err := f.Truncate(closingBracketOffset); err != nil {
+		return err
+	}
+	// "[]" becomes "[" and the next object can be appended right away
+	if closingBracketOffset == 1 {
+		return nil
+	}
+	_, err = f.WriteAt([]byte(",\n"), closingBracketOffset)
+
+	return err
+}
+
 func ReadFile(path string) []byte {
 	file, err := os.Open(filepath.FromSlash(path))
 	if err != nil {
@@ -0,0 +1,97 @@
+package EPUtils
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestConvertJSONLinesToJSONArray(t *testing.T) {
+	// plain mode output has trailing commas, and jsonl doesn't
+	input := "{\"rootUrl\":\"1.1.1.1:9200\"},\n\n{\"rootUrl\":\"2.2.2.2:9200\"}\n{\"rootUrl\":\"3.3.3.3:9200\"}"
+	output := &bytes.Buffer{}
+
+	count, err := ConvertJSONLinesToJSONArray(strings.NewReader(input), output)
+	if err != nil {
+		t.Fatalf("failed to convert: %v", err)
+	}
+	if count != 3 {
+		t.Errorf("expected 3 objects but got %d", count)
+	}
+	var array []map[string]string
+	if err := json.Unmarshal(output.Bytes(), &array); err != nil {
+		t.Fatalf("output is not a valid JSON array: %v", err)
+	}
+	if len(array) != 3 || array[2]["rootUrl"] != "3.3.3.3:9200" {
+		t.Errorf("unexpected output: %s", output.String())
+	}
+}
+
+func TestConvertJSONArrayToJSONLines(t *testing.T) {
+	input := `[
+		{"rootUrl": "1.1.1.1:9200", "indices": [{"index": "a"}]},
+		{"rootUrl": "2.2.2.2:9200"}
+	]`
+	output := &bytes.Buffer{}
+
+	count, err := ConvertJSONArrayToJSONLines(strings.NewReader(input), output)
+	if err != nil {
+		t.Fatalf("failed to convert: %v", err)
+	}
+	if count != 2 {
+		t.Errorf("expected 2 elements but got %d", count)
+	}
+	lines := strings.Split(strings.TrimSuffix(output.String(), "\n"), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("expected 2 lines but got %d: %s", len(lines), output.String())
+	}
+	for _, line := range lines {
+		if !json.Valid([]byte(line)) {
+			t.Errorf("%s is not valid JSON", line)
+		}
+	}
+}
+
+func TestReopenJSONArrayForAppending(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "out.json")
+	if err := os.WriteFile(path, []byte("{\"a\":1},\n{\"a\":2},\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	ConvertJSONObjectsToJSONArray(path)
+
+	if err := ReopenJSONArrayForAppending(path); err != nil {
+		t.Fatalf("failed to reopen: %v", err)
+	}
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString("{\"a\":3},\n")
+	f.Close()
+	ConvertJSONObjectsToJSONArray(path)
+
+	var array []map[string]int
+	if err := json.Unmarshal(ReadFile(path), &array); err != nil {
+		t.Fatalf("output is not a valid JSON array: %v", err)
+	}
+	if len(array) != 3 {
+		t.Errorf("expected 3 objects but got %d", len(array))
+	}
+}
+
+func TestConvertJSONObjectsToJSONArrayWithoutObjects(t *testing.T) {
+	for _, content := range []string{"", "["} {
+		path := filepath.Join(t.TempDir(), "out.json")
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		ConvertJSONObjectsToJSONArray(path)
+
+		if output := string(ReadFile(path)); output != "[]" {
+			t.Errorf("expected [] from %q but got %q", content, output)
+		}
+	}
+}
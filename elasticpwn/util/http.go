@@ -1,124 +1,526 @@
 package EPUtils
 
 import (
+	"bytes"
 	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
+	"net"
 	"net/http"
-	"regexp"
+	"net/url"
+	"path/filepath"
+	"strconv"
 	"strings"
+	"sync"
+	"syscall"
 	"time"
 )
 
-type RetryReason int8
-
-const (
-	None             RetryReason = 0
-	SHOULD_TRY_HTTPS RetryReason = 1
-	SHOULD_TRY_HTTP  RetryReason = 2
-)
 const (
 	HTTPS = "https"
 	HTTP  = "http"
 )
 
-// reuse http client.
-// if declared inside the function,
+var PROXY_SCHEMES = []string{"http", "https", "socks5"}
+
+// everything about how requests are sent to the scanned instances
+type HTTPClientOptions struct {
+	// http://, https:// or socks5:// url of a proxy to send all requests through. empty to connect directly
+	ProxyUrl string
+	// path to a PEM file with CA certificates to trust in addition to the system ones
+	CACertPath         string
+	InsecureSkipVerify bool
+	// sent with every request. overrides headers of the same name set by plugins
+	Headers map[string]string
+	// time allowed for connecting and TLS handshake
+	ConnectTimeout time.Duration
+	// time allowed for sending a request and reading its whole response once connected
+	ReadTimeout time.Duration
+	// response bodies are cut off at this many bytes. 0 means no limit
+	MaxResponseSize int64
+	// how many times to retry a request failed for a transient reason. 0 means no retries
+	Retries int
+	// wait before the first retry. doubled on each retry after that
+	RetryBackoff time.Duration
+	// across all hosts. 0 means no limit
+	RequestsPerSecond float64
+	// for each host. 0 means no limit
+	RequestsPerSecondPerHost float64
+	// redirects out of scope are not followed. nil allows everything
+	Scope *Scope
+}
+
+// HTTPClient is shared by all goroutines of a plugin.
+// if a client is created per request instead,
 // the memory usage will spike, leading to a forceful exit
-var httpClient = http.Client{Transport: &http.Transport{DisableKeepAlives: true}}
-
-func SendFailSafeHTTPRequest(endpoint string, timeoutsecs int, disableRetries bool, headers map[string]string, method string) (string, int, error) {
-	var (
-		err         error
-		response    *http.Response
-		retries     int         = 1
-		retryReason RetryReason = 0
-		cancelFuncs []context.CancelFunc
-	)
-	for retries > 0 {
-		var maybeFixedEndpoint = func(retryMode RetryReason, endpoint string) string {
-			switch retryReason {
-			case SHOULD_TRY_HTTPS:
-				EPLogger(fmt.Sprintf("Retrying with https because http did not work: %v", endpoint))
-				firstHttpStringOccurenceRegex := regexp.MustCompile("^(.*?)http(.*)$")
-				return firstHttpStringOccurenceRegex.ReplaceAllString(endpoint, HTTPS)
-			case SHOULD_TRY_HTTP:
-				EPLogger(fmt.Sprintf("Retrying with http because https did not work: %v", endpoint))
-				firstHttpsStringOccurenceRegex := regexp.MustCompile("^(.*?)https(.*)$")
-				return firstHttpsStringOccurenceRegex.ReplaceAllString(endpoint, HTTPS)
-			default:
-				return endpoint
+type HTTPClient struct {
+	options HTTPClientOptions
+	client  *http.Client
+	// same as client, but never verifies certificates nor follows redirects. only used to read certificates
+	certificateClient *http.Client
+	// host (123.123.123.123:9200) -> http or https
+	schemes sync.Map
+	// nil if there is no limit
+	rateLimiter      *RateLimiter
+	hostRateLimiters *HostRateLimiters
+	resolver         *Resolver
+}
+
+func NewHTTPClient(options HTTPClientOptions) (*HTTPClient, error) {
+	tlsConfig := &tls.Config{
+		// most of the instances out there use self-signed certificates anyway
+		InsecureSkipVerify: options.InsecureSkipVerify,
+	}
+	if options.CACertPath != "" {
+		rootCAs, err := x509.SystemCertPool()
+		if err != nil {
+			rootCAs = x509.NewCertPool()
+		}
+		caCert, err := ioutil.ReadFile(filepath.FromSlash(options.CACertPath))
+		if err != nil {
+			return nil, err
+		}
+		if !rootCAs.AppendCertsFromPEM(caCert) {
+			return nil, fmt.Errorf("no PEM certificates found in %v", options.CACertPath)
+		}
+		tlsConfig.RootCAs = rootCAs
+	}
+
+	dialer := &net.Dialer{
+		Timeout: options.ConnectTimeout,
+	}
+	transport := &http.Transport{
+		DisableKeepAlives:   true,
+		DialContext:         dialer.DialContext,
+		TLSHandshakeTimeout: options.ConnectTimeout,
+		TLSClientConfig:     tlsConfig,
+	}
+	if options.ProxyUrl != "" {
+		proxyUrl, err := ParseProxyUrl(options.ProxyUrl)
+		if err != nil {
+			return nil, err
+		}
+		// socks5 is supported by net/http out of the box
+		transport.Proxy = http.ProxyURL(proxyUrl)
+	}
+
+	httpClient := &HTTPClient{
+		options:          options,
+		rateLimiter:      NewRateLimiter(options.RequestsPerSecond),
+		hostRateLimiters: NewHostRateLimiters(options.RequestsPerSecondPerHost),
+	}
+	httpClient.resolver = &Resolver{
+		rateLimiter:      httpClient.rateLimiter,
+		hostRateLimiters: httpClient.hostRateLimiters,
+		isProxied:        options.ProxyUrl != "",
+	}
+	if options.ProxyUrl == "" && options.Scope != nil {
+		// with a proxy, only the proxy is dialed. hostnames are refused by CheckScope instead
+		transport.DialContext = dialInScope(options.Scope, dialer, httpClient.resolver.lookupIPInTurn)
+	}
+	httpClient.client = &http.Client{
+		Transport: transport,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			// same as the default policy of net/http
+			if len(via) >= 10 {
+				return errors.New("stopped after 10 redirects")
 			}
-		}(retryReason, endpoint)
-		var maybeFixedEndpointWithPrefix = func(endpoint string) string {
-			if !strings.HasPrefix(endpoint, "http://") && !strings.HasPrefix(endpoint, "https://") {
-				return fmt.Sprintf("http://%s", endpoint)
+			if err := httpClient.CheckScope(req.Context(), req.URL.String()); err != nil {
+				EPLogger(fmt.Sprintf("Not following redirect from %v to %v: %v", via[len(via)-1].URL, req.URL, err))
+				return err
 			}
 
-			return endpoint
-		}(maybeFixedEndpoint)
-		ctx, cancel := context.WithTimeout(context.Background(), time.Duration(timeoutsecs)*time.Second)
-		cancelFuncs = append(cancelFuncs, cancel)
-		var req *http.Request
+			return nil
+		},
+	}
+
+	certificateTransport := transport.Clone()
+	certificateTransport.TLSClientConfig.InsecureSkipVerify = true
+	httpClient.certificateClient = &http.Client{
+		Transport: certificateTransport,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+
+	return httpClient, nil
+}
+
+// returns the certificates that hostAndPort (123.123.123.123:5601) presents over https.
+// sent through the proxy like any other request, and only if hostAndPort is in scope and once it is its turn if requests are rate limited.
+// the certificates are not verified, since most of them are self-signed anyway
+func (httpClient *HTTPClient) GetPeerCertificates(parentCtx context.Context, hostAndPort string) ([]*x509.Certificate, error) {
+	if err := httpClient.CheckScope(parentCtx, hostAndPort); err != nil {
+		return nil, err
+	}
+	if err := httpClient.rateLimiter.Wait(parentCtx); err != nil {
+		return nil, err
+	}
+	if err := httpClient.hostRateLimiters.Wait(parentCtx, hostAndPort); err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(parentCtx, httpClient.options.ConnectTimeout+httpClient.options.ReadTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, "GET", fmt.Sprintf("%s://%s/", HTTPS, hostAndPort), nil)
+	if err != nil {
+		return nil, err
+	}
+	for key, header := range httpClient.options.Headers {
+		req.Header.Set(key, header)
+	}
+	response, err := httpClient.certificateClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+	if response.TLS == nil {
+		return nil, fmt.Errorf("%v did not answer over TLS", hostAndPort)
+	}
+
+	return response.TLS.PeerCertificates, nil
+}
+
+// does every DNS lookup for the requests of httpClient, and should do any other lookup too
+func (httpClient *HTTPClient) Resolver() *Resolver {
+	return httpClient.resolver
+}
 
-		if method != "GET" && method != "POST" {
-			panic(fmt.Sprintf("%v is not an accepted http method", method))
+// returns an error wrapping ErrOutOfScope if target must not be touched
+func (httpClient *HTTPClient) CheckScope(ctx context.Context, target string) error {
+	return httpClient.checkScopeResolvedWith(ctx, target, httpClient.resolver.LookupIP)
+}
+
+func (httpClient *HTTPClient) checkScopeResolvedWith(ctx context.Context, target string, lookupIP func(ctx context.Context, host string) ([]net.IP, error)) error {
+	if httpClient.options.ProxyUrl != "" {
+		if err := httpClient.options.Scope.CheckProxiedTarget(target); err != nil {
+			return err
+		}
+	}
+
+	return httpClient.options.Scope.checkResolvedWith(ctx, target, lookupIP)
+}
+
+// resolves the host of each connection on its own with lookupIP, and connects only to the addresses in scope,
+// so that the address checked is the address connected to
+func dialInScope(scope *Scope, dialer *net.Dialer, lookupIP func(ctx context.Context, host string) ([]net.IP, error)) func(ctx context.Context, network string, addr string) (net.Conn, error) {
+	return func(ctx context.Context, network string, addr string) (net.Conn, error) {
+		host, rawPort, err := net.SplitHostPort(addr)
+		if err != nil {
+			return nil, err
 		}
-		req, err = http.NewRequestWithContext(ctx, method, maybeFixedEndpointWithPrefix, nil)
+		port, err := strconv.Atoi(rawPort)
 		if err != nil {
-			EPLogger(fmt.Sprintf("Failed to send request to %v\n", maybeFixedEndpointWithPrefix))
+			return nil, fmt.Errorf("invalid port in %v", addr)
+		}
+		ips := []net.IP{net.ParseIP(host)}
+		if ips[0] == nil {
+			if ips, err = lookupIP(ctx, host); err != nil {
+				return nil, err
+			}
+		}
 
-			if disableRetries {
-				break
-			} else {
-				retries -= 1
+		for _, ip := range ips {
+			if err = scope.CheckAddress(host, ip, port); err != nil {
+				EPLogger(fmt.Sprintf("Not connecting to %v: %v", addr, err))
 				continue
 			}
+			var conn net.Conn
+			if conn, err = dialer.DialContext(ctx, network, net.JoinHostPort(ip.String(), rawPort)); err == nil {
+				return conn, nil
+			}
 		}
-		for key, header := range headers {
-			req.Header.Set(key, header)
+		if err == nil {
+			err = fmt.Errorf("no address found for %v", host)
 		}
-		response, err = httpClient.Do(req)
 
-		if err != nil {
-			EPLogger(fmt.Sprintf("Failed to fetch from %s\n", maybeFixedEndpointWithPrefix))
-			if !disableRetries {
-				EPLogger(fmt.Sprintf("Remaining retries for %s: %d times\n", maybeFixedEndpointWithPrefix, retries))
-			}
-			var errorMessage = fmt.Sprint(err)
-			if strings.Contains(errorMessage, "server gave HTTP response to HTTPS client") {
-				EPLogger("Retrying with HTTP instead of HTTPS")
-				retryReason = SHOULD_TRY_HTTP
-			} else if strings.Contains(errorMessage, "server gave HTTPS response to HTTP client") {
-				EPLogger("Retrying with HTTPS instead of HTTP")
-				retryReason = SHOULD_TRY_HTTPS
-			}
-			if disableRetries {
-				break
-			} else {
-				retries -= 1
+		return nil, err
+	}
+}
+
+func ParseProxyUrl(rawProxyUrl string) (*url.URL, error) {
+	proxyUrl, err := url.Parse(rawProxyUrl)
+	if err != nil {
+		return nil, err
+	}
+	if ContainsExactlyMatchesWith(proxyUrl.Scheme, PROXY_SCHEMES) == -1 || proxyUrl.Host == "" {
+		return nil, fmt.Errorf("%v is not a valid proxy url. It should look like %v://host:port", rawProxyUrl, strings.Join(PROXY_SCHEMES, "|"))
+	}
+
+	return proxyUrl, nil
+}
+
+// sends a request to endpoint, which may or may not have a scheme (123.123.123.123:9200/_cat/indices).
+// the first request to a host probes whether it speaks http or https, and the scheme that worked
+// is used for all later requests to the same host.
+// transient failures (timeouts, connection resets, 429 and 503) are retried with exponential backoff
+// unless disableRetries is set.
+// the response body is cut off at MaxResponseSize.
+func (httpClient *HTTPClient) SendFailSafeHTTPRequest(parentCtx context.Context, endpoint string, disableRetries bool, headers map[string]string, method string) (string, int, error) {
+	var data []byte
+	statusCode, truncated, err := httpClient.SendFailSafeHTTPRequestStreaming(parentCtx, endpoint, disableRetries, headers, method, func(statusCode int, body io.Reader) error {
+		var readErr error
+		data, readErr = ioutil.ReadAll(body)
+
+		return readErr
+	})
+	if truncated {
+		httpClient.logTruncation(endpoint)
+	}
+	if err != nil {
+		return "", statusCode, err
+	}
+
+	return string(data), statusCode, nil
+}
+
+// same as SendFailSafeHTTPRequest, but hands the response body to handleBody as a stream
+// instead of reading all of it into memory first. handleBody is called once, only if there was a response.
+// truncated is true if the body was cut off at MaxResponseSize, which is only known if handleBody read it to the end.
+func (httpClient *HTTPClient) SendFailSafeHTTPRequestStreaming(
+	parentCtx context.Context,
+	endpoint string,
+	disableRetries bool,
+	headers map[string]string,
+	method string,
+	handleBody func(statusCode int, body io.Reader) error,
+) (statusCode int, truncated bool, err error) {
+	if method != "GET" && method != "POST" {
+		panic(fmt.Sprintf("%v is not an accepted http method", method))
+	}
+	host, pathAndQuery, explicitScheme := splitEndpoint(endpoint)
+
+	var response *httpResponse
+	for _, scheme := range httpClient.schemesToTry(host, explicitScheme, httpClient.hasCredentials(headers)) {
+		response, err = httpClient.sendWithRetries(parentCtx, fmt.Sprintf("%s://%s%s", scheme, host, pathAndQuery), disableRetries, headers, method)
+		if !isSchemeMismatch(scheme, response, err) {
+			if err == nil {
+				httpClient.schemes.Store(host, scheme)
 			}
-		} else {
 			break
 		}
+		if response != nil {
+			response.Close()
+			response = nil
+		}
+		EPLogger(fmt.Sprintf("%v does not seem to speak %v", host, scheme))
+	}
+	if response == nil {
+		return -1, false, err
+	}
+	defer response.Close()
+
+	if httpClient.options.MaxResponseSize <= 0 {
+		return response.statusCode, false, handleBody(response.statusCode, response.body)
+	}
+	body := &truncatingReader{r: response.body, remaining: httpClient.options.MaxResponseSize}
+	err = handleBody(response.statusCode, body)
+
+	return response.statusCode, body.truncated, err
+}
+
+func (httpClient *HTTPClient) logTruncation(endpoint string) {
+	EPLogger(fmt.Sprintf("Response from %v was cut off at %d bytes. Raise -max-response-size to get all of it", endpoint, httpClient.options.MaxResponseSize))
+}
+
+// reads up to remaining bytes from r, and records whether r had more than that
+type truncatingReader struct {
+	r         io.Reader
+	remaining int64
+	truncated bool
+}
+
+func (reader *truncatingReader) Read(p []byte) (int, error) {
+	if reader.remaining <= 0 {
+		if !reader.truncated {
+			var probe [1]byte
+			n, _ := io.ReadFull(reader.r, probe[:])
+			reader.truncated = n > 0
+		}
+		return 0, io.EOF
+	}
+	if int64(len(p)) > reader.remaining {
+		p = p[:reader.remaining]
 	}
+	n, err := reader.r.Read(p)
+	reader.remaining -= int64(n)
 
-	if response != nil {
-		data, err := ioutil.ReadAll(response.Body)
-		response.Body.Close()
-		for _, c := range cancelFuncs {
-			c()
+	return n, err
+}
+
+// 123.123.123.123:9200/_cat/indices -> 123.123.123.123:9200, /_cat/indices, ""
+// https://123.123.123.123:9200 -> 123.123.123.123:9200, "", https
+func splitEndpoint(endpoint string) (host string, pathAndQuery string, scheme string) {
+	for _, s := range []string{HTTPS, HTTP} {
+		if strings.HasPrefix(endpoint, s+"://") {
+			scheme = s
+			endpoint = strings.TrimPrefix(endpoint, s+"://")
+			break
 		}
+	}
+	if pathStart := strings.IndexAny(endpoint, "/?"); pathStart != -1 {
+		return endpoint[:pathStart], endpoint[pathStart:], scheme
+	}
+
+	return endpoint, "", scheme
+}
 
+// an explicit https target is never downgraded to http, even if the host was found to speak http before.
+// a target without a scheme is tried over https first if credentials are sent,
+// so that they are not sent in cleartext to a host that speaks https.
+// for the same reason, http found for the host before is not trusted when credentials are sent
+func (httpClient *HTTPClient) schemesToTry(host string, explicitScheme string, hasCredentials bool) []string {
+	if explicitScheme == HTTPS {
+		return []string{HTTPS}
+	}
+	if knownScheme, ok := httpClient.schemes.Load(host); ok && !(hasCredentials && knownScheme == HTTP) {
+		return []string{knownScheme.(string)}
+	}
+	switch {
+	case explicitScheme == "" && hasCredentials:
+		return []string{HTTPS, HTTP}
+	}
+
+	return []string{HTTP, HTTPS}
+}
+
+// returns true if an Authorization header is sent along with headers, from -creds or -H
+func (httpClient *HTTPClient) hasCredentials(headers map[string]string) bool {
+	for _, sentHeaders := range []map[string]string{headers, httpClient.options.Headers} {
+		for key, header := range sentHeaders {
+			if strings.EqualFold(key, "Authorization") && header != "" {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// returns true if the request failed only because the host speaks the other scheme.
+// hosts that are down (timeouts, refused connections) never speak the other scheme either.
+func isSchemeMismatch(scheme string, response *httpResponse, err error) bool {
+	if err == nil {
+		if scheme != HTTP || response.statusCode != http.StatusBadRequest {
+			return false
+		}
+		// nginx: "The plain HTTP request was sent to HTTPS port"
+		// go: "Client sent an HTTP request to an HTTPS server."
+		return strings.Contains(strings.ToLower(string(response.peekBody(1024))), HTTPS)
+	}
+	var netErr net.Error
+	if errors.Is(err, context.Canceled) || (errors.As(err, &netErr) && netErr.Timeout()) || errors.Is(err, syscall.ECONNREFUSED) {
+		return false
+	}
+	errorMessage := err.Error()
+	switch scheme {
+	case HTTPS:
+		return strings.Contains(errorMessage, "server gave HTTP response to HTTPS client") ||
+			strings.Contains(errorMessage, "first record does not look like a TLS handshake")
+	default:
+		// TLS servers either answer with a TLS alert or just hang up on plaintext
+		return strings.Contains(errorMessage, "malformed HTTP response") ||
+			errors.Is(err, io.EOF) ||
+			errors.Is(err, syscall.ECONNRESET)
+	}
+}
+
+func isTransientFailure(response *httpResponse, err error) bool {
+	if err == nil {
+		return response.statusCode == http.StatusTooManyRequests || response.statusCode == http.StatusServiceUnavailable
+	}
+	var netErr net.Error
+
+	return (errors.As(err, &netErr) && netErr.Timeout()) || errors.Is(err, syscall.ECONNRESET)
+}
+
+// intermediate responses are closed. the last one is returned open
+func (httpClient *HTTPClient) sendWithRetries(parentCtx context.Context, url string, disableRetries bool, headers map[string]string, method string) (*httpResponse, error) {
+	for attempt := 0; ; attempt++ {
+		response, err := httpClient.send(parentCtx, url, headers, method)
 		if err != nil {
-			return "", response.StatusCode, err
+			EPLogger(fmt.Sprintf("Failed to fetch from %s\n", url))
+		}
+		if disableRetries || attempt >= httpClient.options.Retries || parentCtx.Err() != nil || !isTransientFailure(response, err) {
+			return response, err
+		}
+		if response != nil {
+			response.Close()
 		}
 
-		return string(data), response.StatusCode, nil
+		backoff := httpClient.options.RetryBackoff << attempt
+		EPLogger(fmt.Sprintf("Retrying %s in %v. Remaining retries: %d\n", url, backoff, httpClient.options.Retries-attempt))
+		select {
+		case <-time.After(backoff):
+		case <-parentCtx.Done():
+			return nil, parentCtx.Err()
+		}
 	}
-	for _, c := range cancelFuncs {
-		c()
+}
+
+// a response whose body is still open. Close must be called once done with it
+type httpResponse struct {
+	statusCode int
+	body       io.Reader
+	closeBody  func() error
+	cancel     context.CancelFunc
+}
+
+func (response *httpResponse) Close() {
+	response.closeBody()
+	response.cancel()
+}
+
+// reads up to n bytes from the beginning of the body without consuming them
+func (response *httpResponse) peekBody(n int64) []byte {
+	peeked, _ := ioutil.ReadAll(io.LimitReader(response.body, n))
+	response.body = io.MultiReader(bytes.NewReader(peeked), response.body)
+
+	return peeked
+}
+
+// a single request without any retries. waits for its turn if requests are rate limited
+func (httpClient *HTTPClient) send(parentCtx context.Context, url string, headers map[string]string, method string) (*httpResponse, error) {
+	host, _, _ := splitEndpoint(url)
+	if err := httpClient.rateLimiter.Wait(parentCtx); err != nil {
+		return nil, err
+	}
+	if err := httpClient.hostRateLimiters.Wait(parentCtx, host); err != nil {
+		return nil, err
+	}
+	// every URL built from a target is checked, not only the target.
+	// its lookup is part of the request, which already waited for its turn
+	if err := httpClient.checkScopeResolvedWith(parentCtx, url, httpClient.resolver.lookupIPInTurn); err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(parentCtx, httpClient.options.ConnectTimeout+httpClient.options.ReadTimeout)
+	req, err := http.NewRequestWithContext(ctx, method, url, nil)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	for key, header := range headers {
+		req.Header.Set(key, header)
+	}
+	for key, header := range httpClient.options.Headers {
+		req.Header.Set(key, header)
+	}
+	response, err := httpClient.client.Do(req)
+	if err != nil {
+		cancel()
+		if parentCtx.Err() != nil {
+			return nil, parentCtx.Err()
+		}
+		return nil, err
 	}
 
-	return "", -1, err
+	return &httpResponse{
+		statusCode: response.StatusCode,
+		body:       response.Body,
+		closeBody:  response.Body.Close,
+		cancel:     cancel,
+	}, nil
 }
@@ -0,0 +1,220 @@
+package EPUtils
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestHTTPClient(t *testing.T, retries int) *HTTPClient {
+	httpClient, err := NewHTTPClient(HTTPClientOptions{
+		InsecureSkipVerify: true,
+		ConnectTimeout:     time.Second,
+		ReadTimeout:        time.Second,
+		Retries:            retries,
+		RetryBackoff:       time.Millisecond,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return httpClient
+}
+
+func TestSplitEndpoint(t *testing.T) {
+	cases := []struct {
+		endpoint     string
+		host         string
+		pathAndQuery string
+		scheme       string
+	}{
+		{"123.123.123.123:9200", "123.123.123.123:9200", "", ""},
+		{"123.123.123.123:9200/_cat/indices?format=json", "123.123.123.123:9200", "/_cat/indices?format=json", ""},
+		{"https://123.123.123.123:9200/_search", "123.123.123.123:9200", "/_search", HTTPS},
+		{"http://example.com?a=b", "example.com", "?a=b", HTTP},
+	}
+	for _, c := range cases {
+		host, pathAndQuery, scheme := splitEndpoint(c.endpoint)
+		if host != c.host || pathAndQuery != c.pathAndQuery || scheme != c.scheme {
+			t.Errorf("splitEndpoint(%v) = %v, %v, %v", c.endpoint, host, pathAndQuery, scheme)
+		}
+	}
+}
+
+func TestSendFailSafeHTTPRequestFallsBackToHTTPS(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.URL.Path))
+	}))
+	defer server.Close()
+	host := strings.TrimPrefix(server.URL, "https://")
+	httpClient := newTestHTTPClient(t, 0)
+
+	body, statusCode, err := httpClient.SendFailSafeHTTPRequest(context.Background(), host+"/_cat/indices", true, nil, "GET")
+	if err != nil || statusCode != 200 || body != "/_cat/indices" {
+		t.Fatalf("expected a response over https, got %v %v %v", body, statusCode, err)
+	}
+	if scheme, _ := httpClient.schemes.Load(host); scheme != HTTPS {
+		t.Errorf("expected https to be cached for %v, got %v", host, scheme)
+	}
+}
+
+func TestSendFailSafeHTTPRequestFallsBackToHTTP(t *testing.T) {
+	var authorizationOverHTTP Count32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "" {
+			authorizationOverHTTP.Inc()
+		}
+	}))
+	defer server.Close()
+	host := strings.TrimPrefix(server.URL, "http://")
+	httpClient := newTestHTTPClient(t, 0)
+
+	_, statusCode, err := httpClient.SendFailSafeHTTPRequest(context.Background(), host, true, map[string]string{"Authorization": "Basic dTpw"}, "GET")
+	if err != nil || statusCode != 200 {
+		t.Fatalf("expected a response over http, got %v %v", statusCode, err)
+	}
+	if scheme, _ := httpClient.schemes.Load(host); scheme != HTTP {
+		t.Errorf("expected http to be cached for %v, got %v", host, scheme)
+	}
+	// https was tried first, so credentials were only sent once the host turned out to speak http
+	if authorizationOverHTTP.Get() != 1 {
+		t.Errorf("expected credentials to be sent over http once, got %v", authorizationOverHTTP.Get())
+	}
+
+	// an explicit https target is never downgraded
+	_, _, err = newTestHTTPClient(t, 0).SendFailSafeHTTPRequest(context.Background(), "https://"+host, true, nil, "GET")
+	if err == nil {
+		t.Errorf("expected https://%v to fail without falling back to http", host)
+	}
+}
+
+func TestSchemesToTry(t *testing.T) {
+	httpClient := newTestHTTPClient(t, 0)
+	for _, c := range []struct {
+		explicitScheme string
+		hasCredentials bool
+		expected       string
+	}{
+		{"", false, "http,https"},
+		{"", true, "https,http"},
+		{HTTPS, false, "https"},
+		{HTTPS, true, "https"},
+		{HTTP, true, "http,https"},
+	} {
+		if schemes := strings.Join(httpClient.schemesToTry("1.1.1.1:9200", c.explicitScheme, c.hasCredentials), ","); schemes != c.expected {
+			t.Errorf("schemesToTry(%q, %v) = %v, expected %v", c.explicitScheme, c.hasCredentials, schemes, c.expected)
+		}
+	}
+}
+
+func TestSchemesToTryWithKnownHTTP(t *testing.T) {
+	httpClient := newTestHTTPClient(t, 0)
+	httpClient.schemes.Store("1.1.1.1:9200", HTTP)
+	for _, c := range []struct {
+		explicitScheme string
+		hasCredentials bool
+		expected       string
+	}{
+		{"", false, "http"},
+		{HTTPS, false, "https"},
+		{HTTPS, true, "https"},
+		{"", true, "https,http"},
+	} {
+		if schemes := strings.Join(httpClient.schemesToTry("1.1.1.1:9200", c.explicitScheme, c.hasCredentials), ","); schemes != c.expected {
+			t.Errorf("schemesToTry(%q, %v) after http = %v, expected %v", c.explicitScheme, c.hasCredentials, schemes, c.expected)
+		}
+	}
+}
+
+func TestSendFailSafeHTTPRequestDoesNotReuseHTTPForHTTPS(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+	host := strings.TrimPrefix(server.URL, "http://")
+
+	httpClient := newTestHTTPClient(t, 0)
+	if _, statusCode, err := httpClient.SendFailSafeHTTPRequest(context.Background(), host, false, nil, "GET"); err != nil || statusCode != http.StatusOK {
+		t.Fatalf("expected %s to be found over http, got %v (%v)", host, statusCode, err)
+	}
+	if _, _, err := httpClient.SendFailSafeHTTPRequest(context.Background(), "https://"+host, false, nil, "GET"); err == nil {
+		t.Errorf("expected https://%s to fail rather than be sent over http", host)
+	}
+}
+
+func TestSendFailSafeHTTPRequestRetries(t *testing.T) {
+	var requestCount Count32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if requestCount.Inc() <= 2 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer server.Close()
+
+	_, statusCode, _ := newTestHTTPClient(t, 1).SendFailSafeHTTPRequest(context.Background(), server.URL, false, nil, "GET")
+	if statusCode != http.StatusServiceUnavailable || requestCount.Get() != 2 {
+		t.Errorf("expected 503 after 2 requests, got %v after %v requests", statusCode, requestCount.Get())
+	}
+
+	requestCount = 0
+	_, statusCode, _ = newTestHTTPClient(t, 2).SendFailSafeHTTPRequest(context.Background(), server.URL, false, nil, "GET")
+	if statusCode != http.StatusOK || requestCount.Get() != 3 {
+		t.Errorf("expected 200 after 3 requests, got %v after %v requests", statusCode, requestCount.Get())
+	}
+
+	requestCount = 0
+	_, statusCode, _ = newTestHTTPClient(t, 2).SendFailSafeHTTPRequest(context.Background(), server.URL, true, nil, "GET")
+	if statusCode != http.StatusServiceUnavailable || requestCount.Get() != 1 {
+		t.Errorf("expected no retries when disabled, got %v after %v requests", statusCode, requestCount.Get())
+	}
+}
+
+func TestSendFailSafeHTTPRequestTruncates(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(strings.Repeat("a", 100)))
+	}))
+	defer server.Close()
+	httpClient := newTestHTTPClient(t, 0)
+
+	for _, c := range []struct {
+		maxResponseSize   int64
+		expectedLength    int
+		expectedTruncated bool
+	}{
+		{10, 10, true},
+		{100, 100, false},
+		{0, 100, false},
+	} {
+		httpClient.options.MaxResponseSize = c.maxResponseSize
+		var length int
+		_, truncated, err := httpClient.SendFailSafeHTTPRequestStreaming(context.Background(), server.URL, true, nil, "GET", func(statusCode int, body io.Reader) error {
+			data, err := ioutil.ReadAll(body)
+			length = len(data)
+			return err
+		})
+		if err != nil || length != c.expectedLength || truncated != c.expectedTruncated {
+			t.Errorf("max %d: expected %d bytes (truncated: %v), got %d bytes (truncated: %v, error: %v)", c.maxResponseSize, c.expectedLength, c.expectedTruncated, length, truncated, err)
+		}
+	}
+}
+
+func TestGetPeerCertificates(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	// the test certificate is self-signed, and is read even without -insecure
+	httpClient, err := NewHTTPClient(HTTPClientOptions{ConnectTimeout: time.Second, ReadTimeout: time.Second})
+	if err != nil {
+		t.Fatal(err)
+	}
+	certificates, err := httpClient.GetPeerCertificates(context.Background(), strings.TrimPrefix(server.URL, "https://"))
+	if err != nil || len(certificates) == 0 {
+		t.Fatalf("expected certificates, got %v %v", certificates, err)
+	}
+	if certificates[0].Subject.Organization[0] != "Acme Co" {
+		t.Errorf("unexpected certificate of %v", certificates[0].Subject)
+	}
+}
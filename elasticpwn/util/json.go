@@ -0,0 +1,90 @@
+package EPUtils
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// decodes a JSON object from r, handing each element of the array at arrayPath
+// (like ["hits", "hits"] for {"hits": {"hits": [...]}}) to onArrayElement as soon as it is decoded.
+// the decoder holds only one element of the array at a time on top of what was decoded so far,
+// unlike json.Unmarshal or json.Decoder.Decode which need the whole input in memory first.
+// only the first maxRetainedElements elements of the array are kept in the returned object. the rest are dropped
+// after onArrayElement, so that a response with a lot of elements is not held in memory as a whole.
+// if r ends in the middle (e.g. it was truncated), the part decoded so far is returned along with the error.
+func DecodeJSONObjectStreaming(r io.Reader, arrayPath []string, maxRetainedElements int, onArrayElement func(element interface{})) (map[string]interface{}, error) {
+	decoder := json.NewDecoder(r)
+	token, err := decoder.Token()
+	if err != nil {
+		return nil, err
+	}
+	if delim, ok := token.(json.Delim); !ok || delim != '{' {
+		return nil, fmt.Errorf("expected a JSON object but got %v", token)
+	}
+	value, err := decodeJSONValueStreaming(decoder, token, arrayPath, maxRetainedElements, onArrayElement)
+	object, _ := value.(map[string]interface{})
+
+	return object, err
+}
+
+// decodes the rest of a value whose first token was already read
+func decodeJSONValueStreaming(decoder *json.Decoder, token json.Token, arrayPath []string, maxRetainedElements int, onArrayElement func(element interface{})) (interface{}, error) {
+	delim, ok := token.(json.Delim)
+	if !ok {
+		// string, float64, bool or nil, just like json.Unmarshal into interface{}
+		return token, nil
+	}
+
+	switch delim {
+	case '{':
+		object := map[string]interface{}{}
+		for decoder.More() {
+			keyToken, err := decoder.Token()
+			if err != nil {
+				return object, err
+			}
+			key, _ := keyToken.(string)
+			if len(arrayPath) > 0 && key == arrayPath[0] {
+				valueToken, err := decoder.Token()
+				if err != nil {
+					return object, err
+				}
+				value, err := decodeJSONValueStreaming(decoder, valueToken, arrayPath[1:], maxRetainedElements, onArrayElement)
+				object[key] = value
+				if err != nil {
+					return object, err
+				}
+				continue
+			}
+			var value interface{}
+			if err := decoder.Decode(&value); err != nil {
+				return object, err
+			}
+			object[key] = value
+		}
+		_, err := decoder.Token()
+
+		return object, err
+	case '[':
+		array := []interface{}{}
+		for decoder.More() {
+			var element interface{}
+			if err := decoder.Decode(&element); err != nil {
+				return array, err
+			}
+			if len(arrayPath) == 0 {
+				onArrayElement(element)
+				if len(array) >= maxRetainedElements {
+					continue
+				}
+			}
+			array = append(array, element)
+		}
+		_, err := decoder.Token()
+
+		return array, err
+	default:
+		return nil, fmt.Errorf("unexpected %v in JSON", delim)
+	}
+}
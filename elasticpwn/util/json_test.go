@@ -0,0 +1,67 @@
+package EPUtils
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const testSearchResponse = `{"took":3,"hits":{"total":{"value":2},"hits":[{"_id":"1","_source":{"email":"a@b.com"}},{"_id":"2","_source":{"email":"c@d.com"}}]},"_shards":{"total":1}}`
+
+func TestDecodeJSONObjectStreaming(t *testing.T) {
+	var hitIds []interface{}
+	object, err := DecodeJSONObjectStreaming(strings.NewReader(testSearchResponse), []string{"hits", "hits"}, 10, func(hit interface{}) {
+		hitIds = append(hitIds, hit.(map[string]interface{})["_id"])
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(hitIds, []interface{}{"1", "2"}) {
+		t.Errorf("unexpected hits: %v", hitIds)
+	}
+	if object["took"] != float64(3) || object["_shards"] == nil {
+		t.Errorf("fields other than hits were not decoded: %v", object)
+	}
+	if hits := object["hits"].(map[string]interface{})["hits"].([]interface{}); len(hits) != 2 {
+		t.Errorf("hits were not kept in the decoded object: %v", hits)
+	}
+}
+
+func TestDecodeJSONObjectStreamingTruncated(t *testing.T) {
+	truncated := testSearchResponse[:strings.Index(testSearchResponse, `{"_id":"2"`)+5]
+	var hitCount int
+	object, err := DecodeJSONObjectStreaming(strings.NewReader(truncated), []string{"hits", "hits"}, 10, func(hit interface{}) {
+		hitCount++
+	})
+	if err == nil {
+		t.Errorf("expected an error from truncated input")
+	}
+	if hitCount != 1 {
+		t.Errorf("expected the first hit to be decoded, got %d hits", hitCount)
+	}
+	if hits := object["hits"].(map[string]interface{})["hits"].([]interface{}); len(hits) != 1 {
+		t.Errorf("expected the first hit to be kept, got %v", hits)
+	}
+}
+
+func TestDecodeJSONObjectStreamingNotAnObject(t *testing.T) {
+	if _, err := DecodeJSONObjectStreaming(strings.NewReader(`[1, 2]`), []string{"hits"}, 10, func(interface{}) {}); err == nil {
+		t.Errorf("expected an error for a JSON array")
+	}
+}
+
+func TestDecodeJSONObjectStreamingDropsElementsOverMax(t *testing.T) {
+	var hitCount int
+	object, err := DecodeJSONObjectStreaming(strings.NewReader(testSearchResponse), []string{"hits", "hits"}, 1, func(hit interface{}) {
+		hitCount++
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hitCount != 2 {
+		t.Errorf("expected every hit to be handed over, got %d hits", hitCount)
+	}
+	if hits := object["hits"].(map[string]interface{})["hits"].([]interface{}); len(hits) != 1 {
+		t.Errorf("expected only the first hit to be kept, got %v", hits)
+	}
+}
@@ -1,6 +1,7 @@
 package EPUtils
 
 import (
+	"fmt"
 	"log"
 	"os"
 	"time"
@@ -24,3 +25,13 @@ var L = log.New(os.Stdout, "", 0)
 func EPLogger(message string) {
 	EPLog(L, message)
 }
+
+// for when stdout is taken by the output, like -of -
+func LogToStderr() {
+	L.SetOutput(os.Stderr)
+}
+
+// prints without the prefix of EPLogger, like messages of invalid options, to where EPLogger writes
+func Printf(format string, a ...interface{}) {
+	fmt.Fprintf(L.Writer(), format, a...)
+}
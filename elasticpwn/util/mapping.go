@@ -0,0 +1,262 @@
+package EPUtils
+
+import (
+	"encoding/json"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// categories of SensitiveField
+const (
+	SENSITIVE_FIELD_CREDENTIAL  = "credential"
+	SENSITIVE_FIELD_GOVERNMENT  = "government_id"
+	SENSITIVE_FIELD_FINANCIAL   = "financial"
+	SENSITIVE_FIELD_CONTACT     = "contact"
+	SENSITIVE_FIELD_PERSONAL    = "personal"
+	SENSITIVE_FIELD_HEALTH      = "health"
+	SENSITIVE_FIELD_GEOLOCATION = "geolocation"
+)
+
+// field names of each category, written in snake case.
+// a field matches a name if its words contain the words of the name in a row,
+// so card_number matches cardNumber, credit-card-number and billing.card_number.
+// names of 6 letters or more also match when glued to other words, like userpassword.
+var SENSITIVE_FIELD_TAXONOMY = map[string][]string{
+	SENSITIVE_FIELD_CREDENTIAL: {
+		"password", "passwd", "pwd", "passphrase", "secret", "token", "api_key", "apikey", "access_key",
+		"private_key", "pin", "otp", "totp", "salt", "credential",
+	},
+	SENSITIVE_FIELD_GOVERNMENT: {
+		"ssn", "social_security", "national_id", "passport", "tax_id", "tin", "nin", "driver_license",
+		"drivers_license", "licence_number", "aadhaar", "cpf", "nric",
+	},
+	SENSITIVE_FIELD_FINANCIAL: {
+		"card_number", "credit_card", "cc_number", "ccn", "pan", "cvv", "cvc", "card_expiry", "iban", "bic",
+		"swift", "account_number", "routing_number", "sort_code", "bank_account", "salary",
+	},
+	SENSITIVE_FIELD_CONTACT: {
+		"email", "e_mail", "phone", "mobile", "telephone", "msisdn", "address", "street", "zip", "zipcode",
+		"postal_code", "postcode",
+	},
+	SENSITIVE_FIELD_PERSONAL: {
+		"dob", "date_of_birth", "birthdate", "birthday", "birth_date", "first_name", "last_name", "full_name",
+		"surname", "maiden_name", "gender", "nationality", "religion", "ethnicity",
+	},
+	SENSITIVE_FIELD_HEALTH: {
+		"diagnosis", "medical", "medication", "prescription", "blood_type", "allergies", "insurance_number",
+	},
+	SENSITIVE_FIELD_GEOLOCATION: {
+		"latitude", "longitude", "geo_point", "gps",
+	},
+}
+
+// field names that match the taxonomy, but almost always hold data about machines rather than people.
+// matched the same way as the taxonomy
+var NOT_SENSITIVE_FIELD_NAMES = []string{
+	"ip_address", "mac_address", "remote_address", "client_address", "server_address", "source_address",
+	"destination_address", "host_address", "bind_address", "listen_address", "token_count",
+}
+
+// names shorter than this only match whole words, so that dob does not match adobe
+const MIN_SENSITIVE_FIELD_NAME_LEN_TO_MATCH_INSIDE_WORDS = 6
+
+// SensitiveField is a field of an index mapping whose name looks like it holds sensitive data
+type SensitiveField struct {
+	// dotted path from the root of a document, like customer.card.number
+	Path string `bson:"path" json:"path"`
+	// mapping type, like keyword, text or long
+	Type string `bson:"type,omitempty" json:"type"`
+	// one of SENSITIVE_FIELD_*
+	Category string `bson:"category" json:"category"`
+	// name in SENSITIVE_FIELD_TAXONOMY it matched
+	MatchedName string `bson:"matchedName" json:"matchedName"`
+	// true if the field is inside a nested field, which can only be searched with a nested query
+	Nested bool `bson:"nested,omitempty" json:"nested"`
+}
+
+type sensitiveFieldName struct {
+	category string
+	name     string
+	words    []string
+}
+
+func newSensitiveFieldName(category string, name string) *sensitiveFieldName {
+	return &sensitiveFieldName{category: category, name: name, words: strings.Split(name, "_")}
+}
+
+// matches words of a field name, and the words glued together
+func (name *sensitiveFieldName) matches(words []string, glued string) bool {
+	if containsWordsInARow(words, name.words) {
+		return true
+	}
+	gluedName := strings.Join(name.words, "")
+
+	return len(gluedName) >= MIN_SENSITIVE_FIELD_NAME_LEN_TO_MATCH_INSIDE_WORDS && strings.Contains(glued, gluedName)
+}
+
+var notSensitiveFieldNames = func() []*sensitiveFieldName {
+	var names []*sensitiveFieldName
+	for _, name := range NOT_SENSITIVE_FIELD_NAMES {
+		names = append(names, newSensitiveFieldName("", name))
+	}
+
+	return names
+}()
+
+var sensitiveFieldNames = func() []*sensitiveFieldName {
+	var names []*sensitiveFieldName
+	for category, categoryNames := range SENSITIVE_FIELD_TAXONOMY {
+		for _, name := range categoryNames {
+			names = append(names, newSensitiveFieldName(category, name))
+		}
+	}
+	// longest first, so that card_number wins over pan in pan_card_number
+	sort.Slice(names, func(i, j int) bool {
+		if len(names[i].name) != len(names[j].name) {
+			return len(names[i].name) > len(names[j].name)
+		}
+		return names[i].name < names[j].name
+	})
+
+	return names
+}()
+
+// cardNumber, card-number, CARD_NUMBER -> card, number
+func splitFieldNameIntoWords(fieldName string) []string {
+	var words []string
+	var word []rune
+	runes := []rune(fieldName)
+	for i, r := range runes {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			if len(word) > 0 {
+				words = append(words, strings.ToLower(string(word)))
+				word = nil
+			}
+			continue
+		}
+		// a lowercase letter followed by an uppercase one starts a new word
+		if unicode.IsUpper(r) && i > 0 && unicode.IsLower(runes[i-1]) && len(word) > 0 {
+			words = append(words, strings.ToLower(string(word)))
+			word = nil
+		}
+		word = append(word, r)
+	}
+	if len(word) > 0 {
+		words = append(words, strings.ToLower(string(word)))
+	}
+
+	return words
+}
+
+// returns the category and the name in the taxonomy fieldName matches, or empty strings if none
+func MatchSensitiveFieldName(fieldName string) (string, string) {
+	words := splitFieldNameIntoWords(fieldName)
+	glued := strings.Join(words, "")
+	for _, name := range notSensitiveFieldNames {
+		if name.matches(words, glued) {
+			return "", ""
+		}
+	}
+	for _, name := range sensitiveFieldNames {
+		if name.matches(words, glued) {
+			return name.category, name.name
+		}
+	}
+
+	return "", ""
+}
+
+func containsWordsInARow(words []string, wordsInARow []string) bool {
+	for start := 0; start+len(wordsInARow) <= len(words); start++ {
+		matches := true
+		for i, word := range wordsInARow {
+			if words[start+i] != word {
+				matches = false
+				break
+			}
+		}
+		if matches {
+			return true
+		}
+	}
+
+	return false
+}
+
+type mappingProperty struct {
+	Type       string                     `json:"type"`
+	Properties map[string]mappingProperty `json:"properties"`
+}
+
+// finds sensitive fields in the response of /<index>/_mapping, which looks like
+//
+//	{"customers": {"mappings": {"properties": {"card": {"properties": {"number": {"type": "keyword"}}}}}}}
+//
+// elasticsearch before 7.0 has mapping types between mappings and properties, like {"mappings": {"_doc": {"properties": ...}}}.
+// returns index name -> sensitive fields sorted by path.
+// a field is matched by its own name first, then by its own name and its parent's, so that card.number is found.
+func FindSensitiveFields(mappingResponse []byte) (map[string][]SensitiveField, error) {
+	var indices map[string]struct {
+		Mappings json.RawMessage `json:"mappings"`
+	}
+	if err := json.Unmarshal(mappingResponse, &indices); err != nil {
+		return nil, err
+	}
+
+	sensitiveFieldsByIndex := make(map[string][]SensitiveField, len(indices))
+	for indexName, index := range indices {
+		var typeless mappingProperty
+		if err := json.Unmarshal(index.Mappings, &typeless); err != nil {
+			return nil, err
+		}
+		properties := typeless.Properties
+		if properties == nil {
+			// keyed by mapping type. fields of all types are in the same index, so put them together
+			var mappingTypes map[string]mappingProperty
+			if err := json.Unmarshal(index.Mappings, &mappingTypes); err != nil {
+				return nil, err
+			}
+			properties = map[string]mappingProperty{}
+			for _, mappingType := range mappingTypes {
+				for name, property := range mappingType.Properties {
+					properties[name] = property
+				}
+			}
+		}
+
+		var sensitiveFields []SensitiveField
+		findSensitiveFieldsInProperties(properties, nil, false, &sensitiveFields)
+		sort.Slice(sensitiveFields, func(i, j int) bool {
+			return sensitiveFields[i].Path < sensitiveFields[j].Path
+		})
+		sensitiveFieldsByIndex[indexName] = sensitiveFields
+	}
+
+	return sensitiveFieldsByIndex, nil
+}
+
+func findSensitiveFieldsInProperties(properties map[string]mappingProperty, parentPath []string, isNested bool, sensitiveFields *[]SensitiveField) {
+	for name, property := range properties {
+		path := append(append([]string{}, parentPath...), name)
+		// objects have properties, and no type (or object or nested)
+		if property.Properties != nil {
+			findSensitiveFieldsInProperties(property.Properties, path, isNested || property.Type == "nested", sensitiveFields)
+			continue
+		}
+		category, matchedName := MatchSensitiveFieldName(name)
+		if category == "" && len(parentPath) > 0 {
+			category, matchedName = MatchSensitiveFieldName(parentPath[len(parentPath)-1] + "_" + name)
+		}
+		if category == "" {
+			continue
+		}
+		*sensitiveFields = append(*sensitiveFields, SensitiveField{
+			Path:        strings.Join(path, "."),
+			Type:        property.Type,
+			Category:    category,
+			MatchedName: matchedName,
+			Nested:      isNested,
+		})
+	}
+}
@@ -0,0 +1,67 @@
+package EPUtils
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMatchSensitiveFieldName(t *testing.T) {
+	cases := []struct {
+		fieldName string
+		category  string
+	}{
+		{"password", SENSITIVE_FIELD_CREDENTIAL},
+		{"userPassword", SENSITIVE_FIELD_CREDENTIAL},
+		{"USERPASSWORD", SENSITIVE_FIELD_CREDENTIAL},
+		{"ssn", SENSITIVE_FIELD_GOVERNMENT},
+		{"card-number", SENSITIVE_FIELD_FINANCIAL},
+		{"creditcardnumber", SENSITIVE_FIELD_FINANCIAL},
+		{"IBAN", SENSITIVE_FIELD_FINANCIAL},
+		{"dob", SENSITIVE_FIELD_PERSONAL},
+		{"date_of_birth", SENSITIVE_FIELD_PERSONAL},
+		{"adobe_version", ""},
+		{"ip_address", ""},
+		{"timestamp", ""},
+	}
+	for _, c := range cases {
+		if category, _ := MatchSensitiveFieldName(c.fieldName); category != c.category {
+			t.Errorf("%v: expected %q but got %q", c.fieldName, c.category, category)
+		}
+	}
+}
+
+func TestFindSensitiveFields(t *testing.T) {
+	typeless := `{"customers": {"mappings": {"properties": {
+		"name": {"type": "text"},
+		"email": {"type": "keyword"},
+		"card": {"properties": {"number": {"type": "keyword"}, "brand": {"type": "keyword"}}},
+		"orders": {"type": "nested", "properties": {"billing": {"properties": {"iban": {"type": "keyword"}}}}},
+		"created_at": {"type": "date"}
+	}}}}`
+	sensitiveFields, err := FindSensitiveFields([]byte(typeless))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []SensitiveField{
+		{Path: "card.number", Type: "keyword", Category: SENSITIVE_FIELD_FINANCIAL, MatchedName: "card_number"},
+		{Path: "email", Type: "keyword", Category: SENSITIVE_FIELD_CONTACT, MatchedName: "email"},
+		{Path: "orders.billing.iban", Type: "keyword", Category: SENSITIVE_FIELD_FINANCIAL, MatchedName: "iban", Nested: true},
+	}
+	if !reflect.DeepEqual(sensitiveFields["customers"], expected) {
+		t.Errorf("expected %v but got %v", expected, sensitiveFields["customers"])
+	}
+
+	// elasticsearch 6 and before
+	typed := `{"users": {"mappings": {"_doc": {"properties": {"passwd": {"type": "keyword"}, "age": {"type": "long"}}}}}}`
+	sensitiveFields, err = FindSensitiveFields([]byte(typed))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sensitiveFields["users"]) != 1 || sensitiveFields["users"][0].Path != "passwd" {
+		t.Errorf("unexpected sensitive fields from a typed mapping: %v", sensitiveFields["users"])
+	}
+
+	if _, err := FindSensitiveFields([]byte(`{"error": "index_not_found_exception", "status": 404}`)); err == nil {
+		t.Errorf("expected an error response to be rejected")
+	}
+}
@@ -0,0 +1,34 @@
+package EPUtils
+
+import (
+	"regexp"
+	"strings"
+)
+
+// legacy (1...), script (3...) and bech32 (bc1...) addresses
+var BtcAddressRegex = regexp.MustCompile(`\b([13][a-km-zA-HJ-NP-Z1-9]{25,34}|bc1[ac-hj-np-z02-9]{11,71})\b`)
+
+// standard (4...) and sub (8...) addresses of 95 characters, and integrated addresses of 106 characters
+var XmrAddressRegex = regexp.MustCompile(`\b[48][0-9AB][1-9A-HJ-NP-Za-km-z]{93}([1-9A-HJ-NP-Za-km-z]{11})?\b`)
+
+// like 0.015 BTC, 500 USD or $500
+var DemandedAmountRegex = regexp.MustCompile(`(?i)([$€]\s?\d+([.,]\d+)?|\d+([.,]\d+)?\s?(btc|bitcoins?|xmr|monero|usdt?|eur|euros?|dollars?)\b)`)
+
+// RansomNoteDetails is what is worth reporting to the owner of a ransomed instance
+type RansomNoteDetails struct {
+	ContactEmails []string
+	BtcAddresses  []string
+	XmrAddresses  []string
+	// the first amount found in the note as it is written, like 0.015 BTC. empty if none
+	DemandedAmount string
+}
+
+// extracts contact emails, wallet addresses and the demanded amount from the text of a ransom note
+func ParseRansomNote(note string) RansomNoteDetails {
+	return RansomNoteDetails{
+		ContactEmails:  Unique(EmailRegex.FindAllString(note, -1)),
+		BtcAddresses:   Unique(BtcAddressRegex.FindAllString(note, -1)),
+		XmrAddresses:   Unique(XmrAddressRegex.FindAllString(note, -1)),
+		DemandedAmount: strings.TrimSpace(DemandedAmountRegex.FindString(note)),
+	}
+}
@@ -0,0 +1,26 @@
+package EPUtils
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseRansomNote(t *testing.T) {
+	xmrAddress := "44AFFq5kSiGBoZ4NMDwYtN18obc8AemS33DBLWs3H7otXft3XjrpDtQGv7SqSsaBYBb98uNbr2VBBEt7f2wfn3RVGQBEP3A"
+	note := "All your data is backed up. You must pay 0.015 BTC to 1Gk3Qs1pP7GpS3BJzCqVMr3mAmDfkjCdWc or bc1qar0srrr7xfkvy5l643lydnw9re59gtzzwf5mdq " +
+		"or the same in XMR to " + xmrAddress + ". In 48 hours, your data will be lost. " +
+		"Email us at restore@onionmail.org (or restore@onionmail.org) with your server IP."
+	expected := RansomNoteDetails{
+		ContactEmails:  []string{"restore@onionmail.org"},
+		BtcAddresses:   []string{"1Gk3Qs1pP7GpS3BJzCqVMr3mAmDfkjCdWc", "bc1qar0srrr7xfkvy5l643lydnw9re59gtzzwf5mdq"},
+		XmrAddresses:   []string{xmrAddress},
+		DemandedAmount: "0.015 BTC",
+	}
+	if details := ParseRansomNote(note); !reflect.DeepEqual(details, expected) {
+		t.Errorf("expected %+v but got %+v", expected, details)
+	}
+
+	if details := ParseRansomNote("Send $500 to get your database back"); details.DemandedAmount != "$500" || len(details.BtcAddresses) != 0 {
+		t.Errorf("unexpected details %+v", details)
+	}
+}
@@ -0,0 +1,96 @@
+package EPUtils
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+)
+
+// RateLimiter is a token bucket refilled at ratePerSecond, holding up to burst tokens.
+// a nil *RateLimiter does not limit anything.
+type RateLimiter struct {
+	mu            sync.Mutex
+	ratePerSecond float64
+	burst         float64
+	// may go below zero. it is the debt of the callers still waiting for their turn
+	tokens float64
+	last   time.Time
+}
+
+// returns nil (no limit) if ratePerSecond is 0.
+// burst is ratePerSecond rounded up, so that a second's worth of requests can be sent at once.
+func NewRateLimiter(ratePerSecond float64) *RateLimiter {
+	if ratePerSecond <= 0 {
+		return nil
+	}
+	burst := math.Max(1, math.Ceil(ratePerSecond))
+
+	return &RateLimiter{
+		ratePerSecond: ratePerSecond,
+		burst:         burst,
+		tokens:        burst,
+		last:          time.Now(),
+	}
+}
+
+// blocks until a token is available or ctx is done
+func (rateLimiter *RateLimiter) Wait(ctx context.Context) error {
+	if rateLimiter == nil {
+		return ctx.Err()
+	}
+	rateLimiter.mu.Lock()
+	now := time.Now()
+	rateLimiter.tokens = math.Min(rateLimiter.burst, rateLimiter.tokens+now.Sub(rateLimiter.last).Seconds()*rateLimiter.ratePerSecond)
+	rateLimiter.last = now
+	// take the token now and wait for it to be refilled, so callers are served in order
+	rateLimiter.tokens--
+	wait := time.Duration(-rateLimiter.tokens / rateLimiter.ratePerSecond * float64(time.Second))
+	rateLimiter.mu.Unlock()
+
+	if wait <= 0 {
+		return ctx.Err()
+	}
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// a RateLimiter for each host, created on the first request to the host
+type HostRateLimiters struct {
+	mu            sync.Mutex
+	ratePerSecond float64
+	limiters      map[string]*RateLimiter
+}
+
+// returns nil (no limit) if ratePerSecond is 0
+func NewHostRateLimiters(ratePerSecond float64) *HostRateLimiters {
+	if ratePerSecond <= 0 {
+		return nil
+	}
+
+	return &HostRateLimiters{
+		ratePerSecond: ratePerSecond,
+		limiters:      make(map[string]*RateLimiter),
+	}
+}
+
+func (hostRateLimiters *HostRateLimiters) Wait(ctx context.Context, host string) error {
+	if hostRateLimiters == nil {
+		return ctx.Err()
+	}
+	hostRateLimiters.mu.Lock()
+	rateLimiter, ok := hostRateLimiters.limiters[host]
+	if !ok {
+		rateLimiter = NewRateLimiter(hostRateLimiters.ratePerSecond)
+		hostRateLimiters.limiters[host] = rateLimiter
+	}
+	hostRateLimiters.mu.Unlock()
+
+	return rateLimiter.Wait(ctx)
+}
@@ -0,0 +1,57 @@
+package EPUtils
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestRateLimiter(t *testing.T) {
+	rateLimiter := NewRateLimiter(20)
+	start := time.Now()
+	// 20 tokens are available at once, and the other 10 take 0.5s to be refilled
+	for i := 0; i < 30; i++ {
+		if err := rateLimiter.Wait(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed < 400*time.Millisecond || elapsed > 2*time.Second {
+		t.Errorf("expected 30 requests at 20/s with a burst of 20 to take about 0.5s, took %v", elapsed)
+	}
+}
+
+func TestRateLimiterCancelled(t *testing.T) {
+	rateLimiter := NewRateLimiter(1)
+	rateLimiter.Wait(context.Background())
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := rateLimiter.Wait(ctx); err == nil {
+		t.Errorf("expected Wait to return when ctx is done")
+	}
+}
+
+func TestNilRateLimiters(t *testing.T) {
+	if NewRateLimiter(0) != nil || NewHostRateLimiters(0) != nil {
+		t.Fatalf("expected no limiters for 0 requests per second")
+	}
+	var rateLimiter *RateLimiter
+	var hostRateLimiters *HostRateLimiters
+	if rateLimiter.Wait(context.Background()) != nil || hostRateLimiters.Wait(context.Background(), "a") != nil {
+		t.Errorf("expected nil limiters not to limit anything")
+	}
+}
+
+func TestHostRateLimiters(t *testing.T) {
+	hostRateLimiters := NewHostRateLimiters(1)
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	// each host has its own bucket
+	for _, host := range []string{"a:9200", "b:9200", "c:9200"} {
+		if err := hostRateLimiters.Wait(ctx, host); err != nil {
+			t.Errorf("first request to %v was limited: %v", host, err)
+		}
+	}
+	if err := hostRateLimiters.Wait(ctx, "a:9200"); err == nil {
+		t.Errorf("second request to a:9200 within a second was not limited")
+	}
+}
@@ -0,0 +1,76 @@
+package EPUtils
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+)
+
+var ErrResolvingThroughProxy = errors.New("not resolved locally, because -proxy is set")
+
+// Resolver does every DNS lookup of elasticpwn: for -scope, -exclude and -creds, for connections, and for ipInfo.
+// each lookup waits for its turn of -rate and -host-rate like a request does.
+// with -proxy, nothing is looked up, so that targets are only ever seen by the proxy.
+// a nil *Resolver looks up with the resolver of the system without any limit
+type Resolver struct {
+	rateLimiter      *RateLimiter
+	hostRateLimiters *HostRateLimiters
+	isProxied        bool
+}
+
+func (resolver *Resolver) waitForTurn(ctx context.Context, host string) error {
+	if resolver == nil {
+		return nil
+	}
+	if err := resolver.checkLocalLookup(host); err != nil {
+		return err
+	}
+	if err := resolver.rateLimiter.Wait(ctx); err != nil {
+		return err
+	}
+
+	return resolver.hostRateLimiters.Wait(ctx, host)
+}
+
+func (resolver *Resolver) checkLocalLookup(host string) error {
+	if resolver != nil && resolver.isProxied {
+		return fmt.Errorf("%w: %v", ErrResolvingThroughProxy, host)
+	}
+
+	return nil
+}
+
+func (resolver *Resolver) LookupIP(ctx context.Context, host string) ([]net.IP, error) {
+	if err := resolver.waitForTurn(ctx, host); err != nil {
+		return nil, err
+	}
+
+	return net.DefaultResolver.LookupIP(ctx, "ip", host)
+}
+
+// same as LookupIP, for a request that already waited for its turn
+func (resolver *Resolver) lookupIPInTurn(ctx context.Context, host string) ([]net.IP, error) {
+	if err := resolver.checkLocalLookup(host); err != nil {
+		return nil, err
+	}
+
+	return net.DefaultResolver.LookupIP(ctx, "ip", host)
+}
+
+// reverse lookup of ip
+func (resolver *Resolver) LookupAddr(ctx context.Context, ip string) ([]string, error) {
+	if err := resolver.waitForTurn(ctx, ip); err != nil {
+		return nil, err
+	}
+
+	return net.DefaultResolver.LookupAddr(ctx, ip)
+}
+
+func (resolver *Resolver) LookupCNAME(ctx context.Context, host string) (string, error) {
+	if err := resolver.waitForTurn(ctx, host); err != nil {
+		return "", err
+	}
+
+	return net.DefaultResolver.LookupCNAME(ctx, host)
+}
@@ -0,0 +1,31 @@
+package EPUtils
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestResolverWaitsForItsTurn(t *testing.T) {
+	resolver := &Resolver{rateLimiter: NewRateLimiter(2)}
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		if _, err := resolver.LookupIP(context.Background(), "127.0.0.1"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed < 400*time.Millisecond {
+		t.Errorf("expected the third lookup to wait for its turn of 2 per second, but all took %v", elapsed)
+	}
+}
+
+func TestResolverDoesNotLookUpThroughProxy(t *testing.T) {
+	resolver := &Resolver{isProxied: true}
+	if _, err := resolver.LookupIP(context.Background(), "localhost"); !errors.Is(err, ErrResolvingThroughProxy) {
+		t.Errorf("expected ErrResolvingThroughProxy, got %v", err)
+	}
+	if _, err := resolver.LookupAddr(context.Background(), "127.0.0.1"); !errors.Is(err, ErrResolvingThroughProxy) {
+		t.Errorf("expected ErrResolvingThroughProxy, got %v", err)
+	}
+}
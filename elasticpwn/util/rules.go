@@ -0,0 +1,243 @@
+package EPUtils
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Source of rules that come with elasticpwn
+const RULE_SOURCE_BUILT_IN = "built-in"
+
+// NameRule matches an index name with exactly one of its matchers
+type NameRule struct {
+	Exact  string `yaml:"exact,omitempty" json:"exact,omitempty"`
+	Prefix string `yaml:"prefix,omitempty" json:"prefix,omitempty"`
+	Suffix string `yaml:"suffix,omitempty" json:"suffix,omitempty"`
+	// matches if the name contains it anywhere
+	Contains string `yaml:"contains,omitempty" json:"contains,omitempty"`
+	// RE2 syntax. not anchored unless written with ^ and $
+	Regex string `yaml:"regex,omitempty" json:"regex,omitempty"`
+	// * matches any characters and ? matches a single one, like logs-*-2021.*
+	Glob string `yaml:"glob,omitempty" json:"glob,omitempty"`
+	// why the rule is there. shown by elasticpwn rules test
+	Comment string `yaml:"comment,omitempty" json:"comment,omitempty"`
+
+	// RULE_SOURCE_BUILT_IN, or the path of the rules file the rule came from
+	Source string `yaml:"-" json:"-"`
+	// compiled from Regex
+	regex *regexp.Regexp
+}
+
+// returns the kind of the matcher and its pattern, like prefix and .kibana
+func (rule *NameRule) matcher() (string, string) {
+	for _, matcher := range []struct {
+		kind    string
+		pattern string
+	}{
+		{"exact", rule.Exact},
+		{"prefix", rule.Prefix},
+		{"suffix", rule.Suffix},
+		{"contains", rule.Contains},
+		{"regex", rule.Regex},
+		{"glob", rule.Glob},
+	} {
+		if matcher.pattern != "" {
+			return matcher.kind, matcher.pattern
+		}
+	}
+
+	return "", ""
+}
+
+// checks that exactly one matcher is set and compiles it
+func (rule *NameRule) compile() error {
+	matchersNum := 0
+	for _, pattern := range []string{rule.Exact, rule.Prefix, rule.Suffix, rule.Contains, rule.Regex, rule.Glob} {
+		if pattern != "" {
+			matchersNum++
+		}
+	}
+	if matchersNum != 1 {
+		return fmt.Errorf("a rule should have exactly one of exact, prefix, suffix, contains, regex and glob, but %+v has %d", *rule, matchersNum)
+	}
+	if rule.Regex != "" {
+		regex, err := regexp.Compile(rule.Regex)
+		if err != nil {
+			return fmt.Errorf("regex %q is invalid: %v", rule.Regex, err)
+		}
+		rule.regex = regex
+	}
+	if rule.Glob != "" {
+		if _, err := path.Match(rule.Glob, ""); err != nil {
+			return fmt.Errorf("glob %q is invalid: %v", rule.Glob, err)
+		}
+	}
+
+	return nil
+}
+
+func (rule *NameRule) Matches(name string) bool {
+	switch {
+	case rule.Exact != "":
+		return name == rule.Exact
+	case rule.Prefix != "":
+		return strings.HasPrefix(name, rule.Prefix)
+	case rule.Suffix != "":
+		return strings.HasSuffix(name, rule.Suffix)
+	case rule.Contains != "":
+		return strings.Contains(name, rule.Contains)
+	case rule.regex != nil:
+		return rule.regex.MatchString(name)
+	case rule.Glob != "":
+		matches, _ := path.Match(rule.Glob, name)
+		return matches
+	}
+
+	return false
+}
+
+// like prefix ".kibana" (built-in)
+func (rule *NameRule) String() string {
+	kind, pattern := rule.matcher()
+	description := fmt.Sprintf("%s %q (%s)", kind, pattern, rule.Source)
+	if rule.Comment != "" {
+		description = fmt.Sprintf("%s: %s", description, rule.Comment)
+	}
+
+	return description
+}
+
+// Rules decide which indices are worth storing and requesting, and which words are extracted from documents.
+// see -rules
+type Rules struct {
+	// if true, the built-in rules are not used at all. otherwise the rules of a file are added to them
+	ReplaceDefaults bool `yaml:"replaceDefaults,omitempty" json:"replaceDefaults,omitempty"`
+	// words extracted from documents along with up to 30 characters following them, like "password: 1234".
+	// case insensitive
+	InterestingWords []string `yaml:"interestingWords,omitempty" json:"interestingWords,omitempty"`
+	// indices matching any of these are neither stored nor requested
+	UninterestingIndices []*NameRule `yaml:"uninterestingIndices,omitempty" json:"uninterestingIndices,omitempty"`
+	// indices matching any of these are stored and requested even if they match UninterestingIndices
+	InterestingIndices []*NameRule `yaml:"interestingIndices,omitempty" json:"interestingIndices,omitempty"`
+	// an instance having all of these indices comes from a framework, and its data is useless
+	UninterestingIfAllOfTheseInIndices []string `yaml:"uninterestingIfAllOfTheseInIndices,omitempty" json:"uninterestingIfAllOfTheseInIndices,omitempty"`
+}
+
+// reads a rules file written in YAML, or in JSON if its name ends with .json.
+// unknown keys are rejected, so that a typo does not silently disable a rule.
+// returns nil if rulesFilePath is empty
+func LoadRulesFile(rulesFilePath string) (*Rules, error) {
+	if rulesFilePath == "" {
+		return nil, nil
+	}
+	content, err := os.ReadFile(rulesFilePath)
+	if err != nil {
+		return nil, err
+	}
+
+	rules := &Rules{}
+	if strings.EqualFold(filepath.Ext(rulesFilePath), ".json") {
+		decoder := json.NewDecoder(bytes.NewReader(content))
+		decoder.DisallowUnknownFields()
+		err = decoder.Decode(rules)
+	} else {
+		decoder := yaml.NewDecoder(bytes.NewReader(content))
+		decoder.KnownFields(true)
+		err = decoder.Decode(rules)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read rules file %s: %v", rulesFilePath, err)
+	}
+	if err := rules.compile(rulesFilePath); err != nil {
+		return nil, fmt.Errorf("rules file %s is invalid: %v", rulesFilePath, err)
+	}
+
+	return rules, nil
+}
+
+// validates and compiles all rules, marking them as coming from source
+func (rules *Rules) compile(source string) error {
+	for _, nameRules := range [][]*NameRule{rules.UninterestingIndices, rules.InterestingIndices} {
+		for _, rule := range nameRules {
+			if rule == nil {
+				return fmt.Errorf("a rule is empty")
+			}
+			rule.Source = source
+			if err := rule.compile(); err != nil {
+				return err
+			}
+		}
+	}
+	for _, words := range [][]string{rules.InterestingWords, rules.UninterestingIfAllOfTheseInIndices} {
+		for _, word := range words {
+			if strings.TrimSpace(word) == "" {
+				return fmt.Errorf("words and index names can't be empty")
+			}
+		}
+	}
+
+	return nil
+}
+
+// builds rules from hard-coded lists. panics if any of them is invalid, because it's a bug
+func NewBuiltInRules(rules Rules) *Rules {
+	if err := rules.compile(RULE_SOURCE_BUILT_IN); err != nil {
+		panic(err)
+	}
+
+	return &rules
+}
+
+// returns rules with the rules of other added, or other itself if it replaces defaults.
+// returns rules as they are if other is nil
+func (rules *Rules) Merge(other *Rules) *Rules {
+	if other == nil {
+		return rules
+	}
+	if other.ReplaceDefaults {
+		return other
+	}
+
+	return &Rules{
+		InterestingWords:                   Unique(append(append([]string{}, rules.InterestingWords...), other.InterestingWords...)),
+		UninterestingIndices:               append(append([]*NameRule{}, rules.UninterestingIndices...), other.UninterestingIndices...),
+		InterestingIndices:                 append(append([]*NameRule{}, rules.InterestingIndices...), other.InterestingIndices...),
+		UninterestingIfAllOfTheseInIndices: Unique(append(append([]string{}, rules.UninterestingIfAllOfTheseInIndices...), other.UninterestingIfAllOfTheseInIndices...)),
+	}
+}
+
+// IndexNameMatch tells why an index name is interesting or not
+type IndexNameMatch struct {
+	IsUninteresting bool
+	// the first uninteresting rule the name matched. nil if none
+	UninterestingRule *NameRule
+	// the first interesting rule the name matched, which wins over UninterestingRule. nil if none
+	InterestingRule *NameRule
+}
+
+func (rules *Rules) MatchIndexName(indexName string) IndexNameMatch {
+	var match IndexNameMatch
+	for _, rule := range rules.InterestingIndices {
+		if rule.Matches(indexName) {
+			match.InterestingRule = rule
+			break
+		}
+	}
+	for _, rule := range rules.UninterestingIndices {
+		if rule.Matches(indexName) {
+			match.UninterestingRule = rule
+			break
+		}
+	}
+	match.IsUninteresting = match.UninterestingRule != nil && match.InterestingRule == nil
+
+	return match
+}
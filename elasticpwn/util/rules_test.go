@@ -0,0 +1,103 @@
+package EPUtils
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writeRulesFile(t *testing.T, name string, content string) string {
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	return path
+}
+
+func TestNameRuleMatches(t *testing.T) {
+	cases := []struct {
+		rule     NameRule
+		name     string
+		expected bool
+	}{
+		{NameRule{Exact: "api"}, "api", true},
+		{NameRule{Exact: "api"}, "apis", false},
+		{NameRule{Prefix: ".kibana"}, ".kibana_1", true},
+		{NameRule{Suffix: "-test"}, "customers-test", true},
+		{NameRule{Contains: "meow"}, "abc-meow", true},
+		{NameRule{Regex: `^logs-\d{4}`}, "logs-2021.01", true},
+		{NameRule{Regex: `^logs-\d{4}`}, "app-logs-2021", false},
+		{NameRule{Glob: "filebeat-*-2021.*"}, "filebeat-7.10.2-2021.01.01", true},
+		{NameRule{Glob: "filebeat-?"}, "filebeat-10", false},
+	}
+	for _, c := range cases {
+		if err := c.rule.compile(); err != nil {
+			t.Fatal(err)
+		}
+		if matches := c.rule.Matches(c.name); matches != c.expected {
+			t.Errorf("%v %v: expected %v but got %v", c.rule.String(), c.name, c.expected, matches)
+		}
+	}
+}
+
+func TestLoadRulesFile(t *testing.T) {
+	yamlPath := writeRulesFile(t, "rules.yml", `
+interestingWords: [iban]
+uninterestingIndices:
+  - glob: "tmp-*"
+    comment: scratch indices of the client
+interestingIndices:
+  - prefix: demo-customers
+`)
+	rules, err := LoadRulesFile(yamlPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	builtIn := NewBuiltInRules(Rules{
+		InterestingWords:     []string{"password"},
+		UninterestingIndices: []*NameRule{{Contains: "demo"}},
+	})
+	merged := builtIn.Merge(rules)
+	if len(merged.InterestingWords) != 2 || len(merged.UninterestingIndices) != 2 {
+		t.Errorf("expected rules to be added to the built-in ones, got %+v", merged)
+	}
+	if match := merged.MatchIndexName("tmp-1"); !match.IsUninteresting || match.UninterestingRule.Source != yamlPath {
+		t.Errorf("expected tmp-1 to be uninteresting by %v, got %+v", yamlPath, match)
+	}
+	if match := merged.MatchIndexName("demo-customers-1"); match.IsUninteresting || match.UninterestingRule.Source != RULE_SOURCE_BUILT_IN {
+		t.Errorf("expected an interesting rule to win over a built-in uninteresting one, got %+v", match)
+	}
+	if match := merged.MatchIndexName("demo"); !match.IsUninteresting {
+		t.Errorf("expected demo to be uninteresting, got %+v", match)
+	}
+
+	jsonPath := writeRulesFile(t, "rules.json", "{\n\t\"replaceDefaults\": true,\n\t\"uninterestingIndices\": [{\"exact\": \"movies\"}]\n}")
+	rules, err = LoadRulesFile(jsonPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if replaced := builtIn.Merge(rules); replaced.MatchIndexName("demo").IsUninteresting || !replaced.MatchIndexName("movies").IsUninteresting {
+		t.Errorf("expected built-in rules to be replaced, got %+v", replaced)
+	}
+}
+
+func TestLoadRulesFileInvalid(t *testing.T) {
+	for _, content := range []string{
+		// two matchers
+		"uninterestingIndices:\n  - prefix: a\n    suffix: b\n",
+		"uninterestingIndices:\n  - comment: no matcher\n",
+		"uninterestingIndices:\n  - regex: \"(\"\n",
+		"uninterestingIndices:\n  - glob: \"[\"\n",
+		// typo
+		"uninterestingIndexes:\n  - exact: a\n",
+		"interestingWords: [\"\"]\n",
+	} {
+		if _, err := LoadRulesFile(writeRulesFile(t, "rules.yaml", content)); err == nil {
+			t.Errorf("expected %q to be rejected", content)
+		}
+	}
+	if rules, err := LoadRulesFile(""); rules != nil || err != nil {
+		t.Errorf("expected no rules without a file, got %v %v", rules, err)
+	}
+}
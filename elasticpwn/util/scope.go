@@ -0,0 +1,341 @@
+package EPUtils
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+var ErrOutOfScope = errors.New("out of scope")
+
+// a single line of a -scope or -exclude file. examples:
+//
+// 10.0.0.0/8            any port of any IP in the range
+// 10.0.0.0/8:9200,9243  only these ports
+// 1.2.3.4               a single IP
+// [2001:db8::/32]:9200  IPv6 with ports needs brackets
+// example.com:9200      a hostname
+// *.example.com         any subdomain of example.com, but not example.com itself
+// :9200                 any host on the port
+type scopeRule struct {
+	raw string
+	// nil unless the rule is an IP or a CIDR
+	network *net.IPNet
+	// lowercased. empty unless the rule is a hostname
+	hostname         string
+	includeSubdomain bool
+	// empty means any port
+	ports []int
+}
+
+// Scope decides which targets may be touched.
+// a target is in scope if it matches at least one -scope rule (or there is no -scope file at all)
+// and does not match any -exclude rule.
+// a nil *Scope allows everything.
+type Scope struct {
+	included []*scopeRule
+	excluded []*scopeRule
+}
+
+// returns nil if both paths are empty
+func LoadScope(scopeFilePath string, excludeFilePath string) (*Scope, error) {
+	if scopeFilePath == "" && excludeFilePath == "" {
+		return nil, nil
+	}
+	scope := &Scope{}
+	var err error
+	if scopeFilePath != "" {
+		if scope.included, err = readScopeRules(scopeFilePath); err != nil {
+			return nil, err
+		}
+		// an empty scope file is more likely a mistake than an intention to scan nothing
+		if len(scope.included) == 0 {
+			return nil, fmt.Errorf("no rules found in %v", scopeFilePath)
+		}
+	}
+	if excludeFilePath != "" {
+		if scope.excluded, err = readScopeRules(excludeFilePath); err != nil {
+			return nil, err
+		}
+	}
+
+	return scope, nil
+}
+
+// blank lines and lines starting with # are ignored
+func readScopeRules(path string) ([]*scopeRule, error) {
+	f, err := os.Open(filepath.FromSlash(path))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var rules []*scopeRule
+	scanner := bufio.NewScanner(f)
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		rule, err := parseScopeRule(line)
+		if err != nil {
+			return nil, fmt.Errorf("%v:%d: %v", path, lineNum, err)
+		}
+		rules = append(rules, rule)
+	}
+
+	return rules, scanner.Err()
+}
+
+func parseScopeRule(line string) (*scopeRule, error) {
+	rule := &scopeRule{raw: line}
+	host, rawPorts := line, ""
+	switch {
+	case strings.HasPrefix(line, "["):
+		closingBracket := strings.Index(line, "]")
+		if closingBracket == -1 {
+			return nil, fmt.Errorf("missing ] in %v", line)
+		}
+		host, rawPorts = line[1:closingBracket], strings.TrimPrefix(line[closingBracket+1:], ":")
+	// more than one colon without brackets can only be an IPv6 address without ports
+	case strings.Count(line, ":") == 1:
+		colon := strings.Index(line, ":")
+		host, rawPorts = line[:colon], line[colon+1:]
+	}
+
+	if rawPorts != "" {
+		for _, rawPort := range strings.Split(rawPorts, ",") {
+			port, err := strconv.Atoi(strings.TrimSpace(rawPort))
+			if err != nil || port < 1 || port > 65535 {
+				return nil, fmt.Errorf("invalid port %v in %v", rawPort, line)
+			}
+			rule.ports = append(rule.ports, port)
+		}
+	}
+
+	switch {
+	case host == "":
+		if len(rule.ports) == 0 {
+			return nil, fmt.Errorf("%v has neither a host nor a port", line)
+		}
+	case strings.Contains(host, "/"):
+		_, network, err := net.ParseCIDR(host)
+		if err != nil {
+			return nil, err
+		}
+		rule.network = network
+	case net.ParseIP(host) != nil:
+		ip := net.ParseIP(host)
+		bits := 8 * net.IPv6len
+		if ip.To4() != nil {
+			ip, bits = ip.To4(), 8*net.IPv4len
+		}
+		rule.network = &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)}
+	default:
+		rule.hostname = strings.ToLower(host)
+		if strings.HasPrefix(rule.hostname, "*.") {
+			rule.hostname = strings.TrimPrefix(rule.hostname, "*")
+			rule.includeSubdomain = true
+		}
+	}
+
+	return rule, nil
+}
+
+func (rule *scopeRule) matchesPort(port int) bool {
+	if len(rule.ports) == 0 {
+		return true
+	}
+	for _, rulePort := range rule.ports {
+		if rulePort == port {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (rule *scopeRule) matchesHostname(hostname string) bool {
+	if rule.includeSubdomain {
+		return strings.HasSuffix(hostname, rule.hostname)
+	}
+
+	return hostname == rule.hostname
+}
+
+// a hostname is included only if all addresses it resolves to are in the network
+func (rule *scopeRule) includes(hostname string, ips []net.IP, port int) bool {
+	if !rule.matchesPort(port) {
+		return false
+	}
+	switch {
+	case rule.network != nil:
+		for _, ip := range ips {
+			if !rule.network.Contains(ip) {
+				return false
+			}
+		}
+		return len(ips) > 0
+	case rule.hostname != "":
+		return rule.matchesHostname(hostname)
+	default:
+		return true
+	}
+}
+
+// a hostname is excluded if any of the addresses it resolves to is in the network
+func (rule *scopeRule) excludes(hostname string, ips []net.IP, port int) bool {
+	if !rule.matchesPort(port) {
+		return false
+	}
+	switch {
+	case rule.network != nil:
+		for _, ip := range ips {
+			if rule.network.Contains(ip) {
+				return true
+			}
+		}
+		return false
+	case rule.hostname != "":
+		return rule.matchesHostname(hostname)
+	default:
+		return true
+	}
+}
+
+func (scope *Scope) hasNetworkRules() bool {
+	return hasNetworkRules(scope.included) || hasNetworkRules(scope.excluded)
+}
+
+func hasNetworkRules(rules []*scopeRule) bool {
+	for _, rule := range rules {
+		if rule.network != nil {
+			return true
+		}
+	}
+
+	return false
+}
+
+// splits target into what rules are matched against.
+// a hostname is resolved with lookupIP only if it is not nil, because there is no point if no rule is a CIDR or an IP.
+func resolveRuleTarget(ctx context.Context, target string, lookupIP func(ctx context.Context, host string) ([]net.IP, error)) (string, []int, []net.IP, error) {
+	hostAndPort, _, _ := splitEndpoint(strings.TrimSpace(target))
+	hostname, ports, err := splitScopeTarget(hostAndPort)
+	if err != nil {
+		return "", nil, nil, err
+	}
+
+	var ips []net.IP
+	if ip := net.ParseIP(hostname); ip != nil {
+		ips = []net.IP{ip}
+	} else if lookupIP != nil {
+		ips, err = lookupIP(ctx, hostname)
+		// fail closed. an unresolvable host could be anywhere
+		if err != nil {
+			return "", nil, nil, fmt.Errorf("could not resolve %v to check it against CIDRs: %v", hostname, err)
+		}
+	}
+
+	return hostname, ports, ips, nil
+}
+
+// target is anything elasticpwn may request: 1.2.3.4:9200, https://example.com/_cat/indices, ...
+// hostnames are resolved with resolver to be checked against CIDRs.
+// returns an error wrapping ErrOutOfScope if target must not be touched.
+func (scope *Scope) Check(ctx context.Context, resolver *Resolver, target string) error {
+	return scope.checkResolvedWith(ctx, target, resolver.LookupIP)
+}
+
+func (scope *Scope) checkResolvedWith(ctx context.Context, target string, lookupIP func(ctx context.Context, host string) ([]net.IP, error)) error {
+	if scope == nil {
+		return nil
+	}
+	if !scope.hasNetworkRules() {
+		lookupIP = nil
+	}
+	hostname, ports, ips, err := resolveRuleTarget(ctx, target, lookupIP)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrOutOfScope, err)
+	}
+
+	return scope.check(hostname, ports, ips)
+}
+
+// checks ip that hostname resolved to right before connecting to it, since hostname may resolve
+// to another address than it did for Check, like when its DNS record is rebound.
+// returns an error wrapping ErrOutOfScope if ip must not be touched.
+func (scope *Scope) CheckAddress(hostname string, ip net.IP, port int) error {
+	if scope == nil {
+		return nil
+	}
+
+	return scope.check(strings.ToLower(hostname), []int{port}, []net.IP{ip})
+}
+
+// a proxy resolves hostnames on its own, so what they resolve to can't be checked against CIDRs or IPs.
+// returns an error wrapping ErrOutOfScope if target is such a hostname and there are such rules.
+func (scope *Scope) CheckProxiedTarget(target string) error {
+	if scope == nil || !scope.hasNetworkRules() {
+		return nil
+	}
+	hostAndPort, _, _ := splitEndpoint(strings.TrimSpace(target))
+	hostname, _, err := splitScopeTarget(hostAndPort)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrOutOfScope, err)
+	}
+	if net.ParseIP(hostname) == nil {
+		return fmt.Errorf("%w: %v can't be checked against CIDRs and IPs of -scope and -exclude, because -proxy resolves it", ErrOutOfScope, hostname)
+	}
+
+	return nil
+}
+
+func (scope *Scope) check(hostname string, ports []int, ips []net.IP) error {
+	for _, port := range ports {
+		if len(scope.included) > 0 {
+			isIncluded := false
+			for _, rule := range scope.included {
+				if rule.includes(hostname, ips, port) {
+					isIncluded = true
+					break
+				}
+			}
+			if !isIncluded {
+				return fmt.Errorf("%w: %v:%d is not in -scope", ErrOutOfScope, hostname, port)
+			}
+		}
+		for _, rule := range scope.excluded {
+			if rule.excludes(hostname, ips, port) {
+				return fmt.Errorf("%w: %v:%d matches -exclude rule %v", ErrOutOfScope, hostname, port, rule.raw)
+			}
+		}
+	}
+
+	return nil
+}
+
+// a target without a port may end up on either 80 or 443 because elasticpwn falls back to the other scheme,
+// so both ports are checked
+func splitScopeTarget(hostAndPort string) (string, []int, error) {
+	hostname, rawPort, err := net.SplitHostPort(hostAndPort)
+	if err != nil {
+		// no port
+		hostname = strings.TrimSuffix(strings.TrimPrefix(hostAndPort, "["), "]")
+		return strings.ToLower(hostname), []int{80, 443}, nil
+	}
+	port, err := strconv.Atoi(rawPort)
+	if err != nil {
+		return "", nil, fmt.Errorf("invalid port in %v", hostAndPort)
+	}
+
+	return strings.ToLower(hostname), []int{port}, nil
+}
@@ -0,0 +1,196 @@
+package EPUtils
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writeScopeFile(t *testing.T, dir string, name string, content string) string {
+	path := filepath.Join(dir, name)
+	if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	return path
+}
+
+func TestParseScopeRule(t *testing.T) {
+	for _, invalidRule := range []string{"10.0.0.0/33", "1.2.3.4:http", "1.2.3.4:70000", "[::1", ":"} {
+		if _, err := parseScopeRule(invalidRule); err == nil {
+			t.Errorf("expected %v to be invalid", invalidRule)
+		}
+	}
+	rule, err := parseScopeRule("[2001:db8::/32]:9200,9243")
+	if err != nil || rule.network == nil || len(rule.ports) != 2 {
+		t.Errorf("failed to parse IPv6 CIDR with ports: %+v %v", rule, err)
+	}
+}
+
+func TestScopeCheck(t *testing.T) {
+	dir, err := ioutil.TempDir("", "elasticpwn-scope")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	scope, err := LoadScope(
+		writeScopeFile(t, dir, "scope.txt", "# audit 42\n10.0.0.0/8:9200,9243\n\n192.168.1.1\n"),
+		writeScopeFile(t, dir, "exclude.txt", "10.0.0.5\n:9243\n"),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := map[string]bool{
+		"10.1.2.3:9200":                true,
+		"http://10.1.2.3:9200/_search": true,
+		"10.1.2.3:5601":                false,
+		// may end up on 80 or 443, neither of which is in scope
+		"10.1.2.3":          false,
+		"192.168.1.1":       true,
+		"192.168.1.2:9200":  false,
+		"10.0.0.5:9200":     false,
+		"10.1.2.3:9243":     false,
+		"https://[::1]:443": false,
+	}
+	for target, expectedInScope := range cases {
+		err := scope.Check(context.Background(), nil, target)
+		if (err == nil) != expectedInScope {
+			t.Errorf("%v: expected in scope: %v, got error: %v", target, expectedInScope, err)
+		}
+		if err != nil && !errors.Is(err, ErrOutOfScope) {
+			t.Errorf("%v: expected ErrOutOfScope, got %v", target, err)
+		}
+	}
+}
+
+func TestScopeCheckHostnames(t *testing.T) {
+	dir, err := ioutil.TempDir("", "elasticpwn-scope")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	scope, err := LoadScope(writeScopeFile(t, dir, "scope.txt", "*.example.com\nexample.org:9200\n"), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := map[string]bool{
+		"es.example.com:9200":  true,
+		"a.b.EXAMPLE.com":      true,
+		"example.com:9200":     false,
+		"badexample.com:9200":  false,
+		"example.org:9200":     true,
+		"https://example.org/": false,
+		"es.example.net:9200":  false,
+	}
+	for target, expectedInScope := range cases {
+		if err := scope.Check(context.Background(), nil, target); (err == nil) != expectedInScope {
+			t.Errorf("%v: expected in scope: %v, got error: %v", target, expectedInScope, err)
+		}
+	}
+}
+
+func TestEmptyScopeFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "elasticpwn-scope")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if _, err := LoadScope(writeScopeFile(t, dir, "scope.txt", "# nothing yet\n"), ""); err == nil {
+		t.Errorf("expected an error for a scope file without rules")
+	}
+	if scope, err := LoadScope("", ""); scope != nil || err != nil {
+		t.Errorf("expected no scope without files, got %v %v", scope, err)
+	}
+}
+
+func TestRedirectOutOfScopeIsNotFollowed(t *testing.T) {
+	var redirectedRequestCount Count32
+	outOfScopeServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		redirectedRequestCount.Inc()
+	}))
+	defer outOfScopeServer.Close()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, outOfScopeServer.URL, http.StatusFound)
+	}))
+	defer server.Close()
+
+	dir, err := ioutil.TempDir("", "elasticpwn-scope")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	scope, err := LoadScope(writeScopeFile(t, dir, "scope.txt", server.Listener.Addr().String()+"\n"), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	httpClient := newTestHTTPClient(t, 0)
+	httpClient.options.Scope = scope
+
+	_, _, err = httpClient.SendFailSafeHTTPRequest(context.Background(), server.URL, true, nil, "GET")
+	if !errors.Is(err, ErrOutOfScope) {
+		t.Errorf("expected ErrOutOfScope, got %v", err)
+	}
+	if redirectedRequestCount.Get() != 0 {
+		t.Errorf("redirect out of scope was followed")
+	}
+}
+
+func TestScopeCheckAddress(t *testing.T) {
+	dir, err := ioutil.TempDir("", "elasticpwn-scope")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	scope, err := LoadScope(
+		writeScopeFile(t, dir, "scope.txt", "*.example.com\n10.0.0.0/8\n"),
+		writeScopeFile(t, dir, "exclude.txt", "169.254.0.0/16\n"),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// rebound to the metadata service after the name was checked
+	if err := scope.CheckAddress("db.example.com", net.ParseIP("169.254.169.254"), 80); !errors.Is(err, ErrOutOfScope) {
+		t.Errorf("expected an excluded address to be out of scope, got %v", err)
+	}
+	if err := scope.CheckAddress("db.example.com", net.ParseIP("93.184.216.34"), 9200); err != nil {
+		t.Errorf("expected a subdomain of example.com to be in scope, got %v", err)
+	}
+
+	if err := scope.CheckProxiedTarget("https://db.example.com:9200"); !errors.Is(err, ErrOutOfScope) {
+		t.Errorf("expected a hostname to be refused through a proxy with CIDR rules, got %v", err)
+	}
+	if err := scope.CheckProxiedTarget("10.0.0.1:9200"); err != nil {
+		t.Errorf("expected an IP to be checked through a proxy, got %v", err)
+	}
+}
+
+func TestDialInScopeRefusesAddressOutOfScope(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	dir, err := ioutil.TempDir("", "elasticpwn-scope")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	scope, err := LoadScope("", writeScopeFile(t, dir, "exclude.txt", "127.0.0.0/8\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// as if the hostname had resolved to an address in scope when it was checked
+	conn, err := dialInScope(scope, &net.Dialer{}, (*Resolver)(nil).lookupIPInTurn)(context.Background(), "tcp", server.Listener.Addr().String())
+	if conn != nil {
+		conn.Close()
+	}
+	if !errors.Is(err, ErrOutOfScope) {
+		t.Errorf("expected an address out of scope not to be connected to, got %v", err)
+	}
+}
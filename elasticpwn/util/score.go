@@ -0,0 +1,115 @@
+package EPUtils
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// points added to the score of an index. an index with the highest score is requested first
+const (
+	INDEX_SCORE_INTERESTING_NAME = 40
+	INDEX_SCORE_NOISY_NAME       = -30
+	INDEX_SCORE_ROLLOVER_NAME    = -15
+	INDEX_SCORE_EMPTY            = -50
+	// per digit of docs.count, so 5 for 1 doc and 35 for 1 million docs
+	INDEX_SCORE_PER_DOCS_COUNT_DIGIT = 5
+	INDEX_SCORE_MAX_FOR_DOCS_COUNT   = 35
+	INDEX_SCORE_OVER_1MB             = 5
+	INDEX_SCORE_PER_SENSITIVE_FIELD  = 3
+	// per category of SensitiveField, on top of INDEX_SCORE_PER_SENSITIVE_FIELD
+	INDEX_SCORE_PER_SENSITIVE_CATEGORY = 25
+	INDEX_SCORE_MAX_FOR_SENSITIVE      = 100
+)
+
+// words in index names that are likely to hold data about people or money
+var INTERESTING_INDEX_NAME_KEYWORDS = []string{
+	"customer", "user", "account", "member", "client", "patient", "employee", "staff", "person", "people",
+	"student", "citizen", "subscriber", "profile", "contact", "lead", "crm", "kyc", "hr", "payroll", "salary",
+	"payment", "order", "transaction", "invoice", "billing", "wallet", "bank", "card", "loan", "insurance",
+	"credential", "password", "login", "passport", "voter", "medical", "health", "phone", "email", "address",
+}
+
+// words in index names of logs and metrics, which are big and rarely about people
+var NOISY_INDEX_NAME_KEYWORDS = []string{
+	"log", "logs", "logstash", "syslog", "filebeat", "metricbeat", "heartbeat", "packetbeat", "winlogbeat",
+	"auditbeat", "metric", "metrics", "monitoring", "trace", "traces", "apm", "jaeger", "zipkin", "nginx",
+	"kubernetes", "k8s",
+}
+
+// keywords shorter than this only match whole words of an index name, so that hr does not match chrome
+const MIN_INDEX_NAME_KEYWORD_LEN_TO_MATCH_INSIDE_WORDS = 4
+
+// logs-2021.01.01, events-2021-01, metrics_20210101, .ds-logs-000001
+var RolloverIndexNameRegex = regexp.MustCompile(`(\d{4}[.\-_]\d{2}([.\-_]\d{2})?|\d{8}|-\d{6})$`)
+
+// returns the first keyword in keywords that indexName contains, or an empty string if none
+func findIndexNameKeyword(indexName string, keywords []string) string {
+	words := splitFieldNameIntoWords(indexName)
+	glued := strings.Join(words, "")
+	for _, keyword := range keywords {
+		if containsWordsInARow(words, []string{keyword}) ||
+			(len(keyword) >= MIN_INDEX_NAME_KEYWORD_LEN_TO_MATCH_INSIDE_WORDS && strings.Contains(glued, keyword)) {
+			return keyword
+		}
+	}
+
+	return ""
+}
+
+// scores how likely an index holds sensitive data worth requesting, from its name, docs.count and store.size from _cat/indices
+// and the sensitive fields of its mapping.
+// docsCount and storeSizeBytes are left out if nil, like when they could not be parsed.
+// returns the score, and the reason of it like "name has customer +40, 1200 docs +20"
+func ScoreIndex(indexName string, docsCount *int64, storeSizeBytes *int64, sensitiveFields []SensitiveField) (int, string) {
+	score := 0
+	var reasons []string
+	addScore := func(points int, reason string) {
+		score += points
+		reasons = append(reasons, fmt.Sprintf("%s %+d", reason, points))
+	}
+
+	if keyword := findIndexNameKeyword(indexName, INTERESTING_INDEX_NAME_KEYWORDS); keyword != "" {
+		addScore(INDEX_SCORE_INTERESTING_NAME, fmt.Sprintf("name has %s", keyword))
+	}
+	if keyword := findIndexNameKeyword(indexName, NOISY_INDEX_NAME_KEYWORDS); keyword != "" {
+		addScore(INDEX_SCORE_NOISY_NAME, fmt.Sprintf("name has %s", keyword))
+	}
+	if RolloverIndexNameRegex.MatchString(indexName) {
+		addScore(INDEX_SCORE_ROLLOVER_NAME, "rollover index")
+	}
+
+	if docsCount != nil {
+		docs := *docsCount
+		if docs <= 0 {
+			addScore(INDEX_SCORE_EMPTY, "no docs")
+		} else {
+			points := len(strconv.FormatInt(docs, 10)) * INDEX_SCORE_PER_DOCS_COUNT_DIGIT
+			if points > INDEX_SCORE_MAX_FOR_DOCS_COUNT {
+				points = INDEX_SCORE_MAX_FOR_DOCS_COUNT
+			}
+			addScore(points, fmt.Sprintf("%d docs", docs))
+		}
+	}
+	if storeSizeBytes != nil && *storeSizeBytes >= BYTES_1MB {
+		addScore(INDEX_SCORE_OVER_1MB, "over 1mb")
+	}
+
+	if len(sensitiveFields) > 0 {
+		var categories []string
+		for _, sensitiveField := range sensitiveFields {
+			categories = append(categories, sensitiveField.Category)
+		}
+		categories = Unique(categories)
+		sort.Strings(categories)
+		points := len(categories)*INDEX_SCORE_PER_SENSITIVE_CATEGORY + len(sensitiveFields)*INDEX_SCORE_PER_SENSITIVE_FIELD
+		if points > INDEX_SCORE_MAX_FOR_SENSITIVE {
+			points = INDEX_SCORE_MAX_FOR_SENSITIVE
+		}
+		addScore(points, fmt.Sprintf("%d sensitive fields of %s", len(sensitiveFields), strings.Join(categories, " ")))
+	}
+
+	return score, strings.Join(reasons, ", ")
+}
@@ -0,0 +1,30 @@
+package EPUtils
+
+import "testing"
+
+func int64Pointer(number int64) *int64 {
+	return &number
+}
+
+func TestScoreIndex(t *testing.T) {
+	customers, reason := ScoreIndex("customers", int64Pointer(2355), int64Pointer(3984588), []SensitiveField{
+		{Path: "email", Category: SENSITIVE_FIELD_CONTACT},
+		{Path: "card.number", Category: SENSITIVE_FIELD_FINANCIAL},
+	})
+	if expected := "name has customer +40, 2355 docs +20, over 1mb +5, 2 sensitive fields of contact financial +56"; reason != expected {
+		t.Errorf("expected %q but got %q", expected, reason)
+	}
+	rollover, _ := ScoreIndex("filebeat-7.10.2-2021.01.01", int64Pointer(9000000), int64Pointer(4509715660), nil)
+	empty, _ := ScoreIndex("accounts", int64Pointer(0), int64Pointer(208), nil)
+	if !(customers > rollover && rollover > empty) {
+		t.Errorf("unexpected scores: customers %d, rollover %d, empty %d", customers, rollover, empty)
+	}
+
+	// short keywords only match whole words
+	if _, reason := ScoreIndex("chrome-hr", nil, nil, nil); reason != "name has hr +40" {
+		t.Errorf("unexpected reason %q", reason)
+	}
+	if score, reason := ScoreIndex("chrome", nil, nil, nil); score != 0 || reason != "" {
+		t.Errorf("expected no score but got %d (%q)", score, reason)
+	}
+}
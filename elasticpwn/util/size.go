@@ -0,0 +1,52 @@
+package EPUtils
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+const (
+	BYTES_1MB = 1 << 20
+	BYTES_1GB = 1 << 30
+)
+
+// units of byte sizes in _cat APIs, from the largest so that kb is not taken for b
+var byteSizeUnits = []struct {
+	suffix     string
+	multiplier float64
+}{
+	{"pb", 1 << 50},
+	{"tb", 1 << 40},
+	{"gb", 1 << 30},
+	{"mb", 1 << 20},
+	{"kb", 1 << 10},
+	{"b", 1},
+}
+
+// parses a human readable byte size from _cat APIs, like 3.8mb or 54.1kb, into bytes.
+// a plain number is taken as bytes, because that is what _cat APIs answer with ?bytes=b
+func ParseByteSize(size string) (int64, error) {
+	lowercaseSize := strings.ToLower(strings.TrimSpace(size))
+	multiplier := 1.0
+	for _, unit := range byteSizeUnits {
+		if strings.HasSuffix(lowercaseSize, unit.suffix) {
+			lowercaseSize = strings.TrimSuffix(lowercaseSize, unit.suffix)
+			multiplier = unit.multiplier
+			break
+		}
+	}
+	number, err := strconv.ParseFloat(lowercaseSize, 64)
+	if err != nil || number < 0 || math.IsNaN(number) || math.IsInf(number, 0) {
+		return 0, fmt.Errorf("%q is not a byte size", size)
+	}
+
+	// float64(math.MaxInt64) is rounded up to 2^63, which doesn't fit in int64 either
+	bytes := number * multiplier
+	if bytes >= math.MaxInt64 {
+		return 0, fmt.Errorf("%q is too large a byte size", size)
+	}
+
+	return int64(bytes), nil
+}
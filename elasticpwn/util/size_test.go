@@ -0,0 +1,29 @@
+package EPUtils
+
+import "testing"
+
+func TestParseByteSize(t *testing.T) {
+	cases := []struct {
+		size     string
+		expected int64
+	}{
+		{"0b", 0},
+		{"54.1kb", 55398},
+		{"3.8mb", 3984588},
+		{"1024.5mb", 1074266112},
+		{"1.5gb", 1610612736},
+		{"2TB", 2199023255552},
+		{"1234", 1234},
+	}
+	for _, c := range cases {
+		bytes, err := ParseByteSize(c.size)
+		if err != nil || bytes != c.expected {
+			t.Errorf("%v: expected %v but got %v (%v)", c.size, c.expected, bytes, err)
+		}
+	}
+	for _, size := range []string{"", "mb", "-1kb", "nan", "3.8 megabytes", "99999999pb", "8192pb", "1e300"} {
+		if _, err := ParseByteSize(size); err == nil {
+			t.Errorf("expected %q to be rejected", size)
+		}
+	}
+}
@@ -0,0 +1,442 @@
+package EPUtils
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"math/big"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// a CIDR may expand to at most 2^MAX_CIDR_HOST_BITS addresses. a /16 for IPv4
+const MAX_CIDR_HOST_BITS = 16
+
+// Target is a single instance to scan
+type Target struct {
+	// host[:port][/path] without a scheme, like 1.2.3.4:9200, [::1]:9200 or example.com/elasticsearch
+	Address string
+	// HTTP, HTTPS or empty if the input did not say
+	SchemeHint string
+}
+
+// the form that is requested and journaled. the scheme hint goes in front of the address
+// so that the HTTP client tries it first
+func (target Target) String() string {
+	if target.SchemeHint == "" {
+		return target.Address
+	}
+
+	return fmt.Sprintf("%s://%s", target.SchemeHint, target.Address)
+}
+
+// TargetReader turns scanner outputs and plain lists into deduplicated targets.
+// the format is detected per input (nmap XML, optionally gzipped) or per line:
+//
+// 1.2.3.4:9200                        host:port
+// 1.2.3.4:9200,9243                   host with a list of ports
+// https://example.com/elasticsearch/  URL. the path is kept, the query and fragment are dropped
+// 10.0.0.0/24:9200,9243               CIDR with a list of ports
+// {"ip_str": "1.2.3.4", "port": ...}  shodan JSON (shodan download / shodan search --format json)
+// {"ip": "1.2.3.4", "ports": [...]}   masscan -oJ
+// open tcp 9200 1.2.3.4 1640000000    masscan -oL
+//
+// blank lines and lines starting with # are ignored.
+// a TargetReader remembers the targets it has seen across calls to Read.
+type TargetReader struct {
+	seen map[string]bool
+	// number of targets dropped because they were seen before
+	Duplicates int
+	// number of lines that could not be parsed
+	Invalid int
+}
+
+func NewTargetReader() *TargetReader {
+	return &TargetReader{seen: make(map[string]bool)}
+}
+
+// calls onTarget with every target in r that was not seen before, in the order of r,
+// as soon as it is parsed. r can be a stream like stdin.
+// targets are deduplicated by address, so the first scheme hint for an address wins.
+// returns an error if r can't be read or onTarget returns one. unparsable lines are logged and skipped.
+func (targetReader *TargetReader) Read(r io.Reader, onTarget func(Target) error) error {
+	bufferedReader := bufio.NewReader(r)
+	// shodan download gives .json.gz
+	if magic, _ := bufferedReader.Peek(2); len(magic) == 2 && magic[0] == 0x1f && magic[1] == 0x8b {
+		gzipReader, err := gzip.NewReader(bufferedReader)
+		if err != nil {
+			return err
+		}
+		defer gzipReader.Close()
+		bufferedReader = bufio.NewReader(gzipReader)
+	}
+
+	// parsers don't stop in the middle of a line (or an nmap host), so the error is checked between them
+	var onTargetErr error
+	emit := func(target Target) {
+		if onTargetErr != nil {
+			return
+		}
+		if targetReader.seen[target.Address] {
+			targetReader.Duplicates++
+			return
+		}
+		targetReader.seen[target.Address] = true
+		onTargetErr = onTarget(target)
+	}
+
+	if isXML, err := startsWithXML(bufferedReader); err != nil {
+		return err
+	} else if isXML {
+		return readNmapXML(bufferedReader, emit, func() error { return onTargetErr })
+	}
+
+	lineNum := 0
+	for {
+		// not bufio.Scanner, because a single shodan banner can be larger than its buffer
+		line, err := bufferedReader.ReadString('\n')
+		if line != "" {
+			lineNum++
+			if parseErr := parseTargetLine(line, emit); parseErr != nil {
+				targetReader.Invalid++
+				EPLogger(fmt.Sprintf("Skipping line %d of the targets: %v\n", lineNum, parseErr))
+			}
+			if onTargetErr != nil {
+				return onTargetErr
+			}
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func startsWithXML(bufferedReader *bufio.Reader) (bool, error) {
+	for {
+		b, err := bufferedReader.Peek(1)
+		if err == io.EOF {
+			return false, nil
+		}
+		if err != nil {
+			return false, err
+		}
+		switch b[0] {
+		case ' ', '\t', '\r', '\n':
+			bufferedReader.ReadByte()
+		default:
+			return b[0] == '<', nil
+		}
+	}
+}
+
+func parseTargetLine(line string, emit func(Target)) error {
+	line = strings.TrimSpace(line)
+	// masscan -oJ wraps objects in an array, one object per line with trailing commas
+	line = strings.TrimSuffix(line, ",")
+	switch {
+	case line == "" || line == "[" || line == "]" || strings.HasPrefix(line, "#"):
+		return nil
+	case strings.HasPrefix(line, "{"):
+		return parseJSONTarget(line, emit)
+	case strings.HasPrefix(line, "open ") || strings.HasPrefix(line, "closed "):
+		return parseMasscanListLine(line, emit)
+	case strings.Contains(line, "://"):
+		return parseUrlTarget(line, emit)
+	default:
+		return parseHostTarget(line, emit)
+	}
+}
+
+func parseUrlTarget(line string, emit func(Target)) error {
+	parsedUrl, err := url.Parse(line)
+	if err != nil {
+		return err
+	}
+	scheme := strings.ToLower(parsedUrl.Scheme)
+	if scheme != HTTP && scheme != HTTPS {
+		return fmt.Errorf("unsupported scheme in %v", line)
+	}
+	if parsedUrl.Host == "" {
+		return fmt.Errorf("no host in %v", line)
+	}
+	emit(Target{
+		Address:    strings.ToLower(parsedUrl.Host) + strings.TrimSuffix(parsedUrl.EscapedPath(), "/"),
+		SchemeHint: scheme,
+	})
+
+	return nil
+}
+
+// host, host:port, host:port,port,... or a CIDR with optional ports. IPv6 with ports needs brackets
+func parseHostTarget(line string, emit func(Target)) error {
+	// 1.2.3.4:9200/ from older lists
+	line = strings.TrimSuffix(line, "/")
+	host, rawPorts := line, ""
+	switch {
+	case strings.HasPrefix(line, "["):
+		closingBracket := strings.Index(line, "]")
+		if closingBracket == -1 {
+			return fmt.Errorf("missing ] in %v", line)
+		}
+		host, rawPorts = line[1:closingBracket], strings.TrimPrefix(line[closingBracket+1:], ":")
+	// more than one colon without brackets can only be an IPv6 address without ports
+	case strings.Count(line, ":") == 1:
+		colon := strings.Index(line, ":")
+		host, rawPorts = line[:colon], line[colon+1:]
+	}
+	if host == "" {
+		return fmt.Errorf("no host in %v", line)
+	}
+
+	var ports []string
+	if rawPorts != "" {
+		for _, rawPort := range strings.Split(rawPorts, ",") {
+			port, err := parsePort(strings.TrimSpace(rawPort))
+			if err != nil {
+				return fmt.Errorf("%v in %v", err, line)
+			}
+			ports = append(ports, port)
+		}
+	}
+
+	hosts := []string{strings.ToLower(host)}
+	if strings.Contains(host, "/") {
+		ips, err := expandCIDR(host)
+		if err != nil {
+			return err
+		}
+		hosts = ips
+	}
+
+	for _, host := range hosts {
+		if len(ports) == 0 {
+			emit(Target{Address: joinHostPort(host, "")})
+			continue
+		}
+		for _, port := range ports {
+			emit(Target{Address: joinHostPort(host, port)})
+		}
+	}
+
+	return nil
+}
+
+func parsePort(rawPort string) (string, error) {
+	port, err := strconv.Atoi(rawPort)
+	if err != nil || port < 1 || port > 65535 {
+		return "", fmt.Errorf("invalid port %v", rawPort)
+	}
+
+	return strconv.Itoa(port), nil
+}
+
+// host and port of a target or URL, without its scheme, path and IPv6 brackets.
+// https://[2001:db8::1]:5601/app/kibana -> 2001:db8::1, 5601
+// port is empty if there is none
+func SplitTargetHostPort(target string) (host string, port string) {
+	hostAndPort, _, _ := splitEndpoint(target)
+	host, port, err := net.SplitHostPort(hostAndPort)
+	if err != nil {
+		// no port
+		return strings.TrimSuffix(strings.TrimPrefix(hostAndPort, "["), "]"), ""
+	}
+
+	return host, port
+}
+
+// brackets IPv6 addresses. port may be empty
+func joinHostPort(host string, port string) string {
+	if port != "" {
+		return net.JoinHostPort(host, port)
+	}
+	if strings.Contains(host, ":") {
+		return "[" + host + "]"
+	}
+
+	return host
+}
+
+// all addresses of the network including the network and broadcast addresses,
+// since a target list is rarely aligned with real subnets
+func expandCIDR(cidr string) ([]string, error) {
+	_, network, err := net.ParseCIDR(cidr)
+	if err != nil {
+		return nil, err
+	}
+	ones, bits := network.Mask.Size()
+	if bits-ones > MAX_CIDR_HOST_BITS {
+		return nil, fmt.Errorf("%v has more than %d addresses. split it into smaller ranges", cidr, 1<<MAX_CIDR_HOST_BITS)
+	}
+	hostCount := 1 << uint(bits-ones)
+
+	ip := network.IP
+	if ip4 := ip.To4(); ip4 != nil {
+		start := binary.BigEndian.Uint32(ip4)
+		ips := make([]string, 0, hostCount)
+		for i := uint32(0); i < uint32(hostCount); i++ {
+			next := make(net.IP, net.IPv4len)
+			binary.BigEndian.PutUint32(next, start+i)
+			ips = append(ips, next.String())
+		}
+		return ips, nil
+	}
+
+	start := new(big.Int).SetBytes(ip.To16())
+	ips := make([]string, 0, hostCount)
+	for i := int64(0); i < int64(hostCount); i++ {
+		next := new(big.Int).Add(start, big.NewInt(i)).FillBytes(make([]byte, net.IPv6len))
+		ips = append(ips, net.IP(next).String())
+	}
+
+	return ips, nil
+}
+
+// only the fields elasticpwn needs from a shodan banner or a masscan -oJ record
+type scannerJSONRecord struct {
+	// shodan
+	IpStr string          `json:"ip_str"`
+	Port  int             `json:"port"`
+	Ssl   json.RawMessage `json:"ssl"`
+	// masscan
+	Ip    string `json:"ip"`
+	Ports []struct {
+		Port    int    `json:"port"`
+		Status  string `json:"status"`
+		Service struct {
+			Name string `json:"name"`
+		} `json:"service"`
+	} `json:"ports"`
+}
+
+func parseJSONTarget(line string, emit func(Target)) error {
+	var record scannerJSONRecord
+	if err := json.Unmarshal([]byte(line), &record); err != nil {
+		return err
+	}
+
+	switch {
+	case record.IpStr != "" && record.Port != 0:
+		target := Target{Address: joinHostPort(record.IpStr, strconv.Itoa(record.Port))}
+		// banners of TLS services have an ssl object
+		if len(record.Ssl) > 0 && !bytes.Equal(record.Ssl, []byte("null")) {
+			target.SchemeHint = HTTPS
+		}
+		emit(target)
+	case record.Ip != "" && len(record.Ports) > 0:
+		for _, port := range record.Ports {
+			if port.Status != "" && port.Status != "open" {
+				continue
+			}
+			emit(Target{
+				Address:    joinHostPort(record.Ip, strconv.Itoa(port.Port)),
+				SchemeHint: schemeHintFromServiceName(port.Service.Name, ""),
+			})
+		}
+	default:
+		return fmt.Errorf("neither a shodan banner nor a masscan record")
+	}
+
+	return nil
+}
+
+// open tcp 9200 1.2.3.4 1640000000
+func parseMasscanListLine(line string, emit func(Target)) error {
+	fields := strings.Fields(line)
+	if len(fields) < 4 {
+		return fmt.Errorf("expected 'open <proto> <port> <ip>' but got %v", line)
+	}
+	if fields[0] != "open" {
+		return nil
+	}
+	port, err := parsePort(fields[2])
+	if err != nil {
+		return err
+	}
+	emit(Target{Address: joinHostPort(fields[3], port)})
+
+	return nil
+}
+
+func schemeHintFromServiceName(name string, tunnel string) string {
+	switch {
+	case tunnel == "ssl" || name == "https" || name == "ssl" || strings.HasPrefix(name, "https-"):
+		return HTTPS
+	case name == "http" || strings.HasPrefix(name, "http-"):
+		return HTTP
+	default:
+		return ""
+	}
+}
+
+type nmapHost struct {
+	Addresses []struct {
+		Addr     string `xml:"addr,attr"`
+		AddrType string `xml:"addrtype,attr"`
+	} `xml:"address"`
+	Ports []struct {
+		PortId string `xml:"portid,attr"`
+		State  struct {
+			State string `xml:"state,attr"`
+		} `xml:"state"`
+		Service struct {
+			Name   string `xml:"name,attr"`
+			Tunnel string `xml:"tunnel,attr"`
+		} `xml:"service"`
+	} `xml:"ports>port"`
+}
+
+// nmap -oX. hosts are decoded one by one, so the whole file is never in memory.
+// stops as soon as emitErr returns an error
+func readNmapXML(r io.Reader, emit func(Target), emitErr func() error) error {
+	decoder := xml.NewDecoder(r)
+	for {
+		if err := emitErr(); err != nil {
+			return err
+		}
+		token, err := decoder.Token()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		startElement, ok := token.(xml.StartElement)
+		if !ok || startElement.Name.Local != "host" {
+			continue
+		}
+		var host nmapHost
+		if err := decoder.DecodeElement(&host, &startElement); err != nil {
+			return err
+		}
+
+		ip := ""
+		for _, address := range host.Addresses {
+			if address.AddrType == "ipv4" || address.AddrType == "ipv6" {
+				ip = address.Addr
+				break
+			}
+		}
+		if ip == "" {
+			continue
+		}
+		for _, port := range host.Ports {
+			if port.State.State != "open" {
+				continue
+			}
+			emit(Target{
+				Address:    joinHostPort(ip, port.PortId),
+				SchemeHint: schemeHintFromServiceName(port.Service.Name, port.Service.Tunnel),
+			})
+		}
+	}
+}
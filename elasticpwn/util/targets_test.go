@@ -0,0 +1,164 @@
+package EPUtils
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func readTestTargets(t *testing.T, input string) ([]string, *TargetReader) {
+	var targets []string
+	targetReader := NewTargetReader()
+	if err := targetReader.Read(strings.NewReader(input), func(target Target) error {
+		targets = append(targets, target.String())
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	return targets, targetReader
+}
+
+func TestReadTargetsPlain(t *testing.T) {
+	input := `
+# comment
+123.123.123.123:9200/
+
+https://Example.com:9243/elasticsearch/?pretty#x
+http://124.124.124.124
+124.124.124.124
+10.0.0.0/31:9200,9243
+[2001:db8::1]:9200
+2001:db8::2
+not a port:abc
+123.123.123.123:9200
+`
+	targets, targetReader := readTestTargets(t, input)
+	expected := []string{
+		"123.123.123.123:9200",
+		"https://example.com:9243/elasticsearch",
+		"http://124.124.124.124",
+		"10.0.0.0:9200",
+		"10.0.0.0:9243",
+		"10.0.0.1:9200",
+		"10.0.0.1:9243",
+		"[2001:db8::1]:9200",
+		"[2001:db8::2]",
+	}
+	if !reflect.DeepEqual(targets, expected) {
+		t.Errorf("expected %v but got %v", expected, targets)
+	}
+	if targetReader.Duplicates != 2 || targetReader.Invalid != 1 {
+		t.Errorf("expected 2 duplicates and 1 invalid line but got %d and %d", targetReader.Duplicates, targetReader.Invalid)
+	}
+}
+
+func TestReadTargetsTooLargeCIDR(t *testing.T) {
+	targets, targetReader := readTestTargets(t, "10.0.0.0/8:9200\n2001:db8::/64")
+	if len(targets) != 0 || targetReader.Invalid != 2 {
+		t.Errorf("expected CIDRs over the limit to be rejected, got %d targets", len(targets))
+	}
+}
+
+func TestReadTargetsShodan(t *testing.T) {
+	input := `{"ip_str": "1.1.1.1", "port": 9200, "data": "HTTP/1.1 200 OK", "ssl": {"versions": ["TLSv1.2"]}}
+{"ip_str": "2.2.2.2", "port": 5601, "ssl": null, "hostnames": ["kibana.example.com"]}
+`
+	targets, _ := readTestTargets(t, input)
+	expected := []string{"https://1.1.1.1:9200", "2.2.2.2:5601"}
+	if !reflect.DeepEqual(targets, expected) {
+		t.Errorf("expected %v but got %v", expected, targets)
+	}
+
+	// shodan download gives gzipped files
+	gzipped := &bytes.Buffer{}
+	gzipWriter := gzip.NewWriter(gzipped)
+	gzipWriter.Write([]byte(input))
+	gzipWriter.Close()
+	targets, _ = readTestTargets(t, gzipped.String())
+	if !reflect.DeepEqual(targets, expected) {
+		t.Errorf("expected %v from gzipped input but got %v", expected, targets)
+	}
+}
+
+func TestReadTargetsMasscan(t *testing.T) {
+	json := `[
+{   "ip": "3.3.3.3",   "timestamp": "1640000000", "ports": [ {"port": 9200, "proto": "tcp", "status": "open", "reason": "syn-ack", "ttl": 52} ] },
+{   "ip": "3.3.3.3",   "timestamp": "1640000000", "ports": [ {"port": 443, "proto": "tcp", "service": {"name": "https", "banner": ""} } ] },
+]
+`
+	targets, _ := readTestTargets(t, json)
+	expected := []string{"3.3.3.3:9200", "https://3.3.3.3:443"}
+	if !reflect.DeepEqual(targets, expected) {
+		t.Errorf("expected %v from -oJ but got %v", expected, targets)
+	}
+
+	list := `#masscan
+open tcp 9200 4.4.4.4 1640000000
+closed tcp 9201 4.4.4.4 1640000000
+# end
+`
+	targets, _ = readTestTargets(t, list)
+	if !reflect.DeepEqual(targets, []string{"4.4.4.4:9200"}) {
+		t.Errorf("unexpected targets from -oL: %v", targets)
+	}
+}
+
+func TestReadTargetsNmap(t *testing.T) {
+	input := `<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE nmaprun>
+<nmaprun scanner="nmap">
+<host><status state="up"/>
+<address addr="5.5.5.5" addrtype="ipv4"/><address addr="00:11:22:33:44:55" addrtype="mac"/>
+<ports>
+<port protocol="tcp" portid="9200"><state state="open"/><service name="http"/></port>
+<port protocol="tcp" portid="9243"><state state="open"/><service name="http" tunnel="ssl"/></port>
+<port protocol="tcp" portid="5601"><state state="filtered"/></port>
+</ports>
+</host>
+<host><status state="up"/><address addr="2001:db8::5" addrtype="ipv6"/>
+<ports><port protocol="tcp" portid="9200"><state state="open"/></port></ports>
+</host>
+</nmaprun>
+`
+	targets, _ := readTestTargets(t, input)
+	expected := []string{"http://5.5.5.5:9200", "https://5.5.5.5:9243", "[2001:db8::5]:9200"}
+	if !reflect.DeepEqual(targets, expected) {
+		t.Errorf("expected %v but got %v", expected, targets)
+	}
+}
+
+func TestReadTargetsStopsOnError(t *testing.T) {
+	stop := errors.New("stop")
+	count := 0
+	err := NewTargetReader().Read(strings.NewReader("1.1.1.1:9200\n10.0.0.0/24:9200\n2.2.2.2:9200"), func(target Target) error {
+		count++
+		return stop
+	})
+	if err != stop || count != 1 {
+		t.Errorf("expected reading to stop after the first target, got %v after %d targets", err, count)
+	}
+}
+
+func TestSplitTargetHostPort(t *testing.T) {
+	for _, testCase := range []struct {
+		target       string
+		expectedHost string
+		expectedPort string
+	}{
+		{"1.1.1.1:5601", "1.1.1.1", "5601"},
+		{"https://1.1.1.1:5601", "1.1.1.1", "5601"},
+		{"http://kibana.example.com:5601/app/kibana?x=1", "kibana.example.com", "5601"},
+		{"https://kibana.example.com", "kibana.example.com", ""},
+		{"https://[2001:db8::1]:5601/kibana", "2001:db8::1", "5601"},
+		{"[2001:db8::1]", "2001:db8::1", ""},
+	} {
+		host, port := SplitTargetHostPort(testCase.target)
+		if host != testCase.expectedHost || port != testCase.expectedPort {
+			t.Errorf("expected %s and %s from %s but got %s and %s", testCase.expectedHost, testCase.expectedPort, testCase.target, host, port)
+		}
+	}
+}
@@ -5,7 +5,7 @@ import (
 	"sync"
 )
 
-func ConvertSyncMapToMap(sMap sync.Map) map[string]interface{} {
+func ConvertSyncMapToMap(sMap *sync.Map) map[string]interface{} {
 	tmpMap := make(map[string]interface{})
 	sMap.Range(func(k, v interface{}) bool {
 		tmpMap[k.(string)] = v
@@ -53,6 +53,15 @@ var ContainsExactlyMatchesWith = containsXWith(equals)
 // returns -1 if a string does not match any word in wordlist
 var Contains = containsXWith(strings.Contains)
 
+// returns at most the first maxLen bytes of s, followed by "..." if s was longer
+func Truncate(s string, maxLen int) string {
+	if len(s) <= maxLen {
+		return s
+	}
+
+	return strings.ToValidUTF8(s[:maxLen], "") + "..."
+}
+
 func ExitOnError(e error) {
 	if e != nil {
 		panic(e)
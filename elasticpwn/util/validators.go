@@ -1,9 +1,5 @@
 package EPUtils
 
-import (
-	"fmt"
-)
-
 func ValidateStringFlag(flagValue interface{}, defaultFlagValue interface{}, flagName string) bool {
 	hasError := false
 	switch flagValue.(type) {
@@ -11,7 +7,7 @@ func ValidateStringFlag(flagValue interface{}, defaultFlagValue interface{}, fla
 		{
 			defaultFlagValueStr, ok := defaultFlagValue.(string)
 			if flagValue == defaultFlagValueStr && ok {
-				fmt.Printf("%v option is not set. Please try again.\n", flagName)
+				Printf("%v option is not set. Please try again.\n", flagName)
 				hasError = true
 			}
 		}
@@ -23,7 +19,27 @@ func ValidateStringFlag(flagValue interface{}, defaultFlagValue interface{}, fla
 func ValidatePositiveInt(flagValue int, flagName string) bool {
 	hasError := false
 	if flagValue < 1 {
-		fmt.Printf("%v option can't be less than 1. Input a positive number.\n", flagName)
+		Printf("%v option can't be less than 1. Input a positive number.\n", flagName)
+		hasError = true
+	}
+
+	return hasError
+}
+
+func ValidateNonNegativeInt(flagValue int, flagName string) bool {
+	hasError := false
+	if flagValue < 0 {
+		Printf("%v option can't be less than 0.\n", flagName)
+		hasError = true
+	}
+
+	return hasError
+}
+
+func ValidateNonNegativeFloat(flagValue float64, flagName string) bool {
+	hasError := false
+	if flagValue < 0 {
+		Printf("%v option can't be less than 0.\n", flagName)
 		hasError = true
 	}
 
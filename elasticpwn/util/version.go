@@ -0,0 +1,42 @@
+package EPUtils
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Version is a major.minor.patch version number, like the version.number of elasticsearch
+type Version struct {
+	Major int
+	Minor int
+	Patch int
+}
+
+// accepts 7, 7.10, 7.10.2 and pre-releases like 8.0.0-rc1 or 7.10.2-SNAPSHOT, ignoring the suffix
+func ParseVersion(versionNumber string) (Version, error) {
+	var version Version
+	coreVersion := strings.SplitN(strings.TrimSpace(versionNumber), "-", 2)[0]
+	parts := strings.Split(coreVersion, ".")
+	if coreVersion == "" || len(parts) > 3 {
+		return version, fmt.Errorf("%q is not a version number", versionNumber)
+	}
+	numbers := []*int{&version.Major, &version.Minor, &version.Patch}
+	for i, part := range parts {
+		number, err := strconv.Atoi(part)
+		if err != nil || number < 0 {
+			return version, fmt.Errorf("%q is not a version number", versionNumber)
+		}
+		*numbers[i] = number
+	}
+
+	return version, nil
+}
+
+func (version Version) IsAtLeast(major int, minor int) bool {
+	return version.Major > major || (version.Major == major && version.Minor >= minor)
+}
+
+func (version Version) String() string {
+	return fmt.Sprintf("%d.%d.%d", version.Major, version.Minor, version.Patch)
+}
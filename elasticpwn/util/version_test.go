@@ -0,0 +1,50 @@
+package EPUtils
+
+import "testing"
+
+func TestParseVersion(t *testing.T) {
+	cases := []struct {
+		versionNumber string
+		expected      Version
+	}{
+		{"7.10.2", Version{7, 10, 2}},
+		{"8.0.0-rc1", Version{8, 0, 0}},
+		{"2.4", Version{2, 4, 0}},
+		{"1", Version{1, 0, 0}},
+	}
+	for _, c := range cases {
+		version, err := ParseVersion(c.versionNumber)
+		if err != nil || version != c.expected {
+			t.Errorf("%v: expected %v but got %v (%v)", c.versionNumber, c.expected, version, err)
+		}
+	}
+	for _, versionNumber := range []string{"", "a.b", "1.2.3.4", "-1"} {
+		if _, err := ParseVersion(versionNumber); err == nil {
+			t.Errorf("expected %q to be rejected", versionNumber)
+		}
+	}
+}
+
+func TestVersionIsAtLeast(t *testing.T) {
+	version := Version{7, 10, 2}
+	if !version.IsAtLeast(7, 10) || !version.IsAtLeast(5, 0) || version.IsAtLeast(7, 11) || version.IsAtLeast(8, 0) {
+		t.Errorf("unexpected comparison with %v", version)
+	}
+}
+
+func TestParseCatTable(t *testing.T) {
+	text := `health status index   pri rep docs.count docs.deleted store.size pri.store.size
+green  open   .kibana   1   0          3            0     15.2kb         15.2kb
+yellow open   customers 5   1       2355            0      3.8mb          3.8mb
+`
+	rows := ParseCatTable(text)
+	if len(rows) != 2 || rows[1]["index"] != "customers" || rows[1]["docs.count"] != "2355" || rows[0]["pri.store.size"] != "15.2kb" {
+		t.Errorf("unexpected rows: %v", rows)
+	}
+
+	// an unassigned shard has no node
+	rows = ParseCatTable("shards disk.used host ip node\n5 1gb 10.0.0.1 10.0.0.1 node-1\n3 UNASSIGNED\n")
+	if len(rows) != 1 || rows[0]["node"] != "node-1" {
+		t.Errorf("expected rows with empty cells to be skipped, got %v", rows)
+	}
+}
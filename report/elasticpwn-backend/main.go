@@ -73,7 +73,7 @@ func main() {
 	reportBackendFs := flag.NewFlagSet("elasticpwn-bakcend", flag.ContinueOnError)
 	mongodbURI := reportBackendFs.String("mongodbUri", "", "mongodb URI. Example: mongodb+srv://username:pw@somewhere.mongodb.net/default-collection-name?retryWrites=true&w=majority")
 	databaseName := reportBackendFs.String("databaseName", "", "mongodb db name")
-	databasecollectionName := reportBackendFs.String("databaseCollectionName", "", "mongodb collection name. Should be any one of: elasticsearch_reviewed_urls|elasticsearch_reviewed_urls_dev|kibana_reviewed_urls|kibana_reviewed_urls_dev")
+	databasecollectionName := reportBackendFs.String("databaseCollectionName", "", "mongodb collection name. Should be any one of: elasticsearch_reviewed_urls|elasticsearch_reviewed_urls_dev|kibana_reviewed_urls|kibana_reviewed_urls_dev|opensearch_reviewed_urls|opensearch_reviewed_urls_dev")
 	port := reportBackendFs.String("port", "9292", "port at which the server will run.")
 
 	if !isMongoDbURISuppliedFromEnvFile || !isDbNameSuppliedFromEnvFile || !isCollectionNameSuppliedFromEnvFile || !isPortSuppliedFromEnvFile {
@@ -129,9 +129,11 @@ func main() {
 	if finalCollectionName != "elasticsearch_reviewed_urls" &&
 		finalCollectionName != "elasticsearch_reviewed_urls_dev" &&
 		finalCollectionName != "kibana_reviewed_urls" &&
-		finalCollectionName != "kibana_reviewed_urls_dev" {
+		finalCollectionName != "kibana_reviewed_urls_dev" &&
+		finalCollectionName != "opensearch_reviewed_urls" &&
+		finalCollectionName != "opensearch_reviewed_urls_dev" {
 		reportBackendFs.PrintDefaults()
-		log.Fatal("DATABASE_COLLECTION_NAME (-databaseCollectionName) should be any one of: elasticsearch_reviewed_urls|elasticsearch_reviewed_urls_dev|kibana_reviewed_urls|kibana_reviewed_urls_dev")
+		log.Fatal("DATABASE_COLLECTION_NAME (-databaseCollectionName) should be any one of: elasticsearch_reviewed_urls|elasticsearch_reviewed_urls_dev|kibana_reviewed_urls|kibana_reviewed_urls_dev|opensearch_reviewed_urls|opensearch_reviewed_urls_dev")
 	}
 
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
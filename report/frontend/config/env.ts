@@ -1,12 +1,16 @@
 export const Config = {
     DB_NAME: process.env.DB_NAME as string,
     COLLECTION_NAME: process.env.COLLECTION_NAME as string,
-    SERVER_ROOT_URL_WITHOUT_TRAILING_SLASH: process.env.SERVER_ROOT_URL_WITHOUT_TRAILING_SLASH as string | undefined
+    SERVER_ROOT_URL_WITHOUT_TRAILING_SLASH: process.env.SERVER_ROOT_URL_WITHOUT_TRAILING_SLASH as string | undefined,
+    // instances classified with these labels are left out of the report. see -hide-labels
+    HIDDEN_CLASSIFICATION_LABELS: (process.env.HIDDEN_CLASSIFICATION_LABELS ?? ``).split(`,`).filter((label) => label !== ``),
+    // see -group-by-label
+    GROUP_BY_CLASSIFICATION_LABEL: process.env.GROUP_BY_CLASSIFICATION_LABEL === `true`,
 }
 
 Object.keys(Config).forEach((key) => {
     console.log(`Found env key: ${key}`)
-    if (key === `SERVER_ROOT_URL_WITHOUT_TRAILING_SLASH`) return
+    if (key === `SERVER_ROOT_URL_WITHOUT_TRAILING_SLASH` || key === `HIDDEN_CLASSIFICATION_LABELS` || key === `GROUP_BY_CLASSIFICATION_LABEL`) return
 
     if (key === undefined || key === null) {
         throw new Error(`Config['${key}'] is undefined or null. Please check .env.local file.`)
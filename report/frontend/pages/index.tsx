@@ -11,22 +11,33 @@ import TableInfo from '../templates/localFragments/Indices'
 import { ElasticProductInfo, ScanResult } from '../types/elastic'
 import { API, APIStatus } from '../util/api'
 import { LocalStorageInternal, LocalStorageKeys, LocalStorageManager } from '../util/localStorage'
-import mongoClientPromise, { usefulScanResultFilter } from '../util/mongo'
+import mongoClientPromise, { hiddenUsefulScanResultFilter, reportedScanResultFilter, usefulScanResultFilter } from '../util/mongo'
 import { tcAsync } from '../util/react-essentials'
 
+// label is the classification label of the instance, if any
+type InterestingScanResult = { rootUrl: string; id: string; label: string | null; }
+
+const UNLABELLED = `unlabelled`
+
 const Home: NextPage<{
   count: number,
-  allInterestingScanResults: { rootUrl: string; id: string; }[]
+  allInterestingScanResults: InterestingScanResult[]
   allUninterestingScanResultsUrls: { rootUrl: string }[]
+  hiddenCount: number
+  hiddenLabels: string[]
+  groupByLabel: boolean
 }> = ({
   count,
   allInterestingScanResults,
   allUninterestingScanResultsUrls,
+  hiddenCount,
+  hiddenLabels,
+  groupByLabel,
 }) => {
     const [
       newInterstingScanResults,
       setNewInterestingScanResults
-    ] = useState<{ rootUrl: string; id: string; }[]>([])
+    ] = useState<InterestingScanResult[]>([])
     const [
       newUninterestingUrls,
       setNewUninterestingUrls
@@ -111,6 +122,30 @@ const Home: NextPage<{
         </x.section> : null
     }, [newUninterestingUrls, onSaveUninterestingUrlsAsReviewed])
 
+    const toBeReviewedScanResults = useMemo(() => {
+      return (persistentDatbaseServerAvailableStatus === APIStatus.SUCCESSFUL ? newInterstingScanResults : allInterestingScanResults)
+        .filter(({ rootUrl }) => !reviewedUrlsInCurrentSession?.[rootUrl])
+    }, [persistentDatbaseServerAvailableStatus, newInterstingScanResults, allInterestingScanResults, reviewedUrlsInCurrentSession])
+
+    // label -> scan results. a single group of all scan results if not grouped by label
+    const toBeReviewedScanResultsGroups = useMemo(() => {
+      if (!groupByLabel) {
+        return [{ label: null, scanResults: toBeReviewedScanResults }]
+      }
+      const groups: { label: string | null; scanResults: InterestingScanResult[] }[] = []
+      toBeReviewedScanResults.forEach((scanResult) => {
+        const label = scanResult.label ?? UNLABELLED
+        const group = groups.find((group) => group.label === label)
+        if (group) {
+          group.scanResults.push(scanResult)
+        } else {
+          groups.push({ label, scanResults: [scanResult] })
+        }
+      })
+      // unlabelled instances are the most likely to be interesting
+      return groups.sort((a, b) => Number(b.label === UNLABELLED) - Number(a.label === UNLABELLED))
+    }, [groupByLabel, toBeReviewedScanResults])
+
     return (
       <Layout>
         <x.main {...SF.fullWH} p={{ md: 10, xs: 5 }}>
@@ -140,6 +175,9 @@ const Home: NextPage<{
                 </TableInfo>
             }
 
+            {hiddenCount > 0 ? <x.p color='gray-400' fontSize={{ md: `1g`, xs: `base` }}>
+              {hiddenCount} instances classified as {hiddenLabels.join(`, `)} are hidden.
+            </x.p> : null}
           </x.header>
           {persistentDatbaseServerAvailableStatus === APIStatus.SUCCESSFUL ? uninterestingUrlsInstruction : null}
           <x.section
@@ -171,21 +209,21 @@ const Home: NextPage<{
               <x.h2 color="gray-400" pb={2}>
                 To be reviewed in current session (based on localStorage data):
               </x.h2>
-              <x.ul spaceY={1}>
-                {(persistentDatbaseServerAvailableStatus === APIStatus.SUCCESSFUL ? newInterstingScanResults : allInterestingScanResults).map(({ rootUrl, id }) => {
-                  if (reviewedUrlsInCurrentSession?.[rootUrl]) {
-                    return null
-                  }
-                  return (
-                    <Link href={`/reports/${id}?rootUrl=${rootUrl}`} key={id} passHref>
-                      <x.li fontSize='xl' color='gray-400' textDecoration='underline' bg={{ _: 'none', 'hover': 'gray-700' }} style={SF.cursorPointer}>
-                        {rootUrl}
-                      </x.li>
-                    </Link>
-                  )
-                })
-                }
-              </x.ul>
+              {toBeReviewedScanResultsGroups.map(({ label, scanResults }) => (
+                <React.Fragment key={label ?? UNLABELLED}>
+                  {label ? <x.h3 color="gray-400" pt={2} pb={1}>{label} ({scanResults.length})</x.h3> : null}
+                  <x.ul spaceY={1}>
+                    {scanResults.map(({ rootUrl, id }) => (
+                      <Link href={`/reports/${id}?rootUrl=${rootUrl}`} key={id} passHref>
+                        <x.li fontSize='xl' color='gray-400' textDecoration='underline' bg={{ _: 'none', 'hover': 'gray-700' }} style={SF.cursorPointer}>
+                          {rootUrl}
+                        </x.li>
+                      </Link>
+                    ))
+                    }
+                  </x.ul>
+                </React.Fragment>
+              ))}
             </x.article>
           </x.section>
         </x.main>
@@ -205,16 +243,18 @@ export const getStaticProps: GetStaticProps = async (context) => {
    */
   const allInterestingScanResults =
     await collection
-      .find(usefulScanResultFilter)
+      .find(reportedScanResultFilter)
       .map(({
         scanResult,
         // for findById in child pages
         _id
       }) => ({
         rootUrl: scanResult.rootUrl,
-        id: _id.toString()
+        id: _id.toString(),
+        label: scanResult.classification?.label ?? null,
       }))
       .toArray()
+  const hiddenCount = Config.HIDDEN_CLASSIFICATION_LABELS.length > 0 ? await collection.count(hiddenUsefulScanResultFilter) : 0
   const allUninterestingScanResultsUrls =
     await collection
       .find({ $nor: [usefulScanResultFilter] })
@@ -230,6 +270,9 @@ export const getStaticProps: GetStaticProps = async (context) => {
       count,
       allInterestingScanResults,
       allUninterestingScanResultsUrls,
+      hiddenCount,
+      hiddenLabels: Config.HIDDEN_CLASSIFICATION_LABELS,
+      groupByLabel: Config.GROUP_BY_CLASSIFICATION_LABEL,
     },
     // revalidate every 30 mins to speed up build speed while developing
     revalidate: 60 * 30
@@ -5,12 +5,12 @@ import { x } from "@xstyled/styled-components";
 import { SF } from "../../styles/fragments";
 import { getOnlyNumber, getOnlyString } from "../../util/string";
 import PreInfo from "../../templates/localFragments/PreInfo";
-import { getUnitScore, SizeUnit } from "../../util/filesize";
+import { formatBytes, getUnitScore, SizeUnit } from "../../util/filesize";
 import TableInfo from "../../templates/localFragments/Indices";
 import Layout from "../../components/layout/layout";
 import { GetStaticPaths, GetStaticProps, NextPage } from "next";
 
-import mongoClientPromise, { usefulScanResultFilter } from '../../util/mongo'
+import mongoClientPromise, { reportedScanResultFilter } from '../../util/mongo'
 import { ObjectId } from "bson";
 import { QuickActionButtons } from "../../components/quickActionButtons/quickActionButtons";
 import { Config } from "../../config/env";
@@ -47,6 +47,10 @@ const Report: NextPage<ReportProps> = enhance<ReportProps>(({
         if (!scanResult || !scanResult.indices) return null
 
         return [...scanResult.indices].sort((a, b) => {
+            // results written before sizes were parsed only have the strings
+            if (typeof a.storeSizeBytes === `number` && typeof b.storeSizeBytes === `number`) {
+                return b.storeSizeBytes - a.storeSizeBytes
+            }
             if (!a["store.size"]) {
                 return 1
             } else if (!b["store.size"]) {
@@ -81,6 +85,8 @@ const Report: NextPage<ReportProps> = enhance<ReportProps>(({
                 `docs.count`,
                 `docs.deleted`,
                 `pri.store.size`,
+                `sensitive fields`,
+                `score`,
             ]}
             title="Indices"
         >
@@ -105,6 +111,12 @@ const Report: NextPage<ReportProps> = enhance<ReportProps>(({
                         <x.td>{index["docs.count"]}</x.td>
                         <x.td>{index["docs.deleted"]}</x.td>
                         <x.td>{index["pri.store.size"]}</x.td>
+                        <x.td
+                            {...(index.sensitiveFields?.length ? {
+                                color: `red-800`
+                            } : {})}
+                        >{(index.sensitiveFields ?? []).map(({ path, category }) => `${path} (${category})`).join(`, `)}</x.td>
+                        <x.td title={index.scoreReason}>{index.score}</x.td>
                     </x.tr>
                 })
             }
@@ -280,6 +292,78 @@ const Report: NextPage<ReportProps> = enhance<ReportProps>(({
                         {scanResult.rootUrl}
                     </x.a>
                 </x.h1>
+                {scanResult.clusterInfo ? <x.p
+                    color="gray-400"
+                    pt={1}
+                    pb={1}
+                >
+                    {`${scanResult.clusterInfo.distribution} ${scanResult.clusterInfo.versionNumber}, cluster ${scanResult.clusterInfo.clusterName}`}
+                </x.p> : null}
+                {scanResult.totalStoreSizeBytes || scanResult.totalDocsCount ? <x.p
+                    color="gray-400"
+                    pt={1}
+                    pb={1}
+                >
+                    {`${scanResult.totalDocsCount ?? 0} docs, ${formatBytes(scanResult.totalStoreSizeBytes ?? 0)} in total.`}
+                    {scanResult.skippedReason ? ` Indices were not requested because it ${scanResult.skippedReason}.` : null}
+                </x.p> : null}
+                {scanResult.classification ? <x.p
+                    color="red-300"
+                    pt={1}
+                    pb={1}
+                >
+                    {`Classified as ${scanResult.classification.label} (confidence ${scanResult.classification.confidence})${scanResult.classification.evidence?.length ? ` because of ${scanResult.classification.evidence.join(`, `)}` : ``}.`}
+                </x.p> : null}
+                {scanResult.compromise ? <x.p
+                    color="red-300"
+                    pt={1}
+                    pb={1}
+                >
+                    {[
+                        `Compromised. Ransom note indices: ${scanResult.compromise.noteIndices.join(`, `)}.`,
+                        scanResult.compromise.demandedAmount ? `Demanded amount: ${scanResult.compromise.demandedAmount}.` : null,
+                        scanResult.compromise.contactEmails?.length ? `Contacts: ${scanResult.compromise.contactEmails.join(`, `)}.` : null,
+                        scanResult.compromise.btcAddresses?.length ? `BTC addresses: ${scanResult.compromise.btcAddresses.join(`, `)}.` : null,
+                        scanResult.compromise.xmrAddresses?.length ? `XMR addresses: ${scanResult.compromise.xmrAddresses.join(`, `)}.` : null,
+                    ].filter(Boolean).join(` `)}
+                </x.p> : null}
+                {scanResult.compromise?.note ? <x.pre
+                    color="gray-400"
+                    pt={1}
+                    pb={1}
+                    style={SF.wrapLines}
+                >
+                    {scanResult.compromise.note}
+                </x.pre> : null}
+                {scanResult.securityPosture ? <x.p
+                    color={scanResult.securityPosture.authDisabled || scanResult.securityPosture.anonymousRoles?.length ? `red-300` : `gray-400`}
+                    pt={1}
+                    pb={1}
+                >
+                    {[
+                        scanResult.securityPosture.authDisabled ? `Authentication is disabled.` : null,
+                        scanResult.securityPosture.anonymousRoles?.length ? `Anonymous access is enabled with roles ${scanResult.securityPosture.anonymousRoles.join(`, `)}.` : null,
+                        scanResult.securityPosture.licenseType ? `License: ${scanResult.securityPosture.licenseType} (${scanResult.securityPosture.licenseStatus}).` : null,
+                        scanResult.securityPosture.snapshotRepositories?.length ? `Snapshot repositories: ${scanResult.securityPosture.snapshotRepositories.map(({ name, type }) => `${name} (${type})`).join(`, `)}.` : null,
+                        scanResult.securityPosture.httpTLSEnabled === false ? `HTTP is not encrypted.` : null,
+                    ].filter(Boolean).join(` `)}
+                </x.p> : null}
+                {scanResult.securityPlugin ? <x.p
+                    color="gray-400"
+                    pt={1}
+                    pb={1}
+                >
+                    {scanResult.securityPlugin.userName ?
+                        `Security plugin is ${scanResult.securityPlugin.status}. Authenticated as ${scanResult.securityPlugin.userName} with roles ${(scanResult.securityPlugin.roles ?? []).join(`, `)}.` :
+                        `Security plugin is ${scanResult.securityPlugin.status}.`}
+                </x.p> : null}
+                {scanResult.authMode && scanResult.authMode !== `none` ? <x.p
+                    color="gray-400"
+                    pt={1}
+                    pb={1}
+                >
+                    {`Scanned with ${scanResult.authMode} authentication.`}
+                </x.p> : null}
                 {wasCurrentRootUrlReviewed ? <x.p
                     color="red-300"
                     pt={1}
@@ -337,7 +421,7 @@ export const getStaticProps: GetStaticProps<{}, { id: string }> = async (context
                     $gte: new ObjectId(context.params.id)
                 },
             },
-            usefulScanResultFilter,
+            reportedScanResultFilter,
         ]
     }).limit(2)
 
@@ -364,7 +448,7 @@ export const getStaticPaths: GetStaticPaths<{ id: string }> = async () => {
 
     const allInterestingScanResultsIds =
        await collection
-        .find(usefulScanResultFilter)
+        .find(reportedScanResultFilter)
         .map(({ _id }) => ({ id: _id.toString() })).toArray()
 
     return {
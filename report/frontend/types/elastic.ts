@@ -2,7 +2,13 @@ import { ObjectId } from "bson";
 
 export interface ElasticProductInfo {
     _id: string
+    // absent in results written before schema versions were introduced
+    schemaVersion?: number
+    // elasticsearch | kibana | opensearch
+    product?: string
     rootUrl: string
+    // none | basic | apikey | bearer. absent in results written before -creds was introduced
+    authMode?: string
     // {"index":"index_name","docs.count":"2355","docs.deleted":"0","store.size":"3.8mb","pri.store.size":"3.8mb"}
     indices: null | {
         index: string
@@ -10,6 +16,26 @@ export interface ElasticProductInfo {
         "docs.deleted": string
         "store.size": string
         "pri.store.size": string
+        // parsed from the strings above. absent in results written before they were introduced, null if not a number
+        docsCountNumber?: null | number
+        docsDeletedNumber?: null | number
+        storeSizeBytes?: null | number
+        priStoreSizeBytes?: null | number
+        // fields of the mapping whose names look sensitive. absent if none were found
+        sensitiveFields?: {
+            // dotted path from the root of a document, like customer.card.number
+            path: string
+            type: string
+            // credential | government_id | financial | contact | personal | health | geolocation
+            category: string
+            matchedName: string
+            // true if inside a nested field
+            nested: boolean
+        }[]
+        // how likely the index holds sensitive data. indices with the highest scores were requested within -max-i
+        score?: number
+        // like "name has customer +40, 2355 docs +20"
+        scoreReason?: string
     }[]
     // this data is too complex. It will be presented in <pre> tag, so just render it as string
     indicesInfoInJson: string
@@ -39,22 +65,102 @@ export interface ElasticProductInfo {
         "shards": string | null
     }[]
     isInitialized: boolean
+    // only from elasticsearch and opensearch. absent if the root URL did not answer like elasticsearch
+    clusterInfo?: null | {
+        versionNumber: string
+        // elasticsearch | opensearch
+        distribution: string
+        buildFlavor: string
+        clusterName: string
+        clusterUuid: string
+        tagline: string
+    }
+    // only from elasticsearch. absent in results written before it was introduced
+    securityPosture?: null | {
+        authDisabled: boolean
+        // _anonymous by default if anonymous access is enabled
+        authenticatedUser: string
+        anonymousRoles: null | string[]
+        // basic | trial | gold | platinum | enterprise
+        licenseType: string
+        licenseStatus: string
+        snapshotRepositories: null | {
+            name: string
+            // fs | url | s3 | gcs | azure | hdfs | ...
+            type: string
+            location: string
+        }[]
+        remoteClusters: null | string[]
+        // null if _nodes/settings could not be read
+        httpTLSEnabled: null | boolean
+        transportTLSEnabled: null | boolean
+    }
+    // only from opensearch. cluster | dashboards
+    component?: string
+    // only from opensearch clusters. absent if the security plugin is not installed
+    securityPlugin?: null | {
+        apiPath: string
+        // UP | DOWN
+        status: string
+        // strict | lenient
+        mode: string
+        // opendistro_security_anonymous if anonymous authentication is enabled
+        userName?: string
+        roles?: null | string[]
+        backendRoles?: null | string[]
+    }
+    // indices whose search result was cut off at -max-response-size
+    truncatedIndices?: null | string[]
+    // only from kibana
+    ipInfo?: null | {
+        subjectUrls: string
+        organizations: string
+        cloudHostingProvider: string
+        cname: string
+    }
+    // sums of store.size and docs.count of all indices, including uninteresting ones
+    totalStoreSizeBytes?: number
+    totalDocsCount?: number
+    // why no index was requested, like "has fewer docs than -min-total-docs 100"
+    skippedReason?: string
+    // what kind of instance it looks like from all of its indices. absent if nothing in particular
+    classification?: null | {
+        // ransomed | honeypot | framework_boilerplate | demo_dataset
+        label: string
+        // 0.5 to 1
+        confidence: number
+        evidence: null | string[]
+    }
+    // ransom notes found on the instance. absent if it does not look compromised
+    compromise?: null | {
+        noteIndices: string[]
+        note?: string
+        contactEmails?: null | string[]
+        btcAddresses?: null | string[]
+        xmrAddresses?: null | string[]
+        // as written in the note, like 0.015 BTC
+        demandedAmount?: string
+    }
 
     // unused properties (for now)
 
     hasAtLeastOneIndexSizeOverGB: boolean
-    // {"action":"cluster:monitor/nodes/stats","ip":"10.42.197.128","node":"fde99ab8806e","parent_task_id":"-","running_time":"3.4ms","start_time":"1635165293843","task_id":"_-IU2jWcQsaT0XsJCga1mg:8439865","timestamp":"12:34:53","type":"transport"}
-    tasks: Record<string, string>[]
     created_at: string
-    trainedModels: string
-    transforms: string
-    // not really interested in these anyway
-    count: null
-    master: null
-    nodeaatrs: null
-    nodes: null
-    pendingTasks: null
-    plugins: null
+    // only from elasticsearch and opensearch, and only the _cat APIs selected with -apis. absent otherwise
+    // {"action":"cluster:monitor/nodes/stats","ip":"10.42.197.128","node":"fde99ab8806e","parent_task_id":"-","running_time":"3.4ms","start_time":"1635165293843","task_id":"_-IU2jWcQsaT0XsJCga1mg:8439865","timestamp":"12:34:53","type":"transport"}
+    tasks?: null | Record<string, string>[]
+    trainedModels?: null | Record<string, string>[]
+    transforms?: null | Record<string, string>[]
+    // {"epoch":"1635165293","timestamp":"12:34:53","count":"2355"}
+    count?: null | Record<string, string>[]
+    // {"id":"_-IU2jWcQsaT0XsJCga1mg","host":"10.42.197.128","ip":"10.42.197.128","node":"fde99ab8806e"}
+    master?: null | Record<string, string>[]
+    nodeAttrs?: null | Record<string, string>[]
+    // {"ip":"10.42.197.128","heap.percent":"40","ram.percent":"97","cpu":"3","node.role":"dilm","master":"*","name":"fde99ab8806e"}
+    nodes?: null | Record<string, string>[]
+    pendingTasks?: null | Record<string, string>[]
+    // {"name":"fde99ab8806e","component":"repository-s3","version":"7.10.2"}
+    plugins?: null | Record<string, string>[]
 }
 
 export interface ScanResult {
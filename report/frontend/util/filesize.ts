@@ -31,4 +31,18 @@ export function getUnitScore(unit: SizeUnit) {
         default:
             return 0
     }
-}
\ No newline at end of file
+}
+
+const SIZE_UNITS_IN_ORDER = [SizeUnit.b, SizeUnit.kb, SizeUnit.mb, SizeUnit.gb, SizeUnit.tb, SizeUnit.pb, SizeUnit.eb, SizeUnit.zb]
+
+// 3984588 -> 3.8mb, like store.size of _cat/indices
+export function formatBytes(bytes: number): string {
+    let size = bytes
+    let unitIndex = 0
+    while (size >= 1024 && unitIndex < SIZE_UNITS_IN_ORDER.length - 1) {
+        size /= 1024
+        unitIndex++
+    }
+
+    return `${unitIndex === 0 ? size : size.toFixed(1)}${SIZE_UNITS_IN_ORDER[unitIndex]}`
+}
@@ -1,4 +1,5 @@
 import { Filter, MongoClient, MongoClientOptions } from 'mongodb'
+import { Config } from '../config/env'
 import { ScanResult } from '../types/elastic'
 
 const uri = process.env.MONGODB_URI as string
@@ -42,3 +43,17 @@ export const usefulScanResultFilter: Filter<ScanResult> = {
       'scanResult.indicesInfoInJson': { $ne: null }
     }]
 }
+
+const hiddenScanResultFilter: Filter<ScanResult> = {
+    'scanResult.classification.label': { $in: Config.HIDDEN_CLASSIFICATION_LABELS }
+}
+
+// useful scan results that are not hidden by -hide-labels. pages are generated for these
+export const reportedScanResultFilter: Filter<ScanResult> = {
+    $and: [usefulScanResultFilter, { $nor: [hiddenScanResultFilter] }]
+}
+
+// useful scan results hidden by -hide-labels
+export const hiddenUsefulScanResultFilter: Filter<ScanResult> = {
+    $and: [usefulScanResultFilter, hiddenScanResultFilter]
+}